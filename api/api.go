@@ -5,26 +5,38 @@
 package api
 
 import (
-	"encoding/json"
-	"io"
+	"net/http"
+	"time"
 
+	"github.com/howler-chat/api-service/audit"
 	"github.com/howler-chat/api-service/auth"
 	. "github.com/howler-chat/api-service/errors"
 	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/realtime"
 	"github.com/howler-chat/api-service/store"
 	"golang.org/x/net/context"
 )
 
 /*
 The api interface provides access to all the public methods for clients to interact with the system. All api
-interactions are preformed via json encoded messages. This allows us to transparently use various transport methods to
-interact with the system, such as web sockets, http verbs, WebRTC data channels, sockets
+interactions are preformed with model requests and responses, which the transport encodes (IE: JSON or MessagePack).
+This allows us to transparently use various transport methods to interact with the system, such as web sockets,
+http verbs, WebRTC data channels, sockets
+
+Transports call the api through `Methods`, which decodes and validates the request before the api is called
 */
 
 type HowlerApi interface {
-	PostMessage(ctx context.Context, payload io.Reader) ([]byte, HttpError)
-	GetMessage(ctx context.Context, payload io.Reader) ([]byte, HttpError)
-	MessageList(ctx context.Context, payload io.Reader) ([]byte, HttpError)
+	PostMessage(ctx context.Context, msg *model.Message) (*model.Message, HttpError)
+	GetMessage(ctx context.Context, request *model.GetMessageRequest) (*model.Message, HttpError)
+	MessageList(ctx context.Context, request *model.ListMessageRequest) ([]model.Message, HttpError)
+	OpenConversation(ctx context.Context, request *model.OpenConversationRequest) (*model.Conversation, HttpError)
+	ConversationList(ctx context.Context, request *model.ListConversationRequest) ([]model.Conversation, HttpError)
+	GetUser(ctx context.Context, request *model.GetUserRequest) (*model.User, HttpError)
+	UserList(ctx context.Context, request *model.ListUserRequest) ([]model.User, HttpError)
+	UpdateUser(ctx context.Context, request *model.UpdateUserRequest) (*model.User, HttpError)
+	TeamInfo(ctx context.Context) (*model.Team, HttpError)
+	AuditList(ctx context.Context, request *model.ListAuditRequest) ([]model.AuditEvent, HttpError)
 }
 
 type api struct{}
@@ -33,42 +45,39 @@ func NewApi() HowlerApi {
 	return &api{}
 }
 
-// This method posts a message
+// This method posts a message, the response is the message as stored. (v1 clients only receive the id)
 // Request
 //	{ text: "This is a message", "channelId": "A124B343" }
 // Response
-//	{ id: "AS223SDFS23" }
-func (self *api) PostMessage(ctx context.Context, payload io.Reader) ([]byte, HttpError) {
+//	{ "id": "AS223SDFS23", "channelId": "A124B343", "userId": "U124B343", "text": "...", "createdAt": "..." }
+func (self *api) PostMessage(ctx context.Context, msg *model.Message) (*model.Message, HttpError) {
 	dbStore := store.GetStore(ctx)
-	var msg model.Message
 
-	// TODO: Test how this reacts to multiple json bodies in a single reader
-	decoder := json.NewDecoder(payload)
-	if err := decoder.Decode(&msg); err != nil {
-		err := HttpErrorInvalidJson(ctx, err)
-		return err.ToJson(), err
+	// Does client have access to the channel?
+	if err := auth.CanAccessChannel(ctx, msg.ChannelId); err != nil {
+		return nil, ToHttpError(ctx, err)
 	}
 
-	// Validate the Model
-	if err := msg.Validate(ctx); err != nil {
-		return err.ToJson(), err
+	// The author is always the authenticated user
+	principal, err := auth.GetPrincipal(ctx)
+	if err != nil {
+		return nil, err
 	}
+	msg.UserId = principal.UserId
+	// The store assigns the id and the time, clients can't choose or backdate them
+	msg.Id, msg.CreatedAt = "", time.Time{}
 
-	// Does client have access to the channel?
-	if err := auth.CanAccessChannel(ctx, msg.ChannelId); err != nil {
-		return err.ToJson(), err
+	if err := dbStore.InsertMessage(ctx, msg); err != nil {
+		return nil, ToHttpError(ctx, err)
 	}
 
-	if err := dbStore.InsertMessage(ctx, &msg); err != nil {
-		return err.ToJson(), err
+	// Deliver the message to clients subscribed to the channel
+	if hub := realtime.GetHub(ctx); hub != nil {
+		published := *msg
+		hub.Publish(&published)
 	}
 
-	resp, err := json.Marshal(map[string]interface{}{"id": msg.Id})
-	if err != nil {
-		err := HttpErrorInternalJson(ctx, "api.PostMessage()", err)
-		return err.ToJson(), err
-	}
-	return resp, nil
+	return msg, nil
 }
 
 // This method gets a message
@@ -76,37 +85,20 @@ func (self *api) PostMessage(ctx context.Context, payload io.Reader) ([]byte, Ht
 //	{ "id": "AS223SDFS23", "channelId": "A124B343" }
 // Response
 //	{ type: "message", text: "This is a message", "channelId": "A124B343" }
-func (self *api) GetMessage(ctx context.Context, payload io.Reader) ([]byte, HttpError) {
+func (self *api) GetMessage(ctx context.Context, request *model.GetMessageRequest) (*model.Message, HttpError) {
 	dbStore := store.GetStore(ctx)
-	var request model.GetMessageRequest
-
-	decoder := json.NewDecoder(payload)
-	if err := decoder.Decode(&request); err != nil {
-		err := HttpErrorInvalidJson(ctx, err)
-		return err.ToJson(), err
-	}
-
-	// Validate the Model
-	if err := request.Validate(ctx); err != nil {
-		return err.ToJson(), err
-	}
 
 	// Does client have access to the channel?
 	if err := auth.CanAccessChannel(ctx, request.ChannelId); err != nil {
-		return err.ToJson(), err
+		return nil, ToHttpError(ctx, err)
 	}
 
-	msg, err := dbStore.GetMessage(ctx, &request)
+	msg, err := dbStore.GetMessage(ctx, request)
 	if err != nil {
-		return err.ToJson(), err
+		return nil, ToHttpError(ctx, err)
 	}
 
-	resp, jsonErr := json.Marshal(msg)
-	if jsonErr != nil {
-		err := HttpErrorInternalJson(ctx, "api.GetMessage()", jsonErr)
-		return err.ToJson(), err
-	}
-	return resp, nil
+	return msg, nil
 }
 
 // This method lists all messages for a channel
@@ -117,35 +109,88 @@ func (self *api) GetMessage(ctx context.Context, payload io.Reader) ([]byte, Htt
 // 		{ type: "message", text: "This is a message", "channelId": "A124B343" }
 //		...
 //	]
-func (self *api) MessageList(ctx context.Context, payload io.Reader) ([]byte, HttpError) {
+func (self *api) MessageList(ctx context.Context, request *model.ListMessageRequest) ([]model.Message, HttpError) {
 	dbStore := store.GetStore(ctx)
-	var request model.ListMessageRequest
 
-	decoder := json.NewDecoder(payload)
-	if err := decoder.Decode(&request); err != nil {
-		err := HttpErrorInvalidJson(ctx, err)
-		return err.ToJson(), err
+	// Does client have access to the channel?
+	if err := auth.CanAccessChannel(ctx, request.ChannelId); err != nil {
+		return nil, ToHttpError(ctx, err)
 	}
 
-	// Validate the Model
-	if err := request.Validate(ctx); err != nil {
-		return err.ToJson(), err
+	msg, err := dbStore.ListMessage(ctx, request)
+	if err != nil {
+		return nil, ToHttpError(ctx, err)
 	}
 
-	// Does client have access to the channel?
-	if err := auth.CanAccessChannel(ctx, request.ChannelId); err != nil {
-		return err.ToJson(), err
+	return msg, nil
+}
+
+// This method finds or creates a private conversation between the caller and the users requested. The id returned
+// is used as the channelId when posting or listing messages in the conversation
+// Request
+//	{ "userIds": [ "A124B343", "B234C454" ] }
+// Response
+//	{ "id": "DMFRGG43T", "participants": [ ... ], "createdAt": "...", "lastActivity": "..." }
+func (self *api) OpenConversation(ctx context.Context, request *model.OpenConversationRequest) (*model.Conversation, HttpError) {
+	dbStore := store.GetStore(ctx)
+
+	// The caller is always a participant of the conversation they open
+	principal, err := auth.GetPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	participants := model.Participants(append(request.UserIds, principal.UserId))
+
+	// Conversations are only allowed between active users of the same team
+	for _, userId := range participants {
+		user, err := dbStore.GetUser(ctx, userId)
+		if err != nil && store.Cause(err) != store.ErrNotFound {
+			return nil, ToHttpError(ctx, err)
+		}
+		if user == nil || user.TeamId != principal.TeamId || user.Deactivated {
+			return nil, NewHttpError(ctx, http.StatusNotFound, nil, "User '%s' not found", userId)
+		}
+	}
+
+	conversation := model.Conversation{
+		Id:           model.ConversationId(participants),
+		Participants: participants,
+	}
+
+	created, storeErr := dbStore.OpenConversation(ctx, &conversation)
+	if storeErr != nil {
+		return nil, ToHttpError(ctx, storeErr)
+	}
+	// Only a new conversation changes who can access the channel. Failures are logged and counted by Record()
+	if created {
+		_ = audit.Record(ctx, audit.NewEvent(ctx, audit.ConversationOpen, audit.TargetChannel, conversation.Id,
+			nil, conversation))
 	}
 
-	msg, err := dbStore.ListMessage(ctx, &request)
+	return &conversation, nil
+}
+
+// This method lists the conversations the caller participates in, most recently active first
+// Request
+//	{ "limit": 100 }
+// Response
+//	[
+//		{ "id": "DMFRGG43T", "participants": [ ... ], "createdAt": "...", "lastActivity": "..." }
+//		...
+//	]
+func (self *api) ConversationList(ctx context.Context, request *model.ListConversationRequest) ([]model.Conversation, HttpError) {
+	dbStore := store.GetStore(ctx)
+
+	principal, err := auth.GetPrincipal(ctx)
 	if err != nil {
-		return err.ToJson(), err
+		return nil, err
 	}
+	request.UserId = principal.UserId
 
-	resp, jsonErr := json.Marshal(msg)
-	if jsonErr != nil {
-		err := HttpErrorInternalJson(ctx, "api.MessageList()", jsonErr)
-		return err.ToJson(), err
+	conversations, storeErr := dbStore.ListConversation(ctx, request)
+	if storeErr != nil {
+		return nil, ToHttpError(ctx, storeErr)
 	}
-	return resp, nil
+
+	return conversations, nil
 }
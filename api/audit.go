@@ -0,0 +1,36 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/howler-chat/api-service/auth"
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"golang.org/x/net/context"
+)
+
+// This method lists the audit events of the callers team, most recent first. The 'audit:read' scope required to
+// call the method is enforced by `Methods`
+// Request
+//	{ "action": "user.update", "actorId": "A124B343", "since": "2016-10-01T00:00:00Z", "limit": 100 }
+// Response
+//	[ { "id": "E124B343", "action": "user.update", "actorId": "A124B343", "before": {...}, "after": {...}, ... } ]
+func (self *api) AuditList(ctx context.Context, request *model.ListAuditRequest) ([]model.AuditEvent, HttpError) {
+	dbStore := store.GetStore(ctx)
+
+	principal, err := auth.GetPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request.TeamId = principal.TeamId
+
+	events, storeErr := dbStore.ListAuditEvent(ctx, request)
+	if storeErr != nil {
+		return nil, ToHttpError(ctx, storeErr)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/store"
+	"golang.org/x/net/context"
+)
+
+// Convert an error returned by the store into an HttpError suitable for the client. HttpErrors (IE: from the auth
+// package) are returned unchanged.
+func ToHttpError(ctx context.Context, err error) HttpError {
+	if httpErr, ok := err.(HttpError); ok {
+		return httpErr
+	}
+
+	switch store.Cause(err) {
+	case store.ErrNotFound:
+		return NewHttpError(ctx, http.StatusNotFound, nil, "%s", err.Error())
+	case store.ErrConflict:
+		return NewHttpError(ctx, http.StatusConflict, nil, "%s", err.Error())
+	}
+
+	// Unavailable errors are logged and counted, the client is expected to retry
+	tags := map[string]string{"type": "store"}
+	if storeErr, ok := err.(*store.Error); ok && storeErr.Tags != nil {
+		tags = storeErr.Tags
+	}
+	return NewHttpError(ctx, http.StatusServiceUnavailable, tags, "%s", err.Error())
+}
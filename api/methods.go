@@ -0,0 +1,107 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/howler-chat/api-service/auth"
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/model"
+	"golang.org/x/net/context"
+)
+
+// The methods of the HowlerApi. The http routes, JSON-RPC methods and the '/api/methods' endpoint are generated
+// from this registry; adding a method to the HowlerApi only requires adding it here
+var Methods = NewRegistry(
+	&Method{
+		Name:     "message.post",
+		Summary:  "Post a message to a channel",
+		Request:  func() Request { return &model.Message{} },
+		Response: model.Message{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.PostMessage(ctx, request.(*model.Message))
+		},
+	},
+	&Method{
+		Name:     "message.get",
+		Summary:  "Get a message",
+		Request:  func() Request { return &model.GetMessageRequest{} },
+		Response: model.Message{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.GetMessage(ctx, request.(*model.GetMessageRequest))
+		},
+	},
+	&Method{
+		Name:     "message.list",
+		Summary:  "List the messages of a channel",
+		Request:  func() Request { return &model.ListMessageRequest{} },
+		Response: []model.Message{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.MessageList(ctx, request.(*model.ListMessageRequest))
+		},
+	},
+	&Method{
+		Name:     "conversation.open",
+		Summary:  "Find or create a private conversation between the caller and the users requested",
+		Request:  func() Request { return &model.OpenConversationRequest{} },
+		Response: model.Conversation{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.OpenConversation(ctx, request.(*model.OpenConversationRequest))
+		},
+	},
+	&Method{
+		Name:     "conversation.list",
+		Summary:  "List the conversations of the caller, most recently active first",
+		Request:  func() Request { return &model.ListConversationRequest{} },
+		Response: []model.Conversation{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.ConversationList(ctx, request.(*model.ListConversationRequest))
+		},
+	},
+	&Method{
+		Name:     "user.get",
+		Summary:  "Get a user on the callers team",
+		Request:  func() Request { return &model.GetUserRequest{} },
+		Response: model.User{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.GetUser(ctx, request.(*model.GetUserRequest))
+		},
+	},
+	&Method{
+		Name:     "user.list",
+		Summary:  "List the users on the callers team ordered by handle",
+		Request:  func() Request { return &model.ListUserRequest{} },
+		Response: []model.User{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.UserList(ctx, request.(*model.ListUserRequest))
+		},
+	},
+	&Method{
+		Name:     "user.update",
+		Summary:  "Update the profile of the caller, only the fields provided are changed",
+		Request:  func() Request { return &model.UpdateUserRequest{} },
+		Response: model.User{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.UpdateUser(ctx, request.(*model.UpdateUserRequest))
+		},
+	},
+	&Method{
+		Name:     "team.info",
+		Summary:  "Get the team of the caller",
+		Response: model.Team{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.TeamInfo(ctx)
+		},
+	},
+	&Method{
+		Name:     "audit.list",
+		Summary:  "List the audit events of the callers team, most recent first",
+		Scope:    auth.ScopeAuditRead,
+		Request:  func() Request { return &model.ListAuditRequest{} },
+		Response: []model.AuditEvent{},
+		Handler: func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError) {
+			return api.AuditList(ctx, request.(*model.ListAuditRequest))
+		},
+	},
+)
@@ -0,0 +1,134 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+
+	. "github.com/howler-chat/api-service/errors"
+)
+
+const (
+	OpenApiVersion = "3.0.0"
+	// Bump when the api changes, the version is reported in the 'info' of the document
+	ApiVersion = "1.0.0"
+)
+
+// Every request and response may be encoded as any of these content types
+var contentTypes = []string{"application/json", "application/x-msgpack"}
+
+// An OpenAPI 3 document (https://spec.openapis.org/oas/v3.0.0) describing the api
+type OpenApiDocument struct {
+	OpenApi    string                                  `json:"openapi"`
+	Info       OpenApiInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenApiOperation `json:"paths"`
+	Components OpenApiComponents                       `json:"components"`
+}
+
+type OpenApiInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenApiOperation struct {
+	OperationId string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	RequestBody *OpenApiBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenApiResponse `json:"responses"`
+}
+
+type OpenApiBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]OpenApiMedia `json:"content"`
+}
+
+type OpenApiResponse struct {
+	Description string                  `json:"description"`
+	Content     map[string]OpenApiMedia `json:"content,omitempty"`
+}
+
+type OpenApiMedia struct {
+	Schema *Schema `json:"schema"`
+}
+
+type OpenApiComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Generate the OpenAPI document for the methods of the registry in every version, the models are described once
+// under 'components' and referenced by the operations that use them
+func OpenApi(registry *Registry) *OpenApiDocument {
+	builder := &schemaBuilder{components: make(map[string]*Schema)}
+	doc := &OpenApiDocument{
+		OpenApi:    OpenApiVersion,
+		Info:       OpenApiInfo{Title: "Howler API", Version: ApiVersion},
+		Paths:      make(map[string]map[string]*OpenApiOperation),
+		Components: OpenApiComponents{Schemas: builder.components},
+	}
+	errorResp := &OpenApiResponse{
+		Description: "An error, 'code' is the http status code of the response",
+		Content:     media(builder.SchemaOf(ErrorResponse{})),
+	}
+
+	for _, method := range registry.Methods() {
+		for _, version := range Versions {
+			doc.Paths["/api/"+version.Name+"/"+method.Name] = map[string]*OpenApiOperation{
+				"post": operation(builder, version, method, version.Name+"."+method.Name, errorResp),
+			}
+		}
+		doc.Paths["/api/"+method.Name] = map[string]*OpenApiOperation{
+			"post": operation(builder, Unversioned, method, method.Name, errorResp),
+		}
+	}
+
+	// The endpoints that describe the api
+	doc.Paths["/api/methods"] = map[string]*OpenApiOperation{"get": {
+		OperationId: "methods",
+		Summary:     "List the api methods and the schema of their requests and responses",
+		Responses: map[string]*OpenApiResponse{
+			"200": {Description: "Success", Content: media(builder.SchemaOf([]MethodInfo{}))},
+		},
+	}}
+	doc.Paths["/api/openapi.json"] = map[string]*OpenApiOperation{"get": {
+		OperationId: "openapi",
+		Summary:     "This document",
+		Responses: map[string]*OpenApiResponse{
+			"200": {Description: "Success", Content: media(&Schema{Type: "object"})},
+		},
+	}}
+	return doc
+}
+
+// Describe the method as it is served by the version
+func operation(builder *schemaBuilder, version *Version, method *Method, id string,
+	errorResp *OpenApiResponse) *OpenApiOperation {
+	request, response := version.Models(method)
+	result := &OpenApiOperation{
+		OperationId: id,
+		Summary:     method.Summary,
+		Deprecated:  version.Deprecation(method.Name) != nil,
+		Responses: map[string]*OpenApiResponse{
+			"200":     {Description: "Success", Content: media(builder.SchemaOf(response))},
+			"default": errorResp,
+		},
+	}
+	if method.Scope != "" {
+		result.Description = fmt.Sprintf("Requires the '%s' scope", method.Scope)
+	}
+	if request != nil {
+		result.RequestBody = &OpenApiBody{Required: true, Content: media(builder.SchemaOf(request))}
+	}
+	return result
+}
+
+func media(schema *Schema) map[string]OpenApiMedia {
+	result := make(map[string]OpenApiMedia)
+	for _, contentType := range contentTypes {
+		result[contentType] = OpenApiMedia{Schema: schema}
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api_test
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"regexp"
+	"testing"
+
+	"github.com/howler-chat/api-service/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The committed spec, such that changes to the api show up as a diff in review
+const specFile = "testdata/openapi.json"
+
+var update = flag.Bool("update", false, "Regenerate "+specFile+" from the registered api methods")
+
+func TestApi(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "API Suite")
+}
+
+var _ = Describe("OpenApi()", func() {
+	It("should match the committed spec", func() {
+		spec, err := json.MarshalIndent(api.OpenApi(api.Methods), "", "  ")
+		Expect(err).To(BeNil())
+		spec = append(spec, '\n')
+
+		if *update {
+			Expect(ioutil.WriteFile(specFile, spec, 0644)).To(Succeed())
+		}
+		committed, err := ioutil.ReadFile(specFile)
+		Expect(err).To(BeNil())
+		Expect(string(spec)).To(Equal(string(committed)),
+			"The api has changed, run 'go test ./api -args -update' and commit "+specFile)
+	})
+
+	It("should describe every registered method", func() {
+		doc := api.OpenApi(api.Methods)
+		for _, method := range api.Methods.Methods() {
+			Expect(doc.Paths).To(HaveKey("/api/" + method.Name))
+			Expect(doc.Paths["/api/"+method.Name]["post"].OperationId).To(Equal(method.Name))
+		}
+		Expect(doc.Components.Schemas["Message"].Properties["createdAt"].Format).To(Equal("date-time"))
+
+		// Every reference must resolve to a component
+		spec, err := json.Marshal(doc)
+		Expect(err).To(BeNil())
+		refs := regexp.MustCompile(`"\$ref":"#/components/schemas/(\w+)"`).FindAllStringSubmatch(string(spec), -1)
+		Expect(refs).NotTo(BeEmpty())
+		for _, ref := range refs {
+			Expect(doc.Components.Schemas).To(HaveKey(ref[1]))
+		}
+	})
+})
@@ -0,0 +1,141 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/howler-chat/api-service/auth"
+	"github.com/howler-chat/api-service/codec"
+	. "github.com/howler-chat/api-service/errors"
+	"golang.org/x/net/context"
+)
+
+// Implemented by every request model, see model.Message.Validate()
+type Request interface {
+	Validate(ctx context.Context) HttpError
+}
+
+// Calls the api with a decoded and validated request, `request` is the type returned by `Method.Request()`
+type Handler func(api HowlerApi, ctx context.Context, request Request) (interface{}, HttpError)
+
+// A Method describes a HowlerApi method. Transports (http, JSON-RPC, websockets) dispatch calls through the method
+// instead of calling the HowlerApi directly, such that every transport decodes, validates and authorizes the same way
+type Method struct {
+	// The name of the method, IE: 'message.post'. Also used as the http route and the JSON-RPC method name
+	Name    string
+	Summary string
+	// The auth scope the caller must have, or "" if any caller may call the method
+	Scope string
+	// Returns a new instance of the request model, nil if the method takes no request
+	Request func() Request
+	// An instance of the model returned by the method, used to describe the response
+	Response interface{}
+	Handler  Handler
+}
+
+// Decode the request from `payload` with `encoding`, then invoke the method
+func (self *Method) Call(ctx context.Context, payload io.Reader, encoding codec.Codec) (interface{}, HttpError) {
+	request, err := self.Decode(ctx, payload, encoding)
+	if err != nil {
+		return nil, err
+	}
+	return self.Invoke(ctx, request)
+}
+
+// Decode the request from `payload` with `encoding`, returns nil if the method takes no request
+func (self *Method) Decode(ctx context.Context, payload io.Reader, encoding codec.Codec) (Request, HttpError) {
+	if self.Request == nil {
+		return nil, nil
+	}
+	request := self.Request()
+	if err := encoding.Decode(payload, request); err != nil {
+		return nil, HttpErrorInvalidEncoding(ctx, encoding.Name(), err)
+	}
+	return request, nil
+}
+
+// Authorize the caller, validate the request and call the HowlerApi of the context. Returns the model the
+// method responds with, which the transport encodes. Transports that decode the request themselves (IE: gRPC)
+// call Invoke() directly
+func (self *Method) Invoke(ctx context.Context, request Request) (interface{}, HttpError) {
+	if self.Scope != "" {
+		if _, err := auth.RequireScope(ctx, self.Scope); err != nil {
+			return nil, err
+		}
+	}
+
+	if request != nil {
+		if err := request.Validate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return self.Handler(GetApi(ctx), ctx, request)
+}
+
+// A summary of the method suitable for clients discovering the api
+type MethodInfo struct {
+	Name     string  `json:"name"`
+	Summary  string  `json:"summary"`
+	Scope    string  `json:"scope,omitempty"`
+	Request  *Schema `json:"request"`
+	Response *Schema `json:"response"`
+}
+
+func (self *Method) Info() MethodInfo {
+	info := MethodInfo{
+		Name:     self.Name,
+		Summary:  self.Summary,
+		Scope:    self.Scope,
+		Request:  &Schema{Type: "object"},
+		Response: SchemaOf(self.Response),
+	}
+	if self.Request != nil {
+		info.Request = SchemaOf(self.Request())
+	}
+	return info
+}
+
+// The Registry holds the methods of the api in the order they were registered
+type Registry struct {
+	methods []*Method
+	byName  map[string]*Method
+}
+
+func NewRegistry(methods ...*Method) *Registry {
+	registry := &Registry{byName: make(map[string]*Method)}
+	for _, method := range methods {
+		registry.Register(method)
+	}
+	return registry
+}
+
+// Panics if a method of the same name is already registered
+func (self *Registry) Register(method *Method) {
+	if _, exists := self.byName[method.Name]; exists {
+		panic(fmt.Sprintf("api method '%s' registered twice", method.Name))
+	}
+	self.methods = append(self.methods, method)
+	self.byName[method.Name] = method
+}
+
+// Returns the method registered as `name`, or nil if there is none
+func (self *Registry) Get(name string) *Method {
+	return self.byName[name]
+}
+
+func (self *Registry) Methods() []*Method {
+	return self.methods
+}
+
+// Returns a summary of every method, used by the '/api/methods' endpoint
+func (self *Registry) Info() []MethodInfo {
+	var result []MethodInfo
+	for _, method := range self.methods {
+		result = append(result, method.Info())
+	}
+	return result
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api_test
+
+import (
+	"strings"
+
+	"github.com/howler-chat/api-service/api"
+	"github.com/howler-chat/api-service/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+)
+
+var _ = Describe("Methods", func() {
+	ctx := api.AddApi(context.Background(), api.NewApi())
+
+	// Validation fails before the HowlerApi is called, so no store is required
+	invalid := map[string]struct {
+		method  string
+		request api.Request
+		field   string
+	}{
+		"post without a channel":  {"message.post", &model.Message{Text: "hello"}, "channelId"},
+		"post with an invalid id": {"message.post", &model.Message{ChannelId: "C1", Text: "hello"}, "channelId"},
+		"post without text":       {"message.post", &model.Message{ChannelId: "C000000001"}, "text"},
+		"get without a channel":   {"message.get", &model.GetMessageRequest{MessageId: "M000000001"}, "channelId"},
+		"get without a message":   {"message.get", &model.GetMessageRequest{ChannelId: "C000000001"}, "messageId"},
+		"list with an invalid id": {"message.list", &model.ListMessageRequest{ChannelId: "C1"}, "channelId"},
+		"post with too much text": {"message.post",
+			&model.Message{ChannelId: "C000000001", Text: strings.Repeat("a", 301)}, "text"},
+	}
+	for name, test := range invalid {
+		test := test
+		It("should reject a "+name, func() {
+			_, err := api.Methods.Get(test.method).Invoke(ctx, test.request)
+			Expect(err).NotTo(BeNil())
+			Expect(err.GetCode()).To(Equal(406))
+			Expect(err.GetMessage()).To(ContainSubstring("'" + test.field + "'"))
+		})
+	}
+})
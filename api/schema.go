@@ -0,0 +1,118 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// A Schema describes the json encoding of a model. This is the subset of JSON Schema used by OpenAPI 3
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// Returns the schema of the json encoding of `obj`, fields are named by their json tags
+func SchemaOf(obj interface{}) *Schema {
+	return (&schemaBuilder{}).SchemaOf(obj)
+}
+
+// If components is not nil, named structs are added to components and referenced instead of repeated inline
+type schemaBuilder struct {
+	components map[string]*Schema
+}
+
+func (self *schemaBuilder) SchemaOf(obj interface{}) *Schema {
+	if obj == nil {
+		return &Schema{}
+	}
+	return self.schemaOf(reflect.TypeOf(obj))
+}
+
+func (self *schemaBuilder) schemaOf(kind reflect.Type) *Schema {
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+
+	switch kind {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawType:
+		// Any json value
+		return &Schema{}
+	}
+
+	switch kind.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if kind.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: self.schemaOf(kind.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: self.schemaOf(kind.Elem())}
+	case reflect.Struct:
+		if self.components == nil || kind.Name() == "" {
+			return self.structSchema(kind)
+		}
+		if _, exists := self.components[kind.Name()]; !exists {
+			// Reserve the name first, in case the struct refers to itself
+			self.components[kind.Name()] = &Schema{}
+			self.components[kind.Name()] = self.structSchema(kind)
+		}
+		return &Schema{Ref: "#/components/schemas/" + kind.Name()}
+	}
+	return &Schema{}
+}
+
+func (self *schemaBuilder) structSchema(kind reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	self.addFields(schema, kind)
+	return schema
+}
+
+// Add the exported fields of the struct to the schema, embedded structs are flattened as encoding/json does
+func (self *schemaBuilder) addFields(schema *Schema, kind reflect.Type) {
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			self.addFields(schema, field.Type)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = self.schemaOf(field.Type)
+	}
+}
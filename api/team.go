@@ -0,0 +1,34 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/howler-chat/api-service/auth"
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"golang.org/x/net/context"
+)
+
+// This method returns the team of the caller
+// Request
+//	{}
+// Response
+//	{ "id": "T124B343", "name": "Howler", "domain": "howler", "createdAt": "..." }
+func (self *api) TeamInfo(ctx context.Context) (*model.Team, HttpError) {
+	dbStore := store.GetStore(ctx)
+
+	principal, err := auth.GetPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	team, storeErr := dbStore.GetTeam(ctx, principal.TeamId)
+	if storeErr != nil {
+		return nil, ToHttpError(ctx, storeErr)
+	}
+
+	return team, nil
+}
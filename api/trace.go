@@ -0,0 +1,106 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/trace"
+	"golang.org/x/net/context"
+)
+
+// The TracedApi wraps a HowlerApi and records a span for every call, calls made without a span in the context are
+// not traced
+type TracedApi struct {
+	Api HowlerApi
+}
+
+func NewTracedApi(api HowlerApi) *TracedApi {
+	return &TracedApi{Api: api}
+}
+
+// Client errors are recorded on the span, but only server errors mark the span as failed
+func finishSpan(span *trace.Span, err HttpError) {
+	if err != nil {
+		span.SetAttribute("http.status_code", strconv.Itoa(err.GetCode()))
+		if err.GetCode() >= 500 {
+			span.SetError(fmt.Errorf("%s", err.GetMessage()))
+		}
+	}
+	span.Finish()
+}
+
+func (self *TracedApi) PostMessage(ctx context.Context, msg *model.Message) (*model.Message, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.PostMessage")
+	result, err := self.Api.PostMessage(ctx, msg)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (self *TracedApi) GetMessage(ctx context.Context, request *model.GetMessageRequest) (*model.Message, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.GetMessage")
+	result, err := self.Api.GetMessage(ctx, request)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (self *TracedApi) MessageList(ctx context.Context, request *model.ListMessageRequest) ([]model.Message, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.MessageList")
+	result, err := self.Api.MessageList(ctx, request)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (self *TracedApi) OpenConversation(ctx context.Context, request *model.OpenConversationRequest) (*model.Conversation, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.OpenConversation")
+	result, err := self.Api.OpenConversation(ctx, request)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (self *TracedApi) ConversationList(ctx context.Context, request *model.ListConversationRequest) ([]model.Conversation, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.ConversationList")
+	result, err := self.Api.ConversationList(ctx, request)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (self *TracedApi) GetUser(ctx context.Context, request *model.GetUserRequest) (*model.User, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.GetUser")
+	result, err := self.Api.GetUser(ctx, request)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (self *TracedApi) UserList(ctx context.Context, request *model.ListUserRequest) ([]model.User, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.UserList")
+	result, err := self.Api.UserList(ctx, request)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (self *TracedApi) UpdateUser(ctx context.Context, request *model.UpdateUserRequest) (*model.User, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.UpdateUser")
+	result, err := self.Api.UpdateUser(ctx, request)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (self *TracedApi) TeamInfo(ctx context.Context) (*model.Team, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.TeamInfo")
+	result, err := self.Api.TeamInfo(ctx)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (self *TracedApi) AuditList(ctx context.Context, request *model.ListAuditRequest) ([]model.AuditEvent, HttpError) {
+	ctx, span := trace.StartSpan(ctx, "api.AuditList")
+	result, err := self.Api.AuditList(ctx, request)
+	finishSpan(span, err)
+	return result, err
+}
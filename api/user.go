@@ -0,0 +1,111 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/howler-chat/api-service/audit"
+	"github.com/howler-chat/api-service/auth"
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"golang.org/x/net/context"
+)
+
+// Fetch the user and ensure it belongs to the callers team. Users on other teams are reported as not found
+func getTeamUser(ctx context.Context, principal *auth.Principal, userId string) (*model.User, HttpError) {
+	user, err := store.GetStore(ctx).GetUser(ctx, userId)
+	if err != nil && store.Cause(err) != store.ErrNotFound {
+		return nil, ToHttpError(ctx, err)
+	}
+	if user == nil || user.TeamId != principal.TeamId {
+		return nil, NewHttpError(ctx, http.StatusNotFound, nil, "User '%s' not found", userId)
+	}
+	return user, nil
+}
+
+// This method gets a user on the callers team
+// Request
+//	{ "userId": "A124B343" }
+// Response
+//	{ "id": "A124B343", "teamId": "T124B343", "handle": "thrawn", "displayName": "Derrick", ... }
+func (self *api) GetUser(ctx context.Context, request *model.GetUserRequest) (*model.User, HttpError) {
+	principal, err := auth.GetPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := getTeamUser(ctx, principal, request.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// This method lists the users on the callers team ordered by handle
+// Request
+//	{ "limit": 100, "includeDeactivated": false }
+// Response
+//	[
+//		{ "id": "A124B343", "teamId": "T124B343", "handle": "thrawn", "displayName": "Derrick", ... }
+//		...
+//	]
+func (self *api) UserList(ctx context.Context, request *model.ListUserRequest) ([]model.User, HttpError) {
+	dbStore := store.GetStore(ctx)
+
+	principal, err := auth.GetPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request.TeamId = principal.TeamId
+
+	users, storeErr := dbStore.ListUser(ctx, request)
+	if storeErr != nil {
+		return nil, ToHttpError(ctx, storeErr)
+	}
+
+	return users, nil
+}
+
+// This method updates the profile of the caller, only the fields provided are changed
+// Request
+//	{ "userId": "A124B343", "displayName": "Derrick", "status": "On Vacation" }
+// Response
+//	{ "id": "A124B343", "teamId": "T124B343", "handle": "thrawn", "displayName": "Derrick", ... }
+func (self *api) UpdateUser(ctx context.Context, request *model.UpdateUserRequest) (*model.User, HttpError) {
+	dbStore := store.GetStore(ctx)
+
+	principal, err := auth.GetPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users may only change their own profile
+	if request.UserId != principal.UserId {
+		return nil, NewHttpError(ctx, http.StatusForbidden, nil, "You may not modify user '%s'", request.UserId)
+	}
+
+	user, err := getTeamUser(ctx, principal, request.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *user
+	request.Apply(user)
+	if err := user.Validate(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := dbStore.UpdateUser(ctx, user); err != nil {
+		return nil, ToHttpError(ctx, err)
+	}
+	// The user is already updated, so a failure to record is logged and counted by Record() instead of failing
+	// the request
+	_ = audit.Record(ctx, audit.NewEvent(ctx, audit.UserUpdate, audit.TargetUser, user.Id, before, user))
+
+	return user, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"io"
+	"time"
+
+	"github.com/howler-chat/api-service/codec"
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/model"
+	"golang.org/x/net/context"
+)
+
+// Converts the requests and responses of a method between a version and the models the HowlerApi uses. Only the
+// versions whose models differ from the HowlerApi need a transform
+type Transform struct {
+	// Returns a new instance of the request model of this version, nil if the version uses the method's request
+	Request func() Request
+	// Converts the request of this version into the request the method expects
+	ToRequest func(request Request) Request
+	// An instance of the response model of this version, nil if the version uses the method's response
+	Response interface{}
+	// Converts the response of the method into the response of this version
+	FromResponse func(response interface{}) interface{}
+}
+
+// Describes a method clients should stop calling, sent to the client as the 'Deprecation' and 'Sunset' headers.
+// Deprecations of an entire version are dated by the operator in the config, not here
+type Deprecation struct {
+	// When the method was deprecated
+	Since time.Time
+	// When the method will be removed, zero if no date has been set
+	Sunset time.Time
+	// The version clients should call instead, IE: 'v2'
+	Successor string
+}
+
+// A Version of the api shares the methods of `Methods`, but may transform the requests and responses of those
+// methods such that old clients continue to work when the models change
+type Version struct {
+	// The name of the version, also the route prefix IE: 'v1' is served from '/api/v1'
+	Name       string
+	Transforms map[string]*Transform
+	// Methods that are deprecated in this version
+	Deprecations map[string]*Deprecation
+	// The version clients of this version should move to, empty for the current version
+	Successor string
+}
+
+// Returns the deprecation of the method, or nil if the method is not deprecated in this version
+func (self *Version) Deprecation(name string) *Deprecation {
+	return self.Deprecations[name]
+}
+
+// Decode the request of this version, invoke the method and return the response of this version
+func (self *Version) Call(ctx context.Context, method *Method, payload io.Reader,
+	encoding codec.Codec) (interface{}, HttpError) {
+	transform := self.Transforms[method.Name]
+	if transform == nil {
+		return method.Call(ctx, payload, encoding)
+	}
+
+	var request Request
+	if transform.Request != nil {
+		request = transform.Request()
+		if err := encoding.Decode(payload, request); err != nil {
+			return nil, HttpErrorInvalidEncoding(ctx, encoding.Name(), err)
+		}
+	} else {
+		var err HttpError
+		if request, err = method.Decode(ctx, payload, encoding); err != nil {
+			return nil, err
+		}
+	}
+	if transform.ToRequest != nil {
+		request = transform.ToRequest(request)
+	}
+
+	response, err := method.Invoke(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if transform.FromResponse != nil {
+		response = transform.FromResponse(response)
+	}
+	return response, nil
+}
+
+// Returns the request and response models of the method in this version, used to describe the version
+func (self *Version) Models(method *Method) (Request, interface{}) {
+	var request Request
+	if method.Request != nil {
+		request = method.Request()
+	}
+	response := method.Response
+
+	if transform := self.Transforms[method.Name]; transform != nil {
+		if transform.Request != nil {
+			request = transform.Request()
+		}
+		if transform.Response != nil {
+			response = transform.Response
+		}
+	}
+	return request, response
+}
+
+var (
+	// The first version, the same as the unversioned routes clients used before versions were introduced.
+	// 'message.post' only returned the id of the message
+	V1 = &Version{
+		Name:      "v1",
+		Successor: "v2",
+		Transforms: map[string]*Transform{
+			"message.post": {
+				Response: model.MessageResponse{},
+				FromResponse: func(response interface{}) interface{} {
+					return &model.MessageResponse{Id: response.(*model.Message).Id}
+				},
+			},
+		},
+	}
+	// The current version, changes to the models land here and get a transform in the older versions
+	V2 = &Version{Name: "v2"}
+
+	// The routes under '/api' without a version, which remain for clients written before versions were introduced.
+	// Shares the transforms of v1
+	Unversioned = &Version{
+		Name:       "unversioned",
+		Successor:  V1.Name,
+		Transforms: V1.Transforms,
+	}
+
+	// The versions served under '/api/{version}', oldest first
+	Versions = []*Version{V1, V2}
+)
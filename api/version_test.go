@@ -0,0 +1,103 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api_test
+
+import (
+	"strings"
+
+	"github.com/howler-chat/api-service/api"
+	"github.com/howler-chat/api-service/codec"
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+)
+
+// The request of an imaginary old version which called the message id 'id'
+type oldGetMessageRequest struct {
+	Id        string `json:"id"`
+	ChannelId string `json:"channelId"`
+}
+
+func (self *oldGetMessageRequest) Validate(ctx context.Context) HttpError {
+	return nil
+}
+
+var _ = Describe("Version", func() {
+	var received *model.GetMessageRequest
+
+	method := &api.Method{
+		Name:     "message.get",
+		Request:  func() api.Request { return &model.GetMessageRequest{} },
+		Response: model.Message{},
+		Handler: func(howler api.HowlerApi, ctx context.Context, request api.Request) (interface{}, HttpError) {
+			received = request.(*model.GetMessageRequest)
+			return &model.Message{Id: received.MessageId, Text: "hello"}, nil
+		},
+	}
+	old := &api.Version{
+		Name: "v0",
+		Transforms: map[string]*api.Transform{
+			"message.get": {
+				Request: func() api.Request { return &oldGetMessageRequest{} },
+				ToRequest: func(request api.Request) api.Request {
+					old := request.(*oldGetMessageRequest)
+					return &model.GetMessageRequest{MessageId: old.Id, ChannelId: old.ChannelId}
+				},
+				FromResponse: func(response interface{}) interface{} {
+					return response.(*model.Message).Text
+				},
+			},
+		},
+	}
+	ctx := api.AddApi(context.Background(), api.NewApi())
+
+	It("should transform the request and response of the version", func() {
+		result, err := old.Call(ctx, method, strings.NewReader(`{"id": "M000000001", "channelId": "C000000001"}`),
+			codec.JSON)
+		Expect(err).To(BeNil())
+		Expect(received.MessageId).To(Equal("M000000001"))
+		Expect(result).To(Equal("hello"))
+
+		request, _ := old.Models(method)
+		Expect(request).To(BeAssignableToTypeOf(&oldGetMessageRequest{}))
+	})
+
+	It("should call the method as is if the version has no transform", func() {
+		result, err := api.V2.Call(ctx, method,
+			strings.NewReader(`{"messageId": "M000000002", "channelId": "C000000001"}`), codec.JSON)
+		Expect(err).To(BeNil())
+		Expect(result.(*model.Message).Id).To(Equal("M000000002"))
+		Expect(api.V2.Deprecation(method.Name)).To(BeNil())
+		Expect(api.Unversioned.Successor).To(Equal("v1"))
+	})
+
+	It("should only return the id of a posted message in v1", func() {
+		post := &api.Method{
+			Name:     "message.post",
+			Request:  func() api.Request { return &model.Message{} },
+			Response: model.Message{},
+			Handler: func(howler api.HowlerApi, ctx context.Context, request api.Request) (interface{}, HttpError) {
+				msg := request.(*model.Message)
+				msg.Id = "M000000003"
+				return msg, nil
+			},
+		}
+		body := `{"channelId": "C000000001", "text": "hello"}`
+
+		result, err := api.V1.Call(ctx, post, strings.NewReader(body), codec.JSON)
+		Expect(err).To(BeNil())
+		Expect(result).To(Equal(&model.MessageResponse{Id: "M000000003"}))
+		_, response := api.V1.Models(post)
+		Expect(response).To(Equal(model.MessageResponse{}))
+
+		result, err = api.V2.Call(ctx, post, strings.NewReader(body), codec.JSON)
+		Expect(err).To(BeNil())
+		Expect(result.(*model.Message).Text).To(Equal("hello"))
+		_, response = api.V2.Models(post)
+		Expect(response).To(Equal(model.Message{}))
+	})
+})
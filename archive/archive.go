@@ -0,0 +1,299 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package archive exports the history of a team to a portable archive, and imports archives written by Howler or
+exported from Slack into any HowlerStore.
+
+An archive is a ZIP file of JSON and JSON lines files
+
+	manifest.json                 The format, version, exported team and counts
+	team.json                     The team, omitted if the store has no record of the team
+	users.jsonl                   One user per line
+	channels.jsonl                One channel per line, conversations list their participants as members
+	messages/<channel-id>.jsonl   The messages of the channel, oldest first
+
+Howler has no threads or reactions. Replies in a Slack thread are imported as messages of the channel and
+reactions are skipped.
+*/
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/howler-chat/api-service/model"
+	"github.com/pkg/errors"
+)
+
+// Identifies a Howler archive in the manifest
+const Format = "howler-archive"
+
+// The version of the archive format written, archives with a newer version can not be imported
+const Version = 1
+
+const (
+	manifestFile = "manifest.json"
+	teamFile     = "team.json"
+	usersFile    = "users.jsonl"
+	channelsFile = "channels.jsonl"
+	messagesDir  = "messages/"
+)
+
+// Describes the archive, written after everything else such that the counts are known. Open() checks the archive
+// has as many users, channels and messages as the manifest says, such that a truncated archive is never imported
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	TeamId    string    `json:"teamId"`
+	CreatedAt time.Time `json:"createdAt"`
+	Users     int       `json:"users"`
+	Channels  int       `json:"channels"`
+	Messages  int       `json:"messages"`
+}
+
+// A Channel in the archive. Howler has no channel model, so channels are described by their messages
+type Channel struct {
+	Id   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Conversations are identified by their members, such that importing one creates the same conversation
+	Conversation bool     `json:"conversation"`
+	Members      []string `json:"members"`
+}
+
+// Writes an archive to the underlying writer, Close() must be called to complete the archive
+type Writer struct {
+	zip      *zip.Writer
+	manifest Manifest
+	channels []Channel
+}
+
+func NewWriter(writer io.Writer, teamId string) *Writer {
+	return &Writer{
+		zip: zip.NewWriter(writer),
+		manifest: Manifest{
+			Format:    Format,
+			Version:   Version,
+			TeamId:    teamId,
+			CreatedAt: time.Now().UTC(),
+		},
+	}
+}
+
+func (self *Writer) WriteTeam(team *model.Team) error {
+	file, err := self.zip.Create(teamFile)
+	if err != nil {
+		return errors.Wrapf(err, "while creating '%s'", teamFile)
+	}
+	return json.NewEncoder(file).Encode(team)
+}
+
+func (self *Writer) WriteUsers(users []model.User) error {
+	file, err := self.zip.Create(usersFile)
+	if err != nil {
+		return errors.Wrapf(err, "while creating '%s'", usersFile)
+	}
+	encoder := json.NewEncoder(file)
+	for i := range users {
+		if err := encoder.Encode(&users[i]); err != nil {
+			return err
+		}
+	}
+	self.manifest.Users += len(users)
+	return nil
+}
+
+// Write the messages of the channel, the channel itself is written by Close()
+func (self *Writer) WriteChannel(channel Channel, messages []model.Message) error {
+	name := messagesDir + channel.Id + ".jsonl"
+	file, err := self.zip.Create(name)
+	if err != nil {
+		return errors.Wrapf(err, "while creating '%s'", name)
+	}
+	encoder := json.NewEncoder(file)
+	for i := range messages {
+		if err := encoder.Encode(&messages[i]); err != nil {
+			return err
+		}
+	}
+	self.channels = append(self.channels, channel)
+	self.manifest.Channels++
+	self.manifest.Messages += len(messages)
+	return nil
+}
+
+// Write the channels and the manifest, and complete the archive. Does not close the underlying writer
+func (self *Writer) Close() error {
+	file, err := self.zip.Create(channelsFile)
+	if err != nil {
+		return errors.Wrapf(err, "while creating '%s'", channelsFile)
+	}
+	encoder := json.NewEncoder(file)
+	for i := range self.channels {
+		if err := encoder.Encode(&self.channels[i]); err != nil {
+			return err
+		}
+	}
+
+	if file, err = self.zip.Create(manifestFile); err != nil {
+		return errors.Wrapf(err, "while creating '%s'", manifestFile)
+	}
+	if err := json.NewEncoder(file).Encode(&self.manifest); err != nil {
+		return err
+	}
+	return self.zip.Close()
+}
+
+// An archive being imported
+type Source interface {
+	Users() ([]model.User, error)
+	Channels() ([]Channel, error)
+	// Calls `fn` with each message of the channel, oldest first
+	Messages(channel Channel, fn func(msg *model.Message) error) error
+}
+
+// Returns the source for a Howler or Slack archive
+func Open(reader *zip.Reader) (Source, error) {
+	files := map[string]*zip.File{}
+	for _, file := range reader.File {
+		files[file.Name] = file
+	}
+
+	if _, exists := files[manifestFile]; exists {
+		return openHowler(files)
+	}
+	if _, exists := files[slackUsersFile]; exists {
+		return openSlack(reader.File)
+	}
+	return nil, errors.Errorf("not a Howler or Slack archive; expected '%s' or '%s'", manifestFile, slackUsersFile)
+}
+
+// Reads an archive written by Writer
+type howlerSource struct {
+	files    map[string]*zip.File
+	manifest Manifest
+}
+
+func openHowler(files map[string]*zip.File) (*howlerSource, error) {
+	source := &howlerSource{files: files}
+	if err := decodeFile(files[manifestFile], &source.manifest); err != nil {
+		return nil, err
+	}
+	if source.manifest.Format != Format {
+		return nil, errors.Errorf("unknown archive format '%s'", source.manifest.Format)
+	}
+	if source.manifest.Version > Version {
+		return nil, errors.Errorf("archive version '%d' is newer than the supported version '%d'",
+			source.manifest.Version, Version)
+	}
+	if err := source.verify(); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// Returns an error if the archive does not have the users, channels and messages counted in the manifest
+func (self *howlerSource) verify() error {
+	users, err := self.Users()
+	if err != nil {
+		return err
+	}
+	channels, err := self.Channels()
+	if err != nil {
+		return err
+	}
+	var messages int
+	for _, channel := range channels {
+		err := decodeLines(self.files[messagesDir+channel.Id+".jsonl"], func() interface{} { return &model.Message{} },
+			func(value interface{}) error {
+				messages++
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+	}
+
+	counts := []struct {
+		name               string
+		manifest, archived int
+	}{
+		{"users", self.manifest.Users, len(users)},
+		{"channels", self.manifest.Channels, len(channels)},
+		{"messages", self.manifest.Messages, messages},
+	}
+	for _, count := range counts {
+		if count.manifest != count.archived {
+			return errors.Errorf("archive is incomplete; the manifest lists %d %s but the archive has %d",
+				count.manifest, count.name, count.archived)
+		}
+	}
+	return nil
+}
+
+func (self *howlerSource) Users() ([]model.User, error) {
+	var users []model.User
+	err := decodeLines(self.files[usersFile], func() interface{} { return &model.User{} },
+		func(value interface{}) error {
+			users = append(users, *value.(*model.User))
+			return nil
+		})
+	return users, err
+}
+
+func (self *howlerSource) Channels() ([]Channel, error) {
+	var channels []Channel
+	err := decodeLines(self.files[channelsFile], func() interface{} { return &Channel{} },
+		func(value interface{}) error {
+			channels = append(channels, *value.(*Channel))
+			return nil
+		})
+	return channels, err
+}
+
+func (self *howlerSource) Messages(channel Channel, fn func(msg *model.Message) error) error {
+	return decodeLines(self.files[messagesDir+channel.Id+".jsonl"], func() interface{} { return &model.Message{} },
+		func(value interface{}) error {
+			return fn(value.(*model.Message))
+		})
+}
+
+func decodeFile(file *zip.File, value interface{}) error {
+	reader, err := file.Open()
+	if err != nil {
+		return errors.Wrapf(err, "while opening '%s'", file.Name)
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(value); err != nil {
+		return errors.Wrapf(err, "while decoding '%s'", file.Name)
+	}
+	return nil
+}
+
+// Decodes each line of the JSON lines file into a new value and calls `fn` with it. A missing file has no lines
+func decodeLines(file *zip.File, newValue func() interface{}, fn func(value interface{}) error) error {
+	if file == nil {
+		return nil
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return errors.Wrapf(err, "while opening '%s'", file.Name)
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	for decoder.More() {
+		value := newValue()
+		if err := decoder.Decode(value); err != nil {
+			return errors.Wrapf(err, "while decoding '%s'", file.Name)
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
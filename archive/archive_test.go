@@ -0,0 +1,213 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package archive_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/howler-chat/api-service/archive"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/store/sql"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+)
+
+func TestArchive(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Archive Suite")
+}
+
+func newBackend() store.Backend {
+	dsn, err := url.Parse("sqlite:///:memory:")
+	Expect(err).To(BeNil())
+	backend, err := sql.NewBackend("test", dsn)
+	Expect(err).To(BeNil())
+	backend.Start()
+	return backend
+}
+
+// Fails every ImportMessage() after the first `remaining` calls, as if the store became unavailable
+type failingStore struct {
+	store.HowlerStore
+	remaining int
+}
+
+func (self *failingStore) ImportMessage(ctx context.Context, msg *model.Message) error {
+	if self.remaining == 0 {
+		return store.ErrUnavailable
+	}
+	self.remaining--
+	return self.HowlerStore.ImportMessage(ctx, msg)
+}
+
+// Returns a reader for the files given, IE: 'users.json' => '[...]'
+func newZip(files map[string]string) *zip.Reader {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		file, err := writer.Create(name)
+		Expect(err).To(BeNil())
+		_, err = file.Write([]byte(content))
+		Expect(err).To(BeNil())
+	}
+	Expect(writer.Close()).To(BeNil())
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	Expect(err).To(BeNil())
+	return reader
+}
+
+var _ = Describe("Archive", func() {
+	var ctx context.Context
+	var backend store.Backend
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		backend = newBackend()
+	})
+
+	AfterEach(func() {
+		backend.Stop()
+	})
+
+	Describe("Export()", func() {
+		It("should round trip the team through Import() with new ids", func() {
+			alice := model.User{TeamId: "TEAM000001", Handle: "alice", DisplayName: "Alice"}
+			bob := model.User{TeamId: "TEAM000001", Handle: "bob", DisplayName: "Bob"}
+			Expect(backend.InsertUser(ctx, &alice)).To(BeNil())
+			Expect(backend.InsertUser(ctx, &bob)).To(BeNil())
+
+			participants := model.Participants([]string{alice.Id, bob.Id})
+			conversation := &model.Conversation{Id: model.ConversationId(participants), Participants: participants}
+			_, err := backend.OpenConversation(ctx, conversation)
+			Expect(err).To(BeNil())
+
+			createdAt := time.Date(2016, 10, 19, 12, 0, 0, 0, time.UTC)
+			Expect(backend.ImportMessage(ctx, &model.Message{ChannelId: conversation.Id, UserId: alice.Id,
+				Text: "Hello Bob", CreatedAt: createdAt})).To(BeNil())
+			Expect(backend.InsertMessage(ctx, &model.Message{ChannelId: "CHAN000001", UserId: bob.Id,
+				Text: "Hello everyone"})).To(BeNil())
+
+			var buf bytes.Buffer
+			writer := archive.NewWriter(&buf, "TEAM000001")
+			progress := &archive.Progress{}
+			// The channel Bob posted to is part of the team without being listed
+			Expect(archive.Export(ctx, backend, archive.ExportRequest{
+				TeamId: "TEAM000001",
+				Team:   true,
+			}, writer, progress)).To(BeNil())
+			Expect(writer.Close()).To(BeNil())
+			Expect(progress.Counts()).To(Equal(archive.Counts{Users: 2, Channels: 2, ChannelsDone: 2, Messages: 2}))
+
+			reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			Expect(err).To(BeNil())
+			source, err := archive.Open(reader)
+			Expect(err).To(BeNil())
+
+			result, err := archive.Import(ctx, backend, source, "TEAM000002", nil, nil)
+			Expect(err).To(BeNil())
+			Expect(result.Users[alice.Id]).NotTo(Equal(alice.Id))
+
+			users, err := backend.ListUser(ctx, &model.ListUserRequest{TeamId: "TEAM000002", Limit: 10})
+			Expect(err).To(BeNil())
+			Expect(len(users)).To(Equal(2))
+
+			// The conversation is identified by the new ids of its participants
+			imported := model.Participants([]string{result.Users[alice.Id], result.Users[bob.Id]})
+			Expect(result.Channels[conversation.Id]).To(Equal(model.ConversationId(imported)))
+
+			messages, err := backend.ListMessage(ctx, &model.ListMessageRequest{
+				ChannelId: result.Channels[conversation.Id]})
+			Expect(err).To(BeNil())
+			Expect(len(messages)).To(Equal(1))
+			Expect(messages[0].UserId).To(Equal(result.Users[alice.Id]))
+			Expect(messages[0].CreatedAt.Equal(createdAt)).To(BeTrue())
+		})
+	})
+
+	Describe("Open()", func() {
+		It("should import a Slack export", func() {
+			reader := newZip(map[string]string{
+				"users.json":    `[{"id": "U1", "name": "alice.smith"}, {"id": "U2", "name": "bob"}]`,
+				"channels.json": `[{"id": "C1", "name": "general", "members": ["U1", "U2"]}]`,
+				"general/2016-10-19.json": `[
+					{"type": "message", "subtype": "channel_join", "user": "U2", "text": "<@U2> has joined",
+						"ts": "1476878400.000001"},
+					{"type": "message", "user": "U1", "text": "Hello", "ts": "1476878401.000002"},
+					{"type": "message", "user": "U2", "text": "A reply", "ts": "1476878402.000003",
+						"thread_ts": "1476878401.000002"}
+				]`,
+			})
+			source, err := archive.Open(reader)
+			Expect(err).To(BeNil())
+
+			result, err := archive.Import(ctx, backend, source, "TEAM000001", nil, nil)
+			Expect(err).To(BeNil())
+
+			messages, err := backend.ListMessage(ctx, &model.ListMessageRequest{ChannelId: result.Channels["C1"]})
+			Expect(err).To(BeNil())
+			Expect(len(messages)).To(Equal(2))
+			Expect(messages[0].Text).To(Equal("Hello"))
+			Expect(messages[0].UserId).To(Equal(result.Users["U1"]))
+			Expect(messages[0].CreatedAt.Equal(time.Unix(1476878401, 2000).UTC())).To(BeTrue())
+			Expect(messages[1].Text).To(Equal("A reply"))
+
+			user, err := backend.GetUser(ctx, result.Users["U1"])
+			Expect(err).To(BeNil())
+			Expect(user.Handle).To(Equal("alice.smith"))
+		})
+
+		It("should reject an archive with fewer messages than the manifest", func() {
+			_, err := archive.Open(newZip(map[string]string{
+				"manifest.json":             `{"format": "howler-archive", "version": 1, "channels": 1, "messages": 2}`,
+				"channels.jsonl":            `{"id": "CHAN000001", "members": []}`,
+				"messages/CHAN000001.jsonl": `{"channelId": "CHAN000001", "userId": "USER000001", "text": "one"}`,
+			}))
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("lists 2 messages but the archive has 1"))
+		})
+
+		It("should resume a failed import without importing a message twice", func() {
+			source, err := archive.Open(newZip(map[string]string{
+				"users.json":    `[{"id": "U1", "name": "alice"}]`,
+				"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+				"general/2016-10-19.json": `[
+					{"type": "message", "user": "U1", "text": "one", "ts": "1476878401.000001"},
+					{"type": "message", "user": "U1", "text": "two", "ts": "1476878402.000002"},
+					{"type": "message", "user": "U1", "text": "three", "ts": "1476878403.000003"}
+				]`,
+			}))
+			Expect(err).To(BeNil())
+
+			result, err := archive.Import(ctx, &failingStore{HowlerStore: backend, remaining: 1}, source,
+				"TEAM000001", nil, nil)
+			Expect(store.Cause(err)).To(Equal(store.ErrUnavailable))
+			Expect(result.Messages["C1"]).To(Equal(1))
+
+			result, err = archive.Import(ctx, backend, source, "TEAM000001", result, nil)
+			Expect(err).To(BeNil())
+
+			messages, err := backend.ListMessage(ctx, &model.ListMessageRequest{ChannelId: result.Channels["C1"]})
+			Expect(err).To(BeNil())
+			Expect(len(messages)).To(Equal(3))
+			Expect(messages[2].Text).To(Equal("three"))
+
+			users, err := backend.ListUser(ctx, &model.ListUserRequest{TeamId: "TEAM000001"})
+			Expect(err).To(BeNil())
+			Expect(len(users)).To(Equal(1))
+		})
+
+		It("should reject an archive that is neither Howler or Slack", func() {
+			_, err := archive.Open(newZip(map[string]string{"readme.txt": "hello"}))
+			Expect(err).NotTo(BeNil())
+		})
+	})
+})
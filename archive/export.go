@@ -0,0 +1,239 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"sort"
+
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/validate"
+	"golang.org/x/net/context"
+)
+
+// Describes what to export
+type ExportRequest struct {
+	TeamId     string   `json:"teamId"`
+	ChannelIds []string `json:"channelIds"`
+	// Export the team, its users, their conversations and every channel they posted to in addition to the
+	// channels listed
+	Team bool `json:"team"`
+}
+
+// Export the request from the store to the archive, the caller must Close() the writer
+func Export(ctx context.Context, dbStore store.HowlerStore, request ExportRequest, writer *Writer,
+	progress *Progress) error {
+	var users []model.User
+	var channels []Channel
+	var err error
+
+	if request.Team {
+		if users, channels, err = exportTeam(ctx, dbStore, request.TeamId, writer); err != nil {
+			return err
+		}
+	}
+
+	// Channels listed that the team export did not include
+	seen := map[string]bool{}
+	for _, channel := range channels {
+		seen[channel.Id] = true
+	}
+	for _, channelId := range request.ChannelIds {
+		if seen[channelId] {
+			continue
+		}
+		seen[channelId] = true
+		channel, err := exportChannel(ctx, dbStore, channelId)
+		if err != nil {
+			return err
+		}
+		channels = append(channels, channel)
+	}
+
+	// Without the team, export the members of the channels
+	if !request.Team {
+		if users, err = exportMembers(ctx, dbStore, channels); err != nil {
+			return err
+		}
+	}
+	if err := writer.WriteUsers(users); err != nil {
+		return err
+	}
+	progress.update(func(counts *Counts) {
+		counts.Users = len(users)
+		counts.Channels = len(channels)
+	})
+
+	for _, channel := range channels {
+		messages, err := dbStore.ListMessage(ctx, &model.ListMessageRequest{ChannelId: channel.Id})
+		if err != nil {
+			return err
+		}
+		if err := writer.WriteChannel(channel, messages); err != nil {
+			return err
+		}
+		progress.update(func(counts *Counts) {
+			counts.ChannelsDone++
+			counts.Messages += len(messages)
+		})
+	}
+	return nil
+}
+
+// Write the team and return its users, their conversations and the channels they posted to
+func exportTeam(ctx context.Context, dbStore store.HowlerStore, teamId string,
+	writer *Writer) ([]model.User, []Channel, error) {
+	team, err := dbStore.GetTeam(ctx, teamId)
+	if err != nil && store.Cause(err) != store.ErrNotFound {
+		return nil, nil, err
+	}
+	if team != nil {
+		if err := writer.WriteTeam(team); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	users, err := listUsers(ctx, dbStore, teamId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Conversations are shared by their participants, only export each once
+	var channels []Channel
+	seen := map[string]bool{}
+	for _, user := range users {
+		conversations, err := listConversations(ctx, dbStore, user.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, conversation := range conversations {
+			if seen[conversation.Id] {
+				continue
+			}
+			seen[conversation.Id] = true
+			channels = append(channels, Channel{
+				Id:           conversation.Id,
+				Conversation: true,
+				Members:      conversation.Participants,
+			})
+		}
+	}
+
+	// Channels are not owned by a team, the channels of the team are those its users posted to
+	for start := 0; start < len(users); start += validate.MaxLimit {
+		end := start + validate.MaxLimit
+		if end > len(users) {
+			end = len(users)
+		}
+		userIds := make([]string, 0, end-start)
+		for _, user := range users[start:end] {
+			userIds = append(userIds, user.Id)
+		}
+
+		channelIds, err := dbStore.ListChannelIds(ctx, userIds)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, channelId := range channelIds {
+			if seen[channelId] {
+				continue
+			}
+			seen[channelId] = true
+			channel, err := exportChannel(ctx, dbStore, channelId)
+			if err != nil {
+				return nil, nil, err
+			}
+			channels = append(channels, channel)
+		}
+	}
+	return users, channels, nil
+}
+
+// Returns every user of the team including deactivated users, a page at a time
+func listUsers(ctx context.Context, dbStore store.HowlerStore, teamId string) ([]model.User, error) {
+	var users []model.User
+	for {
+		page, err := dbStore.ListUser(ctx, &model.ListUserRequest{
+			TeamId:             teamId,
+			Limit:              validate.MaxLimit,
+			Offset:             len(users),
+			IncludeDeactivated: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, page...)
+		if len(page) < validate.MaxLimit {
+			return users, nil
+		}
+	}
+}
+
+// Returns every conversation the user participates in, a page at a time
+func listConversations(ctx context.Context, dbStore store.HowlerStore, userId string) ([]model.Conversation, error) {
+	var conversations []model.Conversation
+	for {
+		page, err := dbStore.ListConversation(ctx, &model.ListConversationRequest{
+			UserId: userId,
+			Limit:  validate.MaxLimit,
+			Offset: len(conversations),
+		})
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, page...)
+		if len(page) < validate.MaxLimit {
+			return conversations, nil
+		}
+	}
+}
+
+// Returns the channel, the members of a channel that is not a conversation are the users who posted to it
+func exportChannel(ctx context.Context, dbStore store.HowlerStore, channelId string) (Channel, error) {
+	conversation, err := dbStore.GetConversation(ctx, channelId)
+	if err == nil {
+		return Channel{Id: channelId, Conversation: true, Members: conversation.Participants}, nil
+	} else if store.Cause(err) != store.ErrNotFound {
+		return Channel{}, err
+	}
+
+	messages, err := dbStore.ListMessage(ctx, &model.ListMessageRequest{ChannelId: channelId})
+	if err != nil {
+		return Channel{}, err
+	}
+	members := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		members = append(members, msg.UserId)
+	}
+	return Channel{Id: channelId, Members: model.Participants(members)}, nil
+}
+
+// Returns the users who are members of the channels, users the store doesn't know are skipped
+func exportMembers(ctx context.Context, dbStore store.HowlerStore, channels []Channel) ([]model.User, error) {
+	var userIds []string
+	for _, channel := range channels {
+		userIds = append(userIds, channel.Members...)
+	}
+	userIds = model.Participants(userIds)
+
+	users := make([]model.User, 0, len(userIds))
+	for _, userId := range userIds {
+		user, err := dbStore.GetUser(ctx, userId)
+		if store.Cause(err) == store.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	sort.Sort(byHandle(users))
+	return users, nil
+}
+
+type byHandle []model.User
+
+func (self byHandle) Len() int           { return len(self) }
+func (self byHandle) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+func (self byHandle) Less(i, j int) bool { return self[i].HandleKey() < self[j].HandleKey() }
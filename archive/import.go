@@ -0,0 +1,146 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"golang.org/x/net/context"
+)
+
+// The ids assigned to the users and channels of the archive by the import, keyed by their id in the archive
+type Result struct {
+	Users    map[string]string `json:"users"`
+	Channels map[string]string `json:"channels"`
+	// The number of messages imported into each channel, keyed by the id of the channel in the archive
+	Messages map[string]int `json:"messages"`
+}
+
+// Import the archive into the team. Every object is given a new id, users with a handle already taken on the team
+// are merged with the existing user. Messages keep the time they were created, and messages by users not in the
+// archive (IE: Slack bots) are attributed to a new id per author.
+//
+// Returns what was imported even if the import fails. Passing that result back as `previous` resumes the import
+// where it stopped, without importing any message twice. `previous` is nil for a new import
+func Import(ctx context.Context, dbStore store.HowlerStore, source Source, teamId string, previous *Result,
+	progress *Progress) (*Result, error) {
+	result := previous
+	if result == nil {
+		result = &Result{Users: map[string]string{}, Channels: map[string]string{}, Messages: map[string]int{}}
+	}
+
+	users, err := source.Users()
+	if err != nil {
+		return result, err
+	}
+	channels, err := source.Channels()
+	if err != nil {
+		return result, err
+	}
+	progress.update(func(counts *Counts) {
+		counts.Users = len(users)
+		counts.Channels = len(channels)
+	})
+
+	if err := importUsers(ctx, dbStore, users, teamId, result); err != nil {
+		return result, err
+	}
+
+	mapUser := func(userId string) string {
+		if _, exists := result.Users[userId]; !exists {
+			result.Users[userId] = "U" + utils.NewId()[1:]
+		}
+		return result.Users[userId]
+	}
+
+	for _, channel := range channels {
+		channelId, exists := result.Channels[channel.Id]
+		if !exists {
+			if channelId, err = importChannel(ctx, dbStore, channel, mapUser); err != nil {
+				return result, err
+			}
+			result.Channels[channel.Id] = channelId
+		}
+
+		// Messages are imported in order, so those already imported are the first of the channel
+		skip := result.Messages[channel.Id]
+		err = source.Messages(channel, func(msg *model.Message) error {
+			if skip > 0 {
+				skip--
+				progress.update(func(counts *Counts) { counts.Messages++ })
+				return nil
+			}
+			msg.Id = ""
+			msg.ChannelId = channelId
+			msg.UserId = mapUser(msg.UserId)
+			if err := dbStore.ImportMessage(ctx, msg); err != nil {
+				return err
+			}
+			result.Messages[channel.Id]++
+			progress.update(func(counts *Counts) { counts.Messages++ })
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		progress.update(func(counts *Counts) { counts.ChannelsDone++ })
+	}
+	return result, nil
+}
+
+// Insert the users of the archive, or map them to the user of the team with the same handle
+func importUsers(ctx context.Context, dbStore store.HowlerStore, users []model.User, teamId string,
+	result *Result) error {
+	existing, err := listUsers(ctx, dbStore, teamId)
+	if err != nil {
+		return err
+	}
+	handles := make(map[string]string, len(existing))
+	for _, user := range existing {
+		handles[user.HandleKey()] = user.Id
+	}
+
+	for _, user := range users {
+		archiveId := user.Id
+		if _, imported := result.Users[archiveId]; imported {
+			continue
+		}
+		if userId, exists := handles[user.HandleKey()]; exists {
+			result.Users[archiveId] = userId
+			continue
+		}
+
+		user.Id, user.TeamId = "", teamId
+		if err := dbStore.InsertUser(ctx, &user); err != nil {
+			return err
+		}
+		handles[user.HandleKey()] = user.Id
+		result.Users[archiveId] = user.Id
+	}
+	return nil
+}
+
+// Create the channel and return its new id. Conversations are opened between the imported members, other
+// channels exist as soon as a message is posted to them
+func importChannel(ctx context.Context, dbStore store.HowlerStore, channel Channel,
+	mapUser func(string) string) (string, error) {
+	members := make([]string, 0, len(channel.Members))
+	for _, member := range channel.Members {
+		members = append(members, mapUser(member))
+	}
+	participants := model.Participants(members)
+
+	// A conversation with yourself or more participants than we allow becomes a channel
+	if !channel.Conversation || len(participants) < 2 || len(participants) > model.MaxParticipants {
+		return "C" + utils.NewId()[1:], nil
+	}
+
+	conversation := &model.Conversation{Id: model.ConversationId(participants), Participants: participants}
+	if _, err := dbStore.OpenConversation(ctx, conversation); err != nil {
+		return "", err
+	}
+	return conversation.Id, nil
+}
@@ -0,0 +1,305 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// The kinds of job
+const (
+	JobTeamExport    = "team.export"
+	JobChannelExport = "channel.export"
+	JobImport        = "import"
+)
+
+// The states of a job
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// The work done by an export or import so far
+type Counts struct {
+	Users    int `json:"users"`
+	Channels int `json:"channels"`
+	// Channels whose messages have all been exported or imported
+	ChannelsDone int `json:"channelsDone"`
+	Messages     int `json:"messages"`
+}
+
+// Counts the work done by a job, such that the progress can be reported while the job runs. A nil Progress
+// counts nothing
+type Progress struct {
+	mutex  sync.Mutex
+	counts Counts
+}
+
+func (self *Progress) Counts() Counts {
+	if self == nil {
+		return Counts{}
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.counts
+}
+
+func (self *Progress) update(fn func(counts *Counts)) {
+	if self == nil {
+		return
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	fn(&self.counts)
+}
+
+// An export or import running in the background
+type Job struct {
+	Id        string
+	Kind      string
+	TeamId    string
+	StartedAt time.Time
+	Progress  *Progress
+
+	mutex      sync.Mutex
+	state      string
+	err        error
+	finishedAt time.Time
+	path       string
+	result     *Result
+	// The uploaded archive of an import, kept after a failure such that the import can be resumed
+	upload string
+}
+
+// A snapshot of the job, as reported to operators
+type JobStatus struct {
+	Id         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	TeamId     string     `json:"teamId"`
+	State      string     `json:"state"`
+	Error      string     `json:"error,omitempty"`
+	Progress   Counts     `json:"progress"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// The ids assigned by an import, or by a failed import so far
+	Result *Result `json:"result,omitempty"`
+}
+
+func (self *Job) Status() JobStatus {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	status := JobStatus{
+		Id:        self.Id,
+		Kind:      self.Kind,
+		TeamId:    self.TeamId,
+		State:     self.state,
+		Progress:  self.Progress.Counts(),
+		StartedAt: self.StartedAt,
+		Result:    self.result,
+	}
+	if self.err != nil {
+		status.Error = self.err.Error()
+	}
+	if !self.finishedAt.IsZero() {
+		finishedAt := self.finishedAt
+		status.FinishedAt = &finishedAt
+	}
+	return status
+}
+
+// Returns the archive written by an export, or "" if the job is not a finished export
+func (self *Job) Archive() string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.Kind == JobImport || self.state != JobDone {
+		return ""
+	}
+	return self.path
+}
+
+func (self *Job) finish(result *Result, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.finishedAt = time.Now().UTC()
+	self.result = result
+	self.state = JobDone
+	if err != nil {
+		self.state, self.err = JobFailed, err
+	}
+
+	entry := log.WithFields(log.Fields{"type": "archive", "job": self.Id, "kind": self.Kind, "teamId": self.TeamId})
+	if err != nil {
+		entry.Errorf("Archive job failed - %s", err.Error())
+		return
+	}
+	entry.Infof("Archive job finished in %s", self.finishedAt.Sub(self.StartedAt))
+}
+
+// Runs exports and imports in the background and remembers them until the service restarts. Exports are written
+// to the directory given
+type Jobs struct {
+	mutex sync.Mutex
+	jobs  map[string]*Job
+	dir   string
+}
+
+func NewJobs(dir string) *Jobs {
+	return &Jobs{jobs: map[string]*Job{}, dir: dir}
+}
+
+// The directory exports are written to
+func (self *Jobs) Dir() string {
+	return self.dir
+}
+
+func (self *Jobs) newJob(kind, teamId string) *Job {
+	job := &Job{
+		Id:        utils.NewId(),
+		Kind:      kind,
+		TeamId:    teamId,
+		StartedAt: time.Now().UTC(),
+		Progress:  &Progress{},
+		state:     JobRunning,
+	}
+	self.mutex.Lock()
+	self.jobs[job.Id] = job
+	self.mutex.Unlock()
+	return job
+}
+
+// Start exporting to '<dir>/<job-id>.zip'
+func (self *Jobs) Export(dbStore store.HowlerStore, request ExportRequest) (*Job, error) {
+	kind := JobChannelExport
+	if request.Team {
+		kind = JobTeamExport
+	}
+	job := self.newJob(kind, request.TeamId)
+	job.path = filepath.Join(self.dir, job.Id+".zip")
+
+	file, err := os.OpenFile(job.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		err = errors.Wrap(err, "while creating the archive")
+		job.finish(nil, err)
+		return nil, err
+	}
+
+	go func() {
+		writer := NewWriter(file, request.TeamId)
+		err := Export(context.Background(), dbStore, request, writer, job.Progress)
+		if err == nil {
+			err = writer.Close()
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(job.path)
+		}
+		job.finish(nil, err)
+	}()
+	return job, nil
+}
+
+// Start importing the archive at `path` into the team. The archive is removed once the import is done, if the
+// import fails the archive is kept until the import is resumed with Resume() or the service restarts
+func (self *Jobs) Import(dbStore store.HowlerStore, path, teamId string) (*Job, error) {
+	reader, source, err := openArchive(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	job := self.newJob(JobImport, teamId)
+	job.upload = path
+	go job.runImport(dbStore, reader, source, nil)
+	return job, nil
+}
+
+// Resume a failed import where it stopped, such as after the store was unavailable
+func (self *Jobs) Resume(dbStore store.HowlerStore, job *Job) error {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+
+	if job.Kind != JobImport || job.state != JobFailed {
+		return errors.Errorf("job '%s' is not a failed import", job.Id)
+	}
+	reader, source, err := openArchive(job.upload)
+	if err != nil {
+		return err
+	}
+
+	// The import changes the result as it runs, so it is not reported until the import is done
+	previous := job.result
+	job.state, job.err, job.result, job.finishedAt = JobRunning, nil, nil, time.Time{}
+	job.Progress = &Progress{}
+	go job.runImport(dbStore, reader, source, previous)
+	return nil
+}
+
+func (self *Job) runImport(dbStore store.HowlerStore, reader *zip.ReadCloser, source Source, previous *Result) {
+	result, err := Import(context.Background(), dbStore, source, self.TeamId, previous, self.Progress)
+	reader.Close()
+	if err == nil {
+		os.Remove(self.upload)
+	}
+	self.finish(result, err)
+}
+
+func openArchive(path string) (*zip.ReadCloser, Source, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "while opening the archive")
+	}
+	source, err := Open(&reader.Reader)
+	if err != nil {
+		reader.Close()
+		return nil, nil, err
+	}
+	return reader, source, nil
+}
+
+// Returns the job, or nil if no job has the id
+func (self *Jobs) Get(id string) *Job {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.jobs[id]
+}
+
+// Returns the status of every job, most recent first
+func (self *Jobs) List() []JobStatus {
+	self.mutex.Lock()
+	jobs := make([]*Job, 0, len(self.jobs))
+	for _, job := range self.jobs {
+		jobs = append(jobs, job)
+	}
+	self.mutex.Unlock()
+
+	result := make([]JobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job.Status())
+	}
+	sort.Sort(byStartedAt(result))
+	return result
+}
+
+type byStartedAt []JobStatus
+
+func (self byStartedAt) Len() int           { return len(self) }
+func (self byStartedAt) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+func (self byStartedAt) Less(i, j int) bool { return self[i].StartedAt.After(self[j].StartedAt) }
@@ -0,0 +1,226 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"archive/zip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/validate"
+	"github.com/pkg/errors"
+)
+
+// The files of a Slack export, only 'users.json' is required
+const (
+	slackUsersFile    = "users.json"
+	slackChannelsFile = "channels.json"
+	slackGroupsFile   = "groups.json"
+	slackDMsFile      = "dms.json"
+	slackMPIMsFile    = "mpims.json"
+)
+
+// Subtypes of Slack messages that describe an event rather than something a user said
+var slackEvents = map[string]bool{
+	"channel_join":    true,
+	"channel_leave":   true,
+	"channel_topic":   true,
+	"channel_purpose": true,
+	"channel_name":    true,
+	"group_join":      true,
+	"group_leave":     true,
+	"group_topic":     true,
+	"group_purpose":   true,
+	"group_name":      true,
+}
+
+type slackUser struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"`
+	Tz      string `json:"tz"`
+	Profile struct {
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+		Image72     string `json:"image_72"`
+	} `json:"profile"`
+}
+
+type slackChannel struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+type slackMessage struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	User    string `json:"user"`
+	Text    string `json:"text"`
+	Ts      string `json:"ts"`
+}
+
+// Reads the export Slack provides to workspace admins. The messages of each channel are in a directory named after
+// the channel (or the id of a direct message) with a file of messages per day, IE: 'general/2016-10-19.json'
+type slackSource struct {
+	files map[string]*zip.File
+	// The files of messages by channel id, in the order the days occurred
+	days     map[string][]*zip.File
+	channels []Channel
+}
+
+func openSlack(files []*zip.File) (*slackSource, error) {
+	source := &slackSource{files: map[string]*zip.File{}, days: map[string][]*zip.File{}}
+	byDir := map[string][]*zip.File{}
+	for _, file := range files {
+		source.files[file.Name] = file
+		if slash := strings.LastIndex(file.Name, "/"); slash != -1 && strings.HasSuffix(file.Name, ".json") {
+			byDir[file.Name[:slash]] = append(byDir[file.Name[:slash]], file)
+		}
+	}
+
+	// Direct messages are stored in a directory named after their id, everything else by name
+	groups := []struct {
+		name         string
+		conversation bool
+		byId         bool
+	}{
+		{slackChannelsFile, false, false},
+		{slackGroupsFile, false, false},
+		{slackDMsFile, true, true},
+		{slackMPIMsFile, true, false},
+	}
+	for _, group := range groups {
+		file, exists := source.files[group.name]
+		if !exists {
+			continue
+		}
+		var channels []slackChannel
+		if err := decodeFile(file, &channels); err != nil {
+			return nil, err
+		}
+
+		for _, channel := range channels {
+			dir := channel.Name
+			if group.byId {
+				dir = channel.Id
+			}
+			days := byDir[dir]
+			sort.Sort(byName(days))
+			source.days[channel.Id] = days
+			source.channels = append(source.channels, Channel{
+				Id:           channel.Id,
+				Name:         channel.Name,
+				Conversation: group.conversation,
+				Members:      channel.Members,
+			})
+		}
+	}
+	return source, nil
+}
+
+func (self *slackSource) Users() ([]model.User, error) {
+	var slackUsers []slackUser
+	if err := decodeFile(self.files[slackUsersFile], &slackUsers); err != nil {
+		return nil, err
+	}
+
+	users := make([]model.User, 0, len(slackUsers))
+	for _, slack := range slackUsers {
+		user := model.User{
+			Id:          slack.Id,
+			Handle:      slackHandle(slack.Name, slack.Id),
+			DisplayName: truncate(slack.Profile.DisplayName, 80),
+			Deactivated: slack.Deleted,
+		}
+		if user.DisplayName == "" {
+			user.DisplayName = truncate(slack.Profile.RealName, 80)
+		}
+		if validate.IsAvatarUrl(slack.Profile.Image72) == nil {
+			user.AvatarUrl = slack.Profile.Image72
+		}
+		if validate.IsTimezone(slack.Tz) == nil {
+			user.Timezone = slack.Tz
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (self *slackSource) Channels() ([]Channel, error) {
+	return self.channels, nil
+}
+
+func (self *slackSource) Messages(channel Channel, fn func(msg *model.Message) error) error {
+	for _, day := range self.days[channel.Id] {
+		var messages []slackMessage
+		if err := decodeFile(day, &messages); err != nil {
+			return err
+		}
+
+		for _, slack := range messages {
+			if slack.Type != "message" || slackEvents[slack.Subtype] || strings.TrimSpace(slack.Text) == "" {
+				continue
+			}
+			createdAt, err := parseSlackTs(slack.Ts)
+			if err != nil {
+				return errors.Wrapf(err, "while decoding '%s'", day.Name)
+			}
+			if err := fn(&model.Message{ChannelId: channel.Id, UserId: slack.User, Text: slack.Text,
+				CreatedAt: createdAt}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Slack timestamps are seconds since the epoch with microseconds after the dot, IE: '1476915322.000002'
+func parseSlackTs(ts string) (time.Time, error) {
+	parts := strings.SplitN(ts, ".", 2)
+	seconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid message timestamp '%s'", ts)
+	}
+	var micros int64
+	if len(parts) == 2 {
+		fraction := (parts[1] + "000000")[:6]
+		if micros, err = strconv.ParseInt(fraction, 10, 64); err != nil {
+			return time.Time{}, errors.Errorf("invalid message timestamp '%s'", ts)
+		}
+	}
+	return time.Unix(seconds, micros*int64(time.Microsecond)).UTC(), nil
+}
+
+var invalidHandle = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// Slack names allow characters our handles don't, replace them such that the handle passes validation
+func slackHandle(name, id string) string {
+	handle := strings.TrimLeft(invalidHandle.ReplaceAllString(name, "_"), "._-")
+	if handle == "" {
+		handle = strings.ToLower(id)
+	}
+	return truncate(handle, 21)
+}
+
+// Truncate to at most `length` characters
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return text
+}
+
+// Sorts the files of a channel by day
+type byName []*zip.File
+
+func (self byName) Len() int           { return len(self) }
+func (self byName) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+func (self byName) Less(i, j int) bool { return self[i].Name < self[j].Name }
@@ -0,0 +1,171 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package audit records who changed what and when. Events are written to the store of the team making the change and,
+if configured, appended to a json lines file which can be shipped to write once storage.
+*/
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/howler-chat/api-service/auth"
+	"github.com/howler-chat/api-service/metrics"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Actions recorded in the audit log
+const (
+	ConversationOpen = "conversation.open"
+	UserUpdate       = "user.update"
+	ConfigReload     = "admin.reload"
+	Backup           = "admin.backup"
+	ChannelPurge     = "admin.purge"
+	TeamExport       = "admin.export"
+	ChannelExport    = "admin.channel-export"
+	ArchiveImport    = "admin.import"
+	StoreReconnect   = "admin.reconnect"
+	LogLevelChange   = "admin.log-level"
+)
+
+// The type of object the action changed
+const (
+	TargetService = "service"
+	TargetUser    = "user"
+	TargetChannel = "channel"
+	TargetTeam    = "team"
+)
+
+// The actor of changes made by the service itself, IE: a config reload on SIGHUP
+const SystemActor = "system"
+
+type contextKey int
+
+const (
+	sinkKey contextKey = 0
+)
+
+// A Sink receives a copy of every audit event recorded
+type Sink interface {
+	Write(event *model.AuditEvent) error
+	Close() error
+}
+
+// Appends each event as a line of json to a file that is never truncated or rewritten
+type FileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	// O_SYNC, such that an event is on disk before the change is acknowledged to the client
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while opening audit file '%s'", path)
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (self *FileSink) Write(event *model.AuditEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	_, err = self.file.Write(append(payload, '\n'))
+	return err
+}
+
+func (self *FileSink) Close() error {
+	return self.file.Close()
+}
+
+func AddSink(ctx context.Context, sink Sink) context.Context {
+	return context.WithValue(ctx, sinkKey, sink)
+}
+
+// Returns the sink of the context, or nil if events are only recorded in the store
+func GetSink(ctx context.Context) Sink {
+	sink, _ := ctx.Value(sinkKey).(Sink)
+	return sink
+}
+
+// Create an event for a change made by the authenticated user, or by the system if the request is not
+// authenticated. `before` and `after` are json encoded, either may be nil
+func NewEvent(ctx context.Context, action, targetType, targetId string, before, after interface{}) *model.AuditEvent {
+	event := &model.AuditEvent{
+		Action:     action,
+		ActorId:    SystemActor,
+		TargetType: targetType,
+		TargetId:   targetId,
+		RequestId:  utils.GetRequestId(ctx),
+	}
+	if principal, err := auth.GetPrincipal(ctx); err == nil {
+		event.ActorId = principal.UserId
+		event.TeamId = principal.TeamId
+	}
+	event.Before = encode(before)
+	event.After = encode(after)
+	return event
+}
+
+func encode(obj interface{}) json.RawMessage {
+	if obj == nil {
+		return nil
+	}
+	payload, err := json.Marshal(obj)
+	if err != nil {
+		// Record that we failed to encode rather than lose the event
+		payload, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return payload
+}
+
+// Record the event in the store of the context and the sink (if any). Both are attempted, failures are logged,
+// counted by the 'audit_failure_count' metric and the first error is returned
+func Record(ctx context.Context, event *model.AuditEvent) error {
+	fields := log.Fields{
+		"type":      "audit",
+		"action":    event.Action,
+		"actorId":   event.ActorId,
+		"targetId":  event.TargetId,
+		"requestId": event.RequestId,
+	}
+
+	// Assigned here, so the store and the sink agree on the id even if the store is down
+	if event.Id == "" {
+		event.Id = utils.NewId()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	err := store.GetStore(ctx).InsertAuditEvent(ctx, event)
+	if err != nil {
+		log.WithFields(fields).Errorf("Failed to record audit event in the store - %s", err.Error())
+		metrics.AuditFailures.WithLabelValues(event.Action, "store").Inc()
+	}
+
+	if sink := GetSink(ctx); sink != nil {
+		if sinkErr := sink.Write(event); sinkErr != nil {
+			log.WithFields(fields).Errorf("Failed to write audit event to the sink - %s", sinkErr.Error())
+			metrics.AuditFailures.WithLabelValues(event.Action, "sink").Inc()
+			if err == nil {
+				err = sinkErr
+			}
+		}
+	}
+	return err
+}
@@ -5,11 +5,32 @@
 package auth
 
 import (
-	"golang.org/x/net/context"
+	"net/http"
+
 	"github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/store"
+	"golang.org/x/net/context"
 )
 
-func CanAccessChannel(ctx context.Context, channelId string) errors.HttpError {
-	//errors.Fatal(ctx, errors.ACCESS_DENIED, "You do not have access to channel '%s'", channelId)
+// Returns nil if the caller may access the channel, the error may be an HttpError or an error from the store
+func CanAccessChannel(ctx context.Context, channelId string) error {
+	conversation, err := store.GetStore(ctx).GetConversation(ctx, channelId)
+	// Not a private conversation
+	if store.Cause(err) == store.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only participants may access a conversation
+	principal, httpErr := GetPrincipal(ctx)
+	if httpErr != nil {
+		return httpErr
+	}
+	if !conversation.HasParticipant(principal.UserId) {
+		return errors.NewHttpError(ctx, http.StatusForbidden, nil,
+			"You do not have access to channel '%s'", channelId)
+	}
 	return nil
 }
@@ -0,0 +1,69 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"net/http"
+
+	"github.com/howler-chat/api-service/errors"
+	"golang.org/x/net/context"
+)
+
+type contextKey int
+
+const (
+	principalKey contextKey = 0
+)
+
+// Scopes grant a principal access beyond their own data
+const (
+	// Full administrative access, implies every other scope
+	ScopeAdmin = "admin"
+	// May list the audit log of their team
+	ScopeAuditRead = "audit:read"
+)
+
+// A Principal is the identity of the client making the request
+type Principal struct {
+	UserId string
+	TeamId string
+	Scopes []string
+}
+
+// Returns true if the principal was granted the scope, or is an admin
+func (self *Principal) HasScope(scope string) bool {
+	for _, granted := range self.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func AddPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// Returns the principal associated with the request, or a 401 if the request was not authenticated
+func GetPrincipal(ctx context.Context) (*Principal, errors.HttpError) {
+	obj, ok := ctx.Value(principalKey).(*Principal)
+	if !ok {
+		return nil, errors.NewHttpError(ctx, http.StatusUnauthorized, nil, "Authentication Required")
+	}
+	return obj, nil
+}
+
+// Returns a 403 if the authenticated principal was not granted the scope, or a 401 if the request was
+// not authenticated
+func RequireScope(ctx context.Context, scope string) (*Principal, errors.HttpError) {
+	principal, err := GetPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !principal.HasScope(scope) {
+		return nil, errors.NewHttpError(ctx, http.StatusForbidden, nil, "Scope '%s' is required", scope)
+	}
+	return principal, nil
+}
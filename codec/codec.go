@@ -0,0 +1,182 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package codec encodes and decodes the models of the api for a transport. JSON is the default, clients that want
+smaller payloads may ask for MessagePack with the 'Accept' and 'Content-Type' headers.
+
+Decoding is strict; fields the model does not have and any data following the first document are rejected, such
+that a client can not smuggle data past validation.
+*/
+package codec
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	ugorji "github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+)
+
+type Codec interface {
+	// A name suitable for error messages, IE: 'JSON'
+	Name() string
+	// The value of the 'Content-Type' header for payloads encoded by this codec
+	ContentType() string
+	Marshal(value interface{}) ([]byte, error)
+	// Decode a single document from the reader, returns an error if any data follows the document
+	Decode(reader io.Reader, value interface{}) error
+}
+
+var ErrTrailingData = errors.New("unexpected data after the end of the request")
+
+var (
+	JSON    Codec = &jsonCodec{}
+	MsgPack Codec = newMsgPackCodec()
+)
+
+// Maps the media types we accept to the codec that handles them
+var mediaTypes = map[string]Codec{
+	"application/json":      JSON,
+	"application/x-msgpack": MsgPack,
+	"application/msgpack":   MsgPack,
+}
+
+type jsonCodec struct{}
+
+func (self *jsonCodec) Name() string        { return "JSON" }
+func (self *jsonCodec) ContentType() string { return "application/json; charset=utf-8" }
+
+func (self *jsonCodec) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (self *jsonCodec) Decode(reader io.Reader, value interface{}) error {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+type msgPackCodec struct {
+	handle *ugorji.MsgpackHandle
+}
+
+func newMsgPackCodec() *msgPackCodec {
+	handle := &ugorji.MsgpackHandle{}
+	// Use the MessagePack 'str' and timestamp types instead of the older raw encoding
+	handle.WriteExt = true
+	handle.RawToString = true
+	handle.ErrorIfNoField = true
+	return &msgPackCodec{handle: handle}
+}
+
+func (self *msgPackCodec) Name() string        { return "MessagePack" }
+func (self *msgPackCodec) ContentType() string { return "application/x-msgpack" }
+
+func (self *msgPackCodec) Marshal(value interface{}) ([]byte, error) {
+	var payload []byte
+	err := ugorji.NewEncoderBytes(&payload, self.handle).Encode(value)
+	return payload, err
+}
+
+func (self *msgPackCodec) Decode(reader io.Reader, value interface{}) error {
+	// The decoder can only tell us how much of a buffer it consumed, request bodies are size limited before
+	// they are decoded so reading the entire body is safe
+	payload, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	decoder := ugorji.NewDecoderBytes(payload, self.handle)
+	if err := decoder.Decode(value); err != nil {
+		return err
+	}
+	if decoder.NumBytesRead() != len(payload) {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+// Returns the codec for the 'Content-Type' of a request. JSON if the content type is empty or unknown, such that
+// clients which do not set a content type continue to work
+func ForContentType(contentType string) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return JSON
+	}
+	if codec, exists := mediaTypes[mediaType]; exists {
+		return codec
+	}
+	return JSON
+}
+
+// Returns the codec the client prefers according to the 'Accept' header, JSON if the client has no preference
+// or accepts none of our codecs
+func Negotiate(accept string) Codec {
+	result, best := JSON, 0.0
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, exists := params["q"]; exists {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		codec, exists := mediaTypes[mediaType]
+		if !exists {
+			// Wildcards match our default
+			if mediaType != "*/*" && mediaType != "application/*" {
+				continue
+			}
+			codec = JSON
+		}
+		// The first of equally preferred types wins
+		if quality > best {
+			result, best = codec, quality
+		}
+	}
+	return result
+}
+
+type contextKey int
+
+const (
+	requestKey  contextKey = 0
+	responseKey contextKey = 1
+)
+
+// Adds the codecs used to decode the request and encode the response to the context
+func AddCodecs(ctx context.Context, request, response Codec) context.Context {
+	return context.WithValue(context.WithValue(ctx, requestKey, request), responseKey, response)
+}
+
+// Returns the codec of the request body, JSON if none was negotiated
+func GetRequestCodec(ctx context.Context) Codec {
+	if codec, ok := ctx.Value(requestKey).(Codec); ok {
+		return codec
+	}
+	return JSON
+}
+
+// Returns the codec the response should be encoded with, JSON if none was negotiated
+func GetResponseCodec(ctx context.Context) Codec {
+	if codec, ok := ctx.Value(responseKey).(Codec); ok {
+		return codec
+	}
+	return JSON
+}
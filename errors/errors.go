@@ -7,6 +7,7 @@ package errors
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/howler-chat/api-service/metrics"
@@ -48,27 +49,42 @@ func NewHttpError(ctx context.Context, code int, tags map[string]string, msg str
 		// Tell metrics about the internal error
 		metrics.InternalErrors.With(tags).Inc()
 		// Log the detail of the error
-		log.WithFields(utils.ToFields(tags)).Error(renderedMsg)
+		log.WithFields(utils.ToFields(tags)).WithField("requestId", utils.GetRequestId(ctx)).Error(renderedMsg)
 	}
 
 	return &ErrorResponse{
-		Type:    "error",
-		Code:    code,
-		Message: renderedMsg,
-		// TODO: RequestId: ctx.GetRequestId()
+		Type:      "error",
+		Code:      code,
+		Message:   renderedMsg,
+		RequestId: utils.GetRequestId(ctx),
 	}
 }
 
 // Tell the client, it sent invalid json
 func HttpErrorInvalidJson(ctx context.Context, err error) HttpError {
-	return NewHttpError(ctx, http.StatusBadRequest, nil, "Received Invalid JSON - %s", err.Error())
+	return HttpErrorInvalidEncoding(ctx, "JSON", err)
+}
+
+// Tell the client, it sent a request we could not decode as `encoding`, IE: 'MessagePack'
+func HttpErrorInvalidEncoding(ctx context.Context, encoding string, err error) HttpError {
+	return NewHttpError(ctx, http.StatusBadRequest, nil, "Received Invalid %s - %s", encoding, err.Error())
+}
+
+// Tell the client, the request body is larger than we accept
+func HttpErrorRequestTooLarge(ctx context.Context, limit int64) HttpError {
+	return NewHttpError(ctx, http.StatusRequestEntityTooLarge, nil, "Request body exceeds the limit of %d bytes", limit)
 }
 
 // Tell the client we had some issue un-marshalling json internally
 func HttpErrorInternalJson(ctx context.Context, method string, err error) HttpError {
+	return HttpErrorInternalEncoding(ctx, method, "JSON", err)
+}
+
+// Tell the client we had some issue marshalling the response as `encoding`, IE: 'MessagePack'
+func HttpErrorInternalEncoding(ctx context.Context, method, encoding string, err error) HttpError {
 	tags := map[string]string{
-		"type:":  "json",
+		"type:":  strings.ToLower(encoding),
 		"method": method,
 	}
-	return NewHttpError(ctx, http.StatusInternalServerError, tags, "Marshal JSON Error - %s", err.Error())
+	return NewHttpError(ctx, http.StatusInternalServerError, tags, "Marshal %s Error - %s", encoding, err.Error())
 }
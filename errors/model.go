@@ -16,8 +16,8 @@ type ErrorResponse struct {
 	Type      string `json:"type"`
 	Code      int    `json:"code"`
 	Message   string `json:"message,omitempty"`
-	RequestId string `json:"omit"`
-	Raw       []byte `json:"omit"`
+	RequestId string `json:"requestId,omitempty"`
+	Raw       []byte `json:"-"`
 }
 
 func (self *ErrorResponse) Error() string {
@@ -40,7 +40,7 @@ func (self *ErrorResponse) ToJson() []byte {
 	resp, err := json.Marshal(self)
 	if err != nil {
 		log.WithField("requestId", self.RequestId).
-			Error("json.Marshal() failed on '%+v' with '%s'", self, err.Error())
+			Errorf("json.Marshal() failed on '%+v' with '%s'", self, err.Error())
 		return []byte(fmt.Sprintf(`{ "type": "error", "code": %d, "message": "Internal Error"}`,
 			http.StatusInternalServerError))
 	}
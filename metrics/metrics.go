@@ -1,37 +1,232 @@
 package metrics
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"net/http"
+	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus only allows [a-zA-Z0-9_] in metric names
+const Namespace = "howler_api"
+
+// All our metrics are registered here instead of the prometheus default registry
+var Registry = prometheus.NewRegistry()
+
+// The 'route' label is the pattern the request matched, IE: 'message.get', never the raw path
 var HTTPRequestCount = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
-		Namespace: "howler-api",
+		Namespace: Namespace,
 		Name:      "http_request_count",
 		Help:      "The number of HTTP requests.",
 	},
-	[]string{"method", "endpoint"},
+	[]string{"route", "method", "code"},
 )
 
-var HTTPRequestLatency = prometheus.NewSummaryVec(
-	prometheus.SummaryOpts{
-		Namespace: "howler-api",
-		Name:      "http_request_latency",
+var HTTPRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_request_duration_seconds",
 		Help:      "The latency of HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	},
+	[]string{"route", "method", "code"},
+)
+
+var HTTPRequestsInFlight = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "The number of HTTP requests currently being served.",
+	},
+	[]string{"route"},
+)
+
+var HTTPRequestSize = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_request_size_bytes",
+		Help:      "The size of HTTP request bodies.",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+	},
+	[]string{"route", "method"},
+)
+
+var HTTPResponseSize = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_response_size_bytes",
+		Help:      "The size of HTTP response bodies.",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+	},
+	[]string{"route", "method", "code"},
+)
+
+// The 'method' label is the full gRPC method, IE: '/howler.Howler/GetMessage'
+var GRPCRequestCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "grpc_request_count",
+		Help:      "The number of gRPC requests.",
+	},
+	[]string{"method", "code"},
+)
+
+var GRPCRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "The latency of gRPC requests, for streams the time the stream was open.",
+		Buckets:   prometheus.DefBuckets,
+	},
+	[]string{"method", "code"},
+)
+
+var GRPCStreamsOpen = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "grpc_streams_open",
+		Help:      "The number of gRPC streams currently open.",
 	},
-	[]string{"method", "endpoint"},
+	[]string{"method"},
+)
+
+// Calls to the http api by version, such that we know when clients of an old version are gone. The 'version' label
+// is 'unversioned' for calls to the routes under '/api' without a version
+var APIVersionCalls = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "api_version_call_count",
+		Help:      "The number of api calls by version.",
+	},
+	[]string{"version", "method", "deprecated"},
 )
 
 var InternalErrors = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
-		Namespace: "howler-api",
+		Namespace: Namespace,
 		Name:      "internal_error_count",
 		Help:      "The number of internal errors.",
 	},
 	[]string{"type", "method"},
 )
 
-// Must call before using the RecordMetrics() middleware
+// Audit events that could not be written, the 'destination' label is 'store' or 'sink'
+var AuditFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "audit_failure_count",
+		Help:      "The number of audit events that failed to record.",
+	},
+	[]string{"action", "destination"},
+)
+
+var RethinkPoolSize = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "rethink_pool_size",
+		Help:      "The configured connection pool limits for each rethinkdb backend.",
+	},
+	[]string{"backend", "limit"},
+)
+
+var RethinkConnected = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "rethink_connected",
+		Help:      "1 if the rethinkdb backend is connected, 0 if it is reconnecting.",
+	},
+	[]string{"backend"},
+)
+
+var RethinkReconnectCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "rethink_reconnect_count",
+		Help:      "The number of failed attempts to connect to rethinkdb.",
+	},
+	[]string{"backend"},
+)
+
+var RethinkSessionWaiting = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "rethink_session_waiting",
+		Help:      "The number of requests waiting for a rethinkdb connection.",
+	},
+	[]string{"backend"},
+)
+
+var StoreConsistency = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "store_consistency",
+		Help:      "The durability and read mode used by each api endpoint, always 1.",
+	},
+	[]string{"endpoint", "durability", "read_mode"},
+)
+
+var StoreLatency = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "store_latency_seconds",
+		Help:      "The latency of store operations.",
+		Buckets:   prometheus.DefBuckets,
+	},
+	[]string{"backend", "method"},
+)
+
+var StoreErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "store_error_count",
+		Help: "The number of failed store operations by class; 'not_found', 'conflict', 'canceled', " +
+			"'deadline_exceeded' or 'unavailable'.",
+	},
+	[]string{"backend", "method", "class"},
+)
+
+var StoreRows = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "store_rows_returned",
+		Help:      "The number of rows returned by store operations.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 6),
+	},
+	[]string{"backend", "method"},
+)
+
+var initOnce sync.Once
+
+// Must call before using the RecordMetrics() middleware, safe to call more than once
 func Init() {
-	prometheus.MustRegister(HTTPRequestCount)
-	prometheus.MustRegister(HTTPRequestLatency)
-	prometheus.MustRegister(InternalErrors)
+	initOnce.Do(func() {
+		Registry.MustRegister(prometheus.NewGoCollector())
+		Registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+		Registry.MustRegister(HTTPRequestCount)
+		Registry.MustRegister(HTTPRequestDuration)
+		Registry.MustRegister(HTTPRequestsInFlight)
+		Registry.MustRegister(HTTPRequestSize)
+		Registry.MustRegister(HTTPResponseSize)
+		Registry.MustRegister(GRPCRequestCount)
+		Registry.MustRegister(GRPCRequestDuration)
+		Registry.MustRegister(GRPCStreamsOpen)
+		Registry.MustRegister(APIVersionCalls)
+		Registry.MustRegister(InternalErrors)
+		Registry.MustRegister(AuditFailures)
+		Registry.MustRegister(RethinkPoolSize)
+		Registry.MustRegister(RethinkConnected)
+		Registry.MustRegister(RethinkReconnectCount)
+		Registry.MustRegister(RethinkSessionWaiting)
+		Registry.MustRegister(StoreConsistency)
+		Registry.MustRegister(StoreLatency)
+		Registry.MustRegister(StoreErrors)
+		Registry.MustRegister(StoreRows)
+	})
+}
+
+// Returns a handler that exposes the metrics in our registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
 }
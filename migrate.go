@@ -0,0 +1,129 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	stdSql "database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/dancannon/gorethink"
+	"github.com/howler-chat/api-service/service"
+	"github.com/howler-chat/api-service/store/rethink"
+	"github.com/howler-chat/api-service/store/rethink/migrations"
+	"github.com/howler-chat/api-service/store/sql"
+)
+
+// Apply or report the schema migrations for every rethinkdb and sql store backend in the config
+//	api-service migrate up --config /etc/howler/api.ini
+//	api-service migrate up --dry-run
+//	api-service migrate status
+func migrate(argv []string) int {
+	parser := newParser("api-service migrate")
+	parser.AddArgument("action").Default("status").
+		Help("'up' applies all pending migrations, 'status' lists pending migrations")
+	parser.AddOption("--dry-run").IsTrue().
+		Help("Print the changes 'up' would make without making them")
+	parser.AddOption("--shards").IsInt().Default("0").
+		Help("Number of shards for each table, applied on every run, 0 uses the rethinkdb default")
+	parser.AddOption("--replicas").IsInt().Default("0").
+		Help("Number of replicas for each table, applied on every run, 0 uses the rethinkdb default")
+
+	opt := parseConfig(parser, &argv)
+
+	action := opt.String("action")
+	if action != "up" && action != "status" {
+		fmt.Printf("Unknown migrate action '%s', expected 'up' or 'status'\n", action)
+		return 1
+	}
+
+	opts := migrations.Options{
+		Shards:   opt.Int("shards"),
+		Replicas: opt.Int("replicas"),
+		DryRun:   opt.Bool("dry-run"),
+	}
+
+	config := service.RouterConfig(opt)
+
+	// Migrate the backends in a predictable order
+	var names []string
+	for name := range config.Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dsn, err := url.Parse(config.Backends[name])
+		if err != nil {
+			fmt.Printf("Invalid dsn for store backend '%s' - %s\n", name, err.Error())
+			return 1
+		}
+		fmt.Printf("-- Store backend '%s'\n", name)
+		switch dsn.Scheme {
+		case "rethink":
+			err = migrateRethink(dsn, action, opts)
+		case "sqlite", "postgres":
+			err = migrateSql(dsn, action, opts)
+		default:
+			fmt.Printf("No migrations for '%s' store backends\n", dsn.Scheme)
+		}
+		if err != nil {
+			fmt.Printf("Migration of store backend '%s' failed - %s\n", name, err.Error())
+			return 1
+		}
+	}
+	return 0
+}
+
+func migrateRethink(dsn *url.URL, action string, opts migrations.Options) error {
+	connectOpts, err := rethink.ParseDSN(dsn)
+	if err != nil {
+		return err
+	}
+	if connectOpts.Database == "" {
+		return fmt.Errorf("no database name provided")
+	}
+
+	session, err := gorethink.Connect(connectOpts)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	migrator := migrations.NewMigrator(session, connectOpts.Database, opts, os.Stdout)
+	if action == "up" {
+		return migrator.Up()
+	}
+	return migrator.Status()
+}
+
+func migrateSql(dsn *url.URL, action string, opts migrations.Options) error {
+	dialect, source, err := sql.ParseDSN(dsn)
+	if err != nil {
+		return err
+	}
+
+	// Opening a sqlite file creates it. A database that doesn't exist yet is at version 0, so report on an empty
+	// database rather than creating the file
+	if dialect.Name == sql.SQLite.Name && (action == "status" || opts.DryRun) {
+		if _, err := os.Stat(dsn.Host + dsn.Path); os.IsNotExist(err) {
+			source = "file::memory:"
+		}
+	}
+
+	db, err := stdSql.Open(dialect.Driver, source)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator := sql.NewMigrator(db, dialect, opts.DryRun, os.Stdout)
+	if action == "up" {
+		return migrator.Up()
+	}
+	return migrator.Status()
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/validate"
+	"github.com/howler-chat/api-service/validate/field"
+	"golang.org/x/net/context"
+)
+
+// An AuditEvent records who changed what and when. Events are never modified or removed once recorded
+type AuditEvent struct {
+	Id string `json:"id" gorethink:"id,omitempty"`
+	// The team the target belongs to, "" for changes to the service itself
+	TeamId string `json:"teamId"`
+	// What happened, IE: 'user.update'
+	Action string `json:"action"`
+	// The user that made the change, or 'system' if the service made the change
+	ActorId    string `json:"actorId"`
+	TargetType string `json:"targetType"`
+	TargetId   string `json:"targetId"`
+	// The json encoded target before and after the change, either may be empty
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestId string          `json:"requestId,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// A ListAuditRequest represents a request by an admin to list the audit events of their team, most recent first.
+// Empty fields match every event
+type ListAuditRequest struct {
+	// The team whose events are listed, this is always the team of the authenticated user
+	TeamId   string    `json:"-"`
+	Action   string    `json:"action"`
+	ActorId  string    `json:"actorId"`
+	TargetId string    `json:"targetId"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+	Limit    int       `json:"limit"`
+}
+
+// After marshaling from JSON, call this method to validate the object is intact
+func (self *ListAuditRequest) Validate(ctx context.Context) errors.HttpError {
+	if err := validate.IsValidLimit(self.Limit); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("limit"))
+	}
+	if !self.Since.IsZero() && !self.Until.IsZero() && self.Until.Before(self.Since) {
+		return validate.Fail(ctx, "Must not be before 'since'", field.NewPath("until"))
+	}
+	return nil
+}
+
+// Returns true if the event matches the filters of the request
+func (self *ListAuditRequest) Matches(event *AuditEvent) bool {
+	if event.TeamId != self.TeamId {
+		return false
+	}
+	if self.Action != "" && event.Action != self.Action {
+		return false
+	}
+	if self.ActorId != "" && event.ActorId != self.ActorId {
+		return false
+	}
+	if self.TargetId != "" && event.TargetId != self.TargetId {
+		return false
+	}
+	if !self.Since.IsZero() && event.CreatedAt.Before(self.Since) {
+		return false
+	}
+	if !self.Until.IsZero() && !event.CreatedAt.Before(self.Until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/validate"
+	"github.com/howler-chat/api-service/validate/field"
+	"golang.org/x/net/context"
+)
+
+// The maximum number of users allowed in a single conversation, including the user who opened it
+const MaxParticipants = 9
+
+// A Conversation is a private channel between a fixed set of users. Messages are posted to a conversation by using
+// the conversation id as the channelId.
+type Conversation struct {
+	Id           string    `json:"id" gorethink:"id"`
+	Participants []string  `json:"participants"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActivity time.Time `json:"lastActivity"`
+}
+
+// Returns true if the user is one of the participants of this conversation
+func (self *Conversation) HasParticipant(userId string) bool {
+	for _, participant := range self.Participants {
+		if participant == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a sorted list of participants with duplicates removed
+func Participants(userIds []string) []string {
+	unique := make(map[string]struct{}, len(userIds))
+	var result []string
+	for _, userId := range userIds {
+		if _, exists := unique[userId]; exists {
+			continue
+		}
+		unique[userId] = struct{}{}
+		result = append(result, userId)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Returns the id of the conversation between the users provided, the same set of users always results in the same id
+func ConversationId(userIds []string) string {
+	hash := sha1.Sum([]byte(strings.Join(Participants(userIds), ",")))
+	// Conversation ids are prefixed with 'D' and must be a valid 10 character id
+	return fmt.Sprintf("D%s", base32.StdEncoding.EncodeToString(hash[:])[:9])
+}
+
+// A OpenConversationRequest represents a request by the client to find or create a conversation with other users
+type OpenConversationRequest struct {
+	UserIds []string `json:"userIds"`
+}
+
+// After marshaling from JSON, call this method to validate the object is intact
+func (self *OpenConversationRequest) Validate(ctx context.Context) errors.HttpError {
+	if len(self.UserIds) == 0 || len(self.UserIds) >= MaxParticipants {
+		return validate.Fail(ctx, fmt.Sprintf("Must contain between '%d' and '%d' users", 1, MaxParticipants-1),
+			field.NewPath("userIds"))
+	}
+	for i, userId := range self.UserIds {
+		if err := validate.IsValidId(userId); err != nil {
+			return validate.Fail(ctx, err.Error(), field.NewPath("userIds").Index(i))
+		}
+	}
+	return nil
+}
+
+// A ListConversationRequest represents a request by the client to retrieve the conversations they participate in
+type ListConversationRequest struct {
+	// The user whose conversations are listed, this is always the authenticated user
+	UserId string `json:"-"`
+	Limit  int    `json:"limit"`
+	// Skip this many conversations, the next page starts at the offset plus the limit
+	Offset int `json:"offset"`
+}
+
+// After marshaling from JSON, call this method to validate the object is intact
+func (self *ListConversationRequest) Validate(ctx context.Context) errors.HttpError {
+	if err := validate.IsValidLimit(self.Limit); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("limit"))
+	}
+	if err := validate.IsValidOffset(self.Offset); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("offset"))
+	}
+	return nil
+}
@@ -5,6 +5,8 @@
 package model
 
 import (
+	"time"
+
 	"github.com/howler-chat/api-service/validate"
 	"github.com/howler-chat/api-service/validate/field"
 	"golang.org/x/net/context"
@@ -13,18 +15,22 @@ import (
 
 // A Message represents a point in time message generated by the client and attached to a channel.
 type Message struct {
-	Id        string `json:"id"`
+	Id        string `json:"id" gorethink:"id,omitempty"`
 	ChannelId string `json:"channelId"`
-	Text      string `json:"text"`
+	// The user who posted the message
+	UserId string `json:"userId"`
+	Text   string `json:"text"`
+	// Assigned by the store when the message is inserted
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 // After marshaling from JSON, call this method to validate the object is intact
 func (self *Message) Validate(ctx context.Context) errors.HttpError {
 	if err := validate.IsValidId(self.ChannelId); err != nil {
-		validate.Fail(ctx, err.Error(), field.NewPath("channelId"))
+		return validate.Fail(ctx, err.Error(), field.NewPath("channelId"))
 	}
 	if err := validate.IsMessageText(self.Text); err != nil {
-		validate.Fail(ctx, err.Error(), field.NewPath("channelId"))
+		return validate.Fail(ctx, err.Error(), field.NewPath("text"))
 	}
 	return nil
 }
@@ -53,11 +59,11 @@ type GetMessageRequest struct {
 // After marshaling from JSON, call this method to validate the object is intact
 func (self *GetMessageRequest) Validate(ctx context.Context) errors.HttpError {
 	if err := validate.IsValidId(self.MessageId); err != nil {
-		validate.Fail(ctx, err.Error(), field.NewPath("messageId"))
+		return validate.Fail(ctx, err.Error(), field.NewPath("messageId"))
 	}
 
 	if err := validate.IsValidId(self.ChannelId); err != nil {
-		validate.Fail(ctx, err.Error(), field.NewPath("channelId"))
+		return validate.Fail(ctx, err.Error(), field.NewPath("channelId"))
 	}
 	return nil
 }
@@ -71,12 +77,12 @@ type ListMessageRequest struct {
 // After marshaling from JSON, call this method to validate the object is intact
 func (self *ListMessageRequest) Validate(ctx context.Context) errors.HttpError {
 	if err := validate.IsValidId(self.ChannelId); err != nil {
-		validate.Fail(ctx, err.Error(), field.NewPath("channelId"))
+		return validate.Fail(ctx, err.Error(), field.NewPath("channelId"))
 	}
 	return nil
 }
 
-// The Response to an InsertMessage() message
+// Returned to the client after the message is posted
 type MessageResponse struct {
 	Id string `json:"id"`
 }
@@ -0,0 +1,15 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package model
+
+import "time"
+
+// A Team is the organization users, channels and messages belong to
+type Team struct {
+	Id        string    `json:"id" gorethink:"id,omitempty"`
+	Name      string    `json:"name"`
+	Domain    string    `json:"domain"`
+	CreatedAt time.Time `json:"createdAt"`
+}
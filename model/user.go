@@ -0,0 +1,126 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"strings"
+
+	"github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/validate"
+	"github.com/howler-chat/api-service/validate/field"
+	"golang.org/x/net/context"
+)
+
+// A User represents a member of a team
+type User struct {
+	Id          string `json:"id" gorethink:"id,omitempty"`
+	TeamId      string `json:"teamId"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	AvatarUrl   string `json:"avatarUrl"`
+	Timezone    string `json:"timezone"`
+	Status      string `json:"status"`
+	Deactivated bool   `json:"deactivated"`
+}
+
+// After marshaling from JSON, call this method to validate the object is intact
+func (self *User) Validate(ctx context.Context) errors.HttpError {
+	if err := validate.IsValidId(self.TeamId); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("teamId"))
+	}
+	if err := validate.IsHandle(self.Handle); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("handle"))
+	}
+	if err := validate.IsDisplayName(self.DisplayName); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("displayName"))
+	}
+	if err := validate.IsAvatarUrl(self.AvatarUrl); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("avatarUrl"))
+	}
+	if err := validate.IsTimezone(self.Timezone); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("timezone"))
+	}
+	if err := validate.IsStatus(self.Status); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("status"))
+	}
+	return nil
+}
+
+// Handles are unique within a team regardless of case, this returns the form used to compare handles
+func (self *User) HandleKey() string {
+	return strings.ToLower(self.Handle)
+}
+
+// A GetUserRequest represents a request by the client to retrieve a user on their team
+type GetUserRequest struct {
+	UserId string `json:"userId"`
+}
+
+// After marshaling from JSON, call this method to validate the object is intact
+func (self *GetUserRequest) Validate(ctx context.Context) errors.HttpError {
+	if err := validate.IsValidId(self.UserId); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("userId"))
+	}
+	return nil
+}
+
+// A ListUserRequest represents a request by the client to list the users on their team
+type ListUserRequest struct {
+	// The team whose users are listed, this is always the team of the authenticated user
+	TeamId string `json:"-"`
+	Limit  int    `json:"limit"`
+	// Skip this many users, users are listed by handle so the next page starts at the offset plus the limit
+	Offset             int  `json:"offset"`
+	IncludeDeactivated bool `json:"includeDeactivated"`
+}
+
+// After marshaling from JSON, call this method to validate the object is intact
+func (self *ListUserRequest) Validate(ctx context.Context) errors.HttpError {
+	if err := validate.IsValidLimit(self.Limit); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("limit"))
+	}
+	if err := validate.IsValidOffset(self.Offset); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("offset"))
+	}
+	return nil
+}
+
+// A UpdateUserRequest represents a request by the client to change their profile. Only the fields included in the
+// request are changed
+type UpdateUserRequest struct {
+	UserId      string  `json:"userId"`
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"displayName"`
+	AvatarUrl   *string `json:"avatarUrl"`
+	Timezone    *string `json:"timezone"`
+	Status      *string `json:"status"`
+}
+
+// After marshaling from JSON, call this method to validate the object is intact
+func (self *UpdateUserRequest) Validate(ctx context.Context) errors.HttpError {
+	if err := validate.IsValidId(self.UserId); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("userId"))
+	}
+	return nil
+}
+
+// Apply the requested changes to the user, the caller should validate the user afterwards
+func (self *UpdateUserRequest) Apply(user *User) {
+	if self.Handle != nil {
+		user.Handle = *self.Handle
+	}
+	if self.DisplayName != nil {
+		user.DisplayName = *self.DisplayName
+	}
+	if self.AvatarUrl != nil {
+		user.AvatarUrl = *self.AvatarUrl
+	}
+	if self.Timezone != nil {
+		user.Timezone = *self.Timezone
+	}
+	if self.Status != nil {
+		user.Status = *self.Status
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package pb holds the protocol buffer messages and gRPC service described by howler.proto. The code is generated
+with protoc and protoc-gen-go (github.com/golang/protobuf/protoc-gen-go), after changing howler.proto run
+
+	go generate ./pb
+*/
+package pb
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. howler.proto
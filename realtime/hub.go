@@ -0,0 +1,155 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package realtime delivers messages to the clients subscribed to a channel as they are posted. The hub only knows
+about messages posted to this instance of the service; running more than one instance requires a shared broker.
+*/
+package realtime
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/howler-chat/api-service/model"
+	"golang.org/x/net/context"
+)
+
+// The number of messages buffered for each subscriber, a subscriber that falls further behind is dropped
+const SubscriberBuffer = 100
+
+type contextKey int
+
+const (
+	hubKey contextKey = 0
+)
+
+// A Subscription receives the messages posted to a channel until it is closed
+type Subscription struct {
+	// Closed when the subscription is closed, or the subscriber fell too far behind
+	Messages  <-chan *model.Message
+	messages  chan *model.Message
+	channelId string
+	userId    string
+	since     time.Time
+	hub       *Hub
+}
+
+// Describes a subscription, such that operators can see who is connected
+type Connection struct {
+	ChannelId string    `json:"channelId"`
+	UserId    string    `json:"userId"`
+	Since     time.Time `json:"since"`
+	// Messages waiting to be delivered, a subscriber near SubscriberBuffer is about to be dropped
+	Pending int `json:"pending"`
+}
+
+// Stop receiving messages, safe to call more than once
+func (self *Subscription) Close() {
+	self.hub.remove(self)
+}
+
+// Fans out the messages posted to this process. There is no broker between instances, a subscriber only receives
+// the messages posted through the instance it is connected to
+type Hub struct {
+	mutex       sync.Mutex
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscribe the user to the messages posted to the channel
+func (self *Hub) Subscribe(channelId, userId string) *Subscription {
+	messages := make(chan *model.Message, SubscriberBuffer)
+	sub := &Subscription{Messages: messages, messages: messages, channelId: channelId, userId: userId,
+		since: time.Now().UTC(), hub: self}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.subscribers[channelId] == nil {
+		self.subscribers[channelId] = make(map[*Subscription]struct{})
+	}
+	self.subscribers[channelId][sub] = struct{}{}
+	return sub
+}
+
+// Deliver the message to the subscribers of its channel, never blocks
+func (self *Hub) Publish(msg *model.Message) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for sub := range self.subscribers[msg.ChannelId] {
+		select {
+		case sub.messages <- msg:
+		default:
+			// Rather than block every poster on a slow subscriber, drop the subscriber
+			self.removeLocked(sub)
+		}
+	}
+}
+
+// Returns the number of subscribers to the channel
+func (self *Hub) Subscribers(channelId string) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.subscribers[channelId])
+}
+
+// Returns every open subscription, oldest first
+func (self *Hub) Connections() []Connection {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var result []Connection
+	for _, subs := range self.subscribers {
+		for sub := range subs {
+			result = append(result, Connection{
+				ChannelId: sub.channelId,
+				UserId:    sub.userId,
+				Since:     sub.since,
+				Pending:   len(sub.messages),
+			})
+		}
+	}
+	sort.Sort(bySince(result))
+	return result
+}
+
+// Sorts connections by the oldest first
+type bySince []Connection
+
+func (self bySince) Len() int           { return len(self) }
+func (self bySince) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+func (self bySince) Less(i, j int) bool { return self[i].Since.Before(self[j].Since) }
+
+func (self *Hub) remove(sub *Subscription) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.removeLocked(sub)
+}
+
+func (self *Hub) removeLocked(sub *Subscription) {
+	subs := self.subscribers[sub.channelId]
+	if _, exists := subs[sub]; !exists {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(self.subscribers, sub.channelId)
+	}
+	close(sub.messages)
+}
+
+func AddHub(ctx context.Context, hub *Hub) context.Context {
+	return context.WithValue(ctx, hubKey, hub)
+}
+
+// Returns the hub of the context, or nil if messages are not delivered in realtime
+func GetHub(ctx context.Context) *Hub {
+	hub, _ := ctx.Value(hubKey).(*Hub)
+	return hub
+}
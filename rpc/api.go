@@ -0,0 +1,27 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"io"
+
+	"github.com/howler-chat/api-service/api"
+	"github.com/howler-chat/api-service/codec"
+	"github.com/howler-chat/api-service/errors"
+	"golang.org/x/net/context"
+)
+
+// Returns a registry of the HowlerApi methods in `api.Methods`, named after their http endpoints. Calls use the
+// models of v1, the version JSON-RPC clients were written against
+func NewApiRegistry() *Registry {
+	registry := NewRegistry()
+	for _, method := range api.Methods.Methods() {
+		method := method
+		registry.Register(method.Name, func(ctx context.Context, params io.Reader) (interface{}, errors.HttpError) {
+			return api.V1.Call(ctx, method, params, codec.JSON)
+		})
+	}
+	return registry
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package rpc implements JSON-RPC 2.0 (http://www.jsonrpc.org/specification) on top of the HowlerApi. The method
+name of a call is the name of the api endpoint, IE: 'message.post', and the params are the json request the
+endpoint expects. Batches and notifications are supported, the transport (http or websocket) is left to the caller.
+*/
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/howler-chat/api-service/errors"
+	"golang.org/x/net/context"
+)
+
+const Version = "2.0"
+
+// Error codes defined by the JSON-RPC 2.0 specification
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// Any other error returned by the api, the http code is included in the error data
+	CodeServerError = -32000
+)
+
+type Request struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// A request without an id is a notification, the server does not reply to notifications
+	Id json.RawMessage `json:"id,omitempty"`
+}
+
+type Response struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+}
+
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// A Method is called with the params of the request, which is always a json object. The result is encoded as json
+type Method func(ctx context.Context, params io.Reader) (interface{}, errors.HttpError)
+
+// The Registry maps JSON-RPC method names to the methods that handle them
+type Registry struct {
+	methods map[string]Method
+}
+
+func NewRegistry() *Registry {
+	return &Registry{methods: make(map[string]Method)}
+}
+
+func (self *Registry) Register(name string, method Method) {
+	self.methods[name] = method
+}
+
+// Returns the method registered under `name`, or nil if there is none
+func (self *Registry) Get(name string) Method {
+	return self.methods[name]
+}
+
+// Returns the names of all the registered methods, sorted
+func (self *Registry) Names() []string {
+	var names []string
+	for name := range self.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The Server decodes JSON-RPC requests and dispatches them to the methods of the registry
+type Server struct {
+	Registry *Registry
+	// If not nil, called before each method is dispatched. Allows the caller to prepare the context for the
+	// method, IE: set the store consistency of the endpoint
+	Context func(ctx context.Context, method string) context.Context
+}
+
+func NewServer(registry *Registry) *Server {
+	return &Server{Registry: registry}
+}
+
+// Handle a single request or a batch of requests. Returns the encoded response, or nil if the payload only
+// contained notifications and nothing should be sent back to the client
+func (self *Server) Handle(ctx context.Context, payload []byte) []byte {
+	payload = bytes.TrimSpace(payload)
+
+	// A batch is a json array of requests
+	if len(payload) != 0 && payload[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(payload, &batch); err != nil {
+			return encode(errorResponse(nil, CodeParseError, "Parse error - "+err.Error()))
+		}
+		if len(batch) == 0 {
+			return encode(errorResponse(nil, CodeInvalidRequest, "Invalid Request - empty batch"))
+		}
+
+		var responses []*Response
+		for _, item := range batch {
+			if resp := self.call(ctx, item); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return encode(responses)
+	}
+
+	if resp := self.call(ctx, payload); resp != nil {
+		return encode(resp)
+	}
+	return nil
+}
+
+// Call a single request, returns nil if the request was a notification
+func (self *Server) call(ctx context.Context, payload []byte) *Response {
+	var req Request
+	if err := json.Unmarshal(payload, &req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return errorResponse(nil, CodeParseError, "Parse error - "+err.Error())
+		}
+		return errorResponse(nil, CodeInvalidRequest, "Invalid Request - "+err.Error())
+	}
+	if req.JsonRpc != Version || req.Method == "" {
+		return errorResponse(req.Id, CodeInvalidRequest, "Invalid Request - expected 'jsonrpc' of '2.0' and a 'method'")
+	}
+
+	resp := self.dispatch(ctx, &req)
+	if req.Id == nil {
+		return nil
+	}
+	return resp
+}
+
+func (self *Server) dispatch(ctx context.Context, req *Request) *Response {
+	method := self.Registry.Get(req.Method)
+	if method == nil {
+		return errorResponse(req.Id, CodeMethodNotFound, fmt.Sprintf("Method '%s' not found", req.Method))
+	}
+
+	// Our methods take named parameters only
+	params := bytes.TrimSpace(req.Params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		params = []byte("{}")
+	}
+	if params[0] != '{' {
+		return errorResponse(req.Id, CodeInvalidParams, "Invalid params - 'params' must be an object")
+	}
+
+	if self.Context != nil {
+		ctx = self.Context(ctx, req.Method)
+	}
+
+	result, err := method(ctx, bytes.NewReader(params))
+	if err != nil {
+		return &Response{JsonRpc: Version, Error: toError(err), Id: req.Id}
+	}
+	payload, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		return errorResponse(req.Id, CodeInternalError, "Internal error - "+marshalErr.Error())
+	}
+	return &Response{JsonRpc: Version, Result: payload, Id: req.Id}
+}
+
+// Map the http error returned by the api to a JSON-RPC error, the original error is included as the data
+func toError(err errors.HttpError) *Error {
+	code := CodeServerError
+	switch err.GetCode() {
+	case http.StatusBadRequest, http.StatusNotAcceptable, http.StatusRequestEntityTooLarge:
+		code = CodeInvalidParams
+	case http.StatusInternalServerError:
+		code = CodeInternalError
+	}
+	return &Error{Code: code, Message: err.GetMessage(), Data: err.ToJson()}
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) *Response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &Response{JsonRpc: Version, Error: &Error{Code: code, Message: msg}, Id: id}
+}
+
+func encode(obj interface{}) []byte {
+	payload, err := json.Marshal(obj)
+	if err != nil {
+		// Only happens if a method returned invalid json as its result
+		payload, _ = json.Marshal(errorResponse(nil, CodeInternalError, "Internal error - "+err.Error()))
+	}
+	return payload
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/howler-chat/api-service/api"
+	"github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/rpc"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+)
+
+func TestRpc(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RPC Suite")
+}
+
+func decode(payload []byte, obj interface{}) {
+	Expect(json.Unmarshal(payload, obj)).To(Succeed())
+}
+
+var _ = Describe("Server", func() {
+	var server *rpc.Server
+	var calls int
+
+	BeforeEach(func() {
+		calls = 0
+		registry := rpc.NewRegistry()
+		registry.Register("echo", func(ctx context.Context, params io.Reader) (interface{}, errors.HttpError) {
+			calls++
+			payload, _ := ioutil.ReadAll(params)
+			return json.RawMessage(payload), nil
+		})
+		registry.Register("fail", func(ctx context.Context, params io.Reader) (interface{}, errors.HttpError) {
+			calls++
+			return nil, errors.NewHttpError(ctx, http.StatusBadRequest, nil, "bad channelId")
+		})
+		registry.Register("large", func(ctx context.Context, params io.Reader) (interface{}, errors.HttpError) {
+			calls++
+			return nil, errors.HttpErrorRequestTooLarge(ctx, 10)
+		})
+		server = rpc.NewServer(registry)
+	})
+
+	It("should return the result of a call", func() {
+		var resp rpc.Response
+		decode(server.Handle(context.Background(),
+			[]byte(`{"jsonrpc":"2.0","method":"echo","params":{"text":"hi"},"id":1}`)), &resp)
+		Expect(resp.Error).To(BeNil())
+		Expect(string(resp.Result)).To(Equal(`{"text":"hi"}`))
+		Expect(string(resp.Id)).To(Equal("1"))
+	})
+
+	It("should map api errors to JSON-RPC errors", func() {
+		var resp rpc.Response
+		decode(server.Handle(context.Background(),
+			[]byte(`{"jsonrpc":"2.0","method":"fail","id":"a"}`)), &resp)
+		Expect(resp.Error.Code).To(Equal(rpc.CodeInvalidParams))
+		Expect(resp.Error.Message).To(Equal("bad channelId"))
+		Expect(string(resp.Id)).To(Equal(`"a"`))
+	})
+
+	It("should report oversized params as invalid params", func() {
+		var resp rpc.Response
+		decode(server.Handle(context.Background(),
+			[]byte(`{"jsonrpc":"2.0","method":"large","id":1}`)), &resp)
+		Expect(resp.Error.Code).To(Equal(rpc.CodeInvalidParams))
+	})
+
+	It("should report unknown methods and invalid requests", func() {
+		var resp rpc.Response
+		decode(server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"nope","id":1}`)), &resp)
+		Expect(resp.Error.Code).To(Equal(rpc.CodeMethodNotFound))
+
+		decode(server.Handle(context.Background(), []byte(`{"method":"echo","id":1}`)), &resp)
+		Expect(resp.Error.Code).To(Equal(rpc.CodeInvalidRequest))
+
+		decode(server.Handle(context.Background(), []byte(`{"jsonrpc":`)), &resp)
+		Expect(resp.Error.Code).To(Equal(rpc.CodeParseError))
+		Expect(string(resp.Id)).To(Equal("null"))
+	})
+
+	It("should not reply to notifications", func() {
+		Expect(server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"echo"}`))).To(BeNil())
+		Expect(calls).To(Equal(1))
+	})
+
+	It("should handle batches", func() {
+		var resp []rpc.Response
+		decode(server.Handle(context.Background(), []byte(`[
+			{"jsonrpc":"2.0","method":"echo","params":{},"id":1},
+			{"jsonrpc":"2.0","method":"echo"},
+			{"jsonrpc":"2.0","method":"echo","params":[1],"id":2}
+		]`)), &resp)
+		Expect(calls).To(Equal(2))
+		Expect(len(resp)).To(Equal(2))
+		Expect(string(resp[0].Id)).To(Equal("1"))
+		Expect(resp[1].Error.Code).To(Equal(rpc.CodeInvalidParams))
+
+		decode(server.Handle(context.Background(), []byte(`[]`)), &resp[0])
+		Expect(resp[0].Error.Code).To(Equal(rpc.CodeInvalidRequest))
+	})
+})
+
+var _ = Describe("Api Server", func() {
+	// Validation fails before the HowlerApi is called, so no store is required
+	ctx := api.AddApi(context.Background(), api.NewApi())
+	server := rpc.NewServer(rpc.NewApiRegistry())
+
+	It("should report invalid params in a batch", func() {
+		var resp []rpc.Response
+		decode(server.Handle(ctx, []byte(`[
+			{"jsonrpc":"2.0","method":"message.post","params":{"text":"hello"},"id":1},
+			{"jsonrpc":"2.0","method":"message.get","params":{"channelId":"C000000001"},"id":2}
+		]`)), &resp)
+		Expect(len(resp)).To(Equal(2))
+		for i, expected := range []string{"channelId", "messageId"} {
+			Expect(resp[i].Error.Code).To(Equal(rpc.CodeInvalidParams))
+			Expect(resp[i].Error.Message).To(ContainSubstring("'" + expected + "'"))
+		}
+	})
+})
@@ -0,0 +1,279 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/howler-chat/api-service/archive"
+	"github.com/howler-chat/api-service/audit"
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/validate"
+	"github.com/howler-chat/api-service/validate/field"
+	"github.com/pressly/chi"
+	"golang.org/x/net/context"
+)
+
+type ArchiveExportRequest struct {
+	TeamId string `json:"teamId"`
+	// Channels to export, the conversations and channels of the team are always included in a team export
+	ChannelIds []string `json:"channelIds"`
+
+	team bool
+}
+
+func (self *ArchiveExportRequest) Validate(ctx context.Context) HttpError {
+	if err := validate.IsValidId(self.TeamId); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("teamId"))
+	}
+	if !self.team && len(self.ChannelIds) == 0 {
+		return validate.Fail(ctx, "at least one channel is required", field.NewPath("channelIds"))
+	}
+	for i, channelId := range self.ChannelIds {
+		if err := validate.IsValidId(channelId); err != nil {
+			return validate.Fail(ctx, err.Error(), field.NewPath("channelIds").Index(i))
+		}
+	}
+	return nil
+}
+
+// Start exporting the team or the channels listed to an archive, the archive is downloaded once the job is done
+//
+//	POST /admin/team.export
+//	{ "teamId": "T124B343" }
+//
+//	POST /admin/channel.export
+//	{ "teamId": "T124B343", "channelIds": [ "C024BE91L" ] }
+func AdminExport(serviceCtx *ServiceContext, team bool) chi.HandlerFunc {
+	action, targetType := audit.ChannelExport, audit.TargetChannel
+	if team {
+		action, targetType = audit.TeamExport, audit.TargetTeam
+	}
+
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		request := ArchiveExportRequest{team: team}
+		if err := decodeAdmin(ctx, req, &request); err != nil {
+			writeError(ctx, resp, err)
+			return
+		}
+		entry := adminLog(ctx, action).WithFields(log.Fields{
+			"teamId":     request.TeamId,
+			"channelIds": request.ChannelIds,
+		})
+
+		dbStore, err := serviceCtx.Router.Route(ctx, request.TeamId)
+		if err != nil {
+			entry.Errorf("Export failed - %s", err.GetMessage())
+			writeError(ctx, resp, err)
+			return
+		}
+		job, jobErr := serviceCtx.Jobs.Export(dbStore, archive.ExportRequest{
+			TeamId:     request.TeamId,
+			ChannelIds: request.ChannelIds,
+			Team:       team,
+		})
+		if jobErr != nil {
+			entry.Errorf("Export failed - %s", jobErr.Error())
+			writeError(ctx, resp, NewHttpError(ctx, http.StatusInternalServerError, nil, "%s", jobErr.Error()))
+			return
+		}
+
+		entry.WithField("job", job.Id).Info("Started export")
+		if team {
+			serviceCtx.auditAs(ctx, getOperator(ctx), request.TeamId, action, targetType, request.TeamId)
+		} else {
+			for _, channelId := range request.ChannelIds {
+				serviceCtx.auditAs(ctx, getOperator(ctx), request.TeamId, action, targetType, channelId)
+			}
+		}
+		resp.WriteHeader(http.StatusAccepted)
+		writeResponse(ctx, resp, "service.AdminExport()", job.Status())
+	}
+}
+
+// Start importing a Howler or Slack archive into the team, the body of the request is the ZIP file
+//
+//	POST /admin/archive.import?teamId=T124B343
+func AdminImportArchive(serviceCtx *ServiceContext) chi.HandlerFunc {
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		teamId := req.URL.Query().Get("teamId")
+		if err := validate.IsValidId(teamId); err != nil {
+			writeError(ctx, resp, validate.Fail(ctx, err.Error(), field.NewPath("teamId")))
+			return
+		}
+		entry := adminLog(ctx, audit.ArchiveImport).WithField("teamId", teamId)
+
+		dbStore, err := serviceCtx.Router.Route(ctx, teamId)
+		if err != nil {
+			entry.Errorf("Import failed - %s", err.GetMessage())
+			writeError(ctx, resp, err)
+			return
+		}
+
+		// Zip files are read from the end, so the archive is written to disk before it is opened
+		path, httpErr := saveArchive(ctx, serviceCtx, req.Body)
+		if httpErr != nil {
+			entry.Errorf("Import failed - %s", httpErr.GetMessage())
+			writeError(ctx, resp, httpErr)
+			return
+		}
+		job, jobErr := serviceCtx.Jobs.Import(dbStore, path, teamId)
+		if jobErr != nil {
+			entry.Errorf("Import failed - %s", jobErr.Error())
+			writeError(ctx, resp, NewHttpError(ctx, http.StatusBadRequest, nil, "Invalid archive - %s",
+				jobErr.Error()))
+			return
+		}
+
+		entry.WithField("job", job.Id).Info("Started import")
+		serviceCtx.auditAs(ctx, getOperator(ctx), teamId, audit.ArchiveImport, audit.TargetTeam, teamId)
+		resp.WriteHeader(http.StatusAccepted)
+		writeResponse(ctx, resp, "service.AdminImportArchive()", job.Status())
+	}
+}
+
+// Write the uploaded archive to the archive directory and return its path
+func saveArchive(ctx context.Context, serviceCtx *ServiceContext, body io.Reader) (string, HttpError) {
+	file, err := ioutil.TempFile(serviceCtx.Jobs.Dir(), "import-")
+	if err != nil {
+		return "", NewHttpError(ctx, http.StatusInternalServerError, nil, "%s", err.Error())
+	}
+	defer file.Close()
+
+	maxSize := serviceCtx.Admin.MaxArchiveSize
+	size, err := io.Copy(file, io.LimitReader(body, maxSize+1))
+	if err != nil {
+		os.Remove(file.Name())
+		return "", NewHttpError(ctx, http.StatusBadRequest, nil, "while reading the archive - %s", err.Error())
+	}
+	if size > maxSize {
+		os.Remove(file.Name())
+		return "", HttpErrorRequestTooLarge(ctx, maxSize)
+	}
+	return file.Name(), nil
+}
+
+type JobRequest struct {
+	JobId string `json:"jobId"`
+}
+
+func (self *JobRequest) Validate(ctx context.Context) HttpError {
+	if err := validate.IsValidId(self.JobId); err != nil {
+		return validate.Fail(ctx, err.Error(), field.NewPath("jobId"))
+	}
+	return nil
+}
+
+// Returns the job requested, or writes '404 Not Found'
+func getJob(ctx context.Context, serviceCtx *ServiceContext, resp http.ResponseWriter,
+	req *http.Request) *archive.Job {
+	var request JobRequest
+	if err := decodeAdmin(ctx, req, &request); err != nil {
+		writeError(ctx, resp, err)
+		return nil
+	}
+	job := serviceCtx.Jobs.Get(request.JobId)
+	if job == nil {
+		writeError(ctx, resp, NewHttpError(ctx, http.StatusNotFound, nil, "no job with id '%s'", request.JobId))
+	}
+	return job
+}
+
+// Returns the status and progress of an export or import
+//
+//	POST /admin/job.get
+//	{ "jobId": "J024BE91L" }
+func AdminJobGet(serviceCtx *ServiceContext) chi.HandlerFunc {
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		if job := getJob(ctx, serviceCtx, resp, req); job != nil {
+			writeResponse(ctx, resp, "service.AdminJobGet()", job.Status())
+		}
+	}
+}
+
+// Resume a failed import where it stopped, the messages already imported are not imported again
+//
+//	POST /admin/job.resume
+//	{ "jobId": "J024BE91L" }
+func AdminJobResume(serviceCtx *ServiceContext) chi.HandlerFunc {
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		job := getJob(ctx, serviceCtx, resp, req)
+		if job == nil {
+			return
+		}
+		entry := adminLog(ctx, audit.ArchiveImport).WithFields(log.Fields{"teamId": job.TeamId, "job": job.Id})
+
+		dbStore, err := serviceCtx.Router.Route(ctx, job.TeamId)
+		if err != nil {
+			entry.Errorf("Resume failed - %s", err.GetMessage())
+			writeError(ctx, resp, err)
+			return
+		}
+		if err := serviceCtx.Jobs.Resume(dbStore, job); err != nil {
+			entry.Errorf("Resume failed - %s", err.Error())
+			writeError(ctx, resp, NewHttpError(ctx, http.StatusConflict, nil, "%s", err.Error()))
+			return
+		}
+
+		entry.Info("Resumed import")
+		serviceCtx.auditAs(ctx, getOperator(ctx), job.TeamId, audit.ArchiveImport, audit.TargetTeam, job.TeamId)
+		resp.WriteHeader(http.StatusAccepted)
+		writeResponse(ctx, resp, "service.AdminJobResume()", job.Status())
+	}
+}
+
+type JobListResponse struct {
+	Jobs []archive.JobStatus `json:"jobs"`
+}
+
+// Returns the exports and imports started since the service started, most recent first
+//
+//	GET /admin/job.list
+func AdminJobList(serviceCtx *ServiceContext) chi.HandlerFunc {
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		writeResponse(ctx, resp, "service.AdminJobList()", &JobListResponse{Jobs: serviceCtx.Jobs.List()})
+	}
+}
+
+// Download the archive of a finished export
+//
+//	POST /admin/job.download
+//	{ "jobId": "J024BE91L" }
+func AdminJobDownload(serviceCtx *ServiceContext) chi.HandlerFunc {
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		job := getJob(ctx, serviceCtx, resp, req)
+		if job == nil {
+			return
+		}
+		path := job.Archive()
+		if path == "" {
+			writeError(ctx, resp, NewHttpError(ctx, http.StatusConflict, nil,
+				"job '%s' is not a finished export", job.Id))
+			return
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			writeError(ctx, resp, NewHttpError(ctx, http.StatusInternalServerError, nil, "%s", err.Error()))
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			writeError(ctx, resp, NewHttpError(ctx, http.StatusInternalServerError, nil, "%s", err.Error()))
+			return
+		}
+
+		adminLog(ctx, "admin.download").WithField("job", job.Id).Info("Downloaded archive")
+		name := fmt.Sprintf("%s-%s.zip", job.TeamId, job.Id)
+		resp.Header().Set("Content-Type", "application/zip")
+		resp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		http.ServeContent(resp, req, name, info.ModTime(), file)
+	}
+}
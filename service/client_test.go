@@ -5,13 +5,28 @@
 package service_test
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/howler-chat/api-service/api"
+	"github.com/howler-chat/api-service/archive"
+	"github.com/howler-chat/api-service/codec"
+	"github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/rpc"
 	"github.com/howler-chat/api-service/service"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
 )
 
 func TestHttpClient(t *testing.T) {
@@ -27,11 +42,12 @@ var _ = Describe("HttpClient", func() {
 
 	Describe("service un-available", func() {
 		BeforeEach(func() {
-			cmdLine := []string{"endpoints", "http://unknown-host:8000"}
+			cmdLine := []string{"--endpoints", "unknown-host:8000"}
 			// Get our Rethink Config from our local Environment
 			parser := service.ParseRethinkArgs(&cmdLine)
 			// Create a new service context for our service
 			serviceCtx = service.NewServiceContext(parser)
+			Expect(serviceCtx.Start()).To(Succeed())
 			// Create a new instance
 			server = httptest.NewServer(service.NewService(serviceCtx))
 			// New Instance of the client
@@ -49,24 +65,28 @@ var _ = Describe("HttpClient", func() {
 
 		Context("When api service is not connected to rethinkdb", func() {
 			It("service should return code 503", func() {
-				msg, err := client.GetMessage(context.Background(), "non-existant", "non-existant")
+				msg, err := client.GetMessage(context.Background(), "M000000404", "C000000404")
 				Expect(msg).To(BeNil())
 				Expect(err).To(Not(BeNil()))
 				Expect(service.GetErrorMsg(err)).
-					To(Equal("Rethinkdb Error - gorethink: the connection is closed"))
+					To(HavePrefix("Rethinkdb Error - no connection available to backend 'default'"))
 				Expect(service.GetErrorCode(err)).To(Equal(503))
 			})
 		})
 	})
 
-	/*Describe("/api", func() {
+	Describe("/api", func() {
 		BeforeEach(func() {
-			// Get our Rethink Config from our local Environment
 			parser := service.ParseRethinkArgs(nil)
-			// Create a rethink factory for our service
-			factory = rethink.NewFactory(parser)
+			// Use an in memory sqlite database as the default store backend
+			_, err := parser.ParseIni([]byte("gateway-secret = g4teway\n[store-backends]\ndefault = sqlite:///:memory:\n" +
+				"[api-deprecations]\nunversioned = 2026-10-19\nunversioned-sunset = 2027-04-19\n"))
+			Expect(err).To(BeNil())
+			// Create a new service context for our service
+			serviceCtx = service.NewServiceContext(parser)
+			Expect(serviceCtx.Start()).To(Succeed())
 			// Create a new instance
-			server = httptest.NewServer(service.NewService(factory))
+			server = httptest.NewServer(service.NewService(serviceCtx))
 			// New Instance of the client
 			client, err = service.NewServiceClient(server.URL)
 			if err != nil {
@@ -75,21 +95,567 @@ var _ = Describe("HttpClient", func() {
 		})
 
 		AfterEach(func() {
-			factory.Close()
+			serviceCtx.Stop()
 			server.Close()
 		})
 
 		Describe("/message.get", func() {
 			Context("When requested messageId and channelId doesn't exist", func() {
 				It("should return code 404", func() {
-					msg, err := client.GetMessage(context.Background(), "non-existant", "non-existant")
+					msg, err := client.GetMessage(context.Background(), "M000000404", "C000000404")
 					Expect(msg).To(BeNil())
 					Expect(err).To(Not(BeNil()))
-					Expect(string(service.GetErrorRaw(err))).To(Equal(""))
-					Expect(service.GetErrorMsg(err)).To(Equal(""))
+					Expect(service.GetErrorMsg(err)).To(Equal("Message 'M000000404' not found"))
 					Expect(service.GetErrorCode(err)).To(Equal(404))
 				})
 			})
 		})
-	})*/
+
+		Describe("/audit.list", func() {
+			post := func(path, body, scopes string) *http.Response {
+				req, err := http.NewRequest("POST", server.URL+path, strings.NewReader(body))
+				Expect(err).To(BeNil())
+				req.Header.Set("X-Howler-User-Id", "U000000001")
+				req.Header.Set("X-Howler-Team-Id", "T000000001")
+				req.Header.Set("X-Howler-Gateway-Secret", "g4teway")
+				req.Header.Set("X-Howler-Scopes", scopes)
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).To(BeNil())
+				return resp
+			}
+
+			It("should reject identity headers without the gateway secret", func() {
+				req, err := http.NewRequest("POST", server.URL+"/api/audit.list", strings.NewReader("{}"))
+				Expect(err).To(BeNil())
+				req.Header.Set("X-Howler-User-Id", "U000000001")
+				req.Header.Set("X-Howler-Scopes", "audit:read")
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).To(BeNil())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(401))
+			})
+
+			It("should require the 'audit:read' scope", func() {
+				resp := post("/api/audit.list", "{}", "")
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(403))
+			})
+
+			It("should list the profile changes made by users", func() {
+				dbStore, httpErr := serviceCtx.Router.Route(context.Background(), "T000000001")
+				Expect(httpErr).To(BeNil())
+				user := model.User{Id: "U000000001", TeamId: "T000000001", Handle: "thrawn", DisplayName: "Derrick"}
+				Expect(dbStore.InsertUser(context.Background(), &user)).To(Succeed())
+
+				resp := post("/api/user.update", `{"userId": "U000000001", "handle": "wippler"}`, "")
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(200))
+
+				resp = post("/api/audit.list", `{"action": "user.update"}`, "audit:read")
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(200))
+
+				var events []model.AuditEvent
+				Expect(json.NewDecoder(resp.Body).Decode(&events)).To(Succeed())
+				Expect(len(events)).To(Equal(1))
+				Expect(events[0].ActorId).To(Equal("U000000001"))
+				Expect(events[0].TargetId).To(Equal("U000000001"))
+				Expect(events[0].RequestId).NotTo(BeEmpty())
+				Expect(string(events[0].Before)).To(ContainSubstring(`"handle":"thrawn"`))
+				Expect(string(events[0].After)).To(ContainSubstring(`"handle":"wippler"`))
+			})
+		})
+
+		Describe("/methods", func() {
+			It("should describe every api method", func() {
+				resp, err := http.Get(server.URL + "/api/methods")
+				Expect(err).To(BeNil())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(200))
+
+				var methods []api.MethodInfo
+				Expect(json.NewDecoder(resp.Body).Decode(&methods)).To(Succeed())
+				Expect(len(methods)).To(Equal(len(api.Methods.Methods())))
+
+				var audit api.MethodInfo
+				for _, method := range methods {
+					if method.Name == "audit.list" {
+						audit = method
+					}
+				}
+				Expect(audit.Scope).To(Equal("audit:read"))
+				Expect(audit.Request.Properties).To(HaveKey("since"))
+				Expect(audit.Request.Properties["since"].Format).To(Equal("date-time"))
+				Expect(audit.Request.Properties).NotTo(HaveKey("TeamId"))
+				Expect(audit.Response.Type).To(Equal("array"))
+				Expect(audit.Response.Items.Properties).To(HaveKey("actorId"))
+			})
+		})
+
+		Describe("/openapi.json", func() {
+			It("should only describe paths the service routes", func() {
+				resp, err := http.Get(server.URL + "/api/openapi.json")
+				Expect(err).To(BeNil())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(200))
+
+				var doc api.OpenApiDocument
+				Expect(json.NewDecoder(resp.Body).Decode(&doc)).To(Succeed())
+				Expect(len(doc.Paths)).To(BeNumerically(">", len(api.Methods.Methods())))
+				// Deprecated by the [api-deprecations] config
+				Expect(doc.Paths["/api/message.get"]["post"].Deprecated).To(BeTrue())
+				Expect(doc.Paths["/api/v2/message.get"]["post"].Deprecated).To(BeFalse())
+
+				for path, operations := range doc.Paths {
+					for verb := range operations {
+						req, err := http.NewRequest(strings.ToUpper(verb), server.URL+path, strings.NewReader("{}"))
+						Expect(err).To(BeNil())
+						resp, err := http.DefaultClient.Do(req)
+						Expect(err).To(BeNil())
+
+						var body errors.ErrorResponse
+						json.NewDecoder(resp.Body).Decode(&body)
+						resp.Body.Close()
+						Expect(body.Message).NotTo(HavePrefix("Path '"), "%s %s is not routed", verb, path)
+					}
+				}
+			})
+		})
+
+		Describe("versions", func() {
+			post := func(path string) *http.Response {
+				resp, err := http.Post(server.URL+path, "application/json",
+					strings.NewReader(`{"messageId": "M000000001", "channelId": "C000000001"}`))
+				Expect(err).To(BeNil())
+				resp.Body.Close()
+				return resp
+			}
+
+			It("should serve every version from the same handlers", func() {
+				for _, version := range api.Versions {
+					resp := post("/api/" + version.Name + "/message.get")
+					Expect(resp.StatusCode).To(Equal(404))
+					Expect(resp.Header.Get("Deprecation")).To(BeEmpty())
+				}
+			})
+
+			It("should mark the unversioned routes as deprecated on the dates in the config", func() {
+				resp := post("/api/message.get")
+				Expect(resp.StatusCode).To(Equal(404))
+				since := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+				Expect(resp.Header.Get("Deprecation")).To(Equal(fmt.Sprintf("@%d", since.Unix())))
+				Expect(resp.Header.Get("Sunset")).To(Equal("Mon, 19 Apr 2027 00:00:00 GMT"))
+				Expect(resp.Header.Get("Link")).To(Equal(`</api/v1/message.get>; rel="successor-version"`))
+			})
+
+			It("should return the posted message in v2 and only the id in v1", func() {
+				postMessage := func(path string) map[string]interface{} {
+					req, err := http.NewRequest("POST", server.URL+path,
+						strings.NewReader(`{"channelId": "C000000001", "text": "hello"}`))
+					Expect(err).To(BeNil())
+					req.Header.Set("X-Howler-User-Id", "U000000001")
+					req.Header.Set("X-Howler-Team-Id", "T000000001")
+					req.Header.Set("X-Howler-Gateway-Secret", "g4teway")
+					resp, err := http.DefaultClient.Do(req)
+					Expect(err).To(BeNil())
+					defer resp.Body.Close()
+					Expect(resp.StatusCode).To(Equal(200))
+
+					var body map[string]interface{}
+					Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+					return body
+				}
+
+				v1 := postMessage("/api/v1/message.post")
+				Expect(v1).To(HaveKey("id"))
+				Expect(v1).To(HaveLen(1))
+
+				v2 := postMessage("/api/v2/message.post")
+				Expect(v2["text"]).To(Equal("hello"))
+				Expect(v2["userId"]).To(Equal("U000000001"))
+				Expect(v2).To(HaveKey("createdAt"))
+			})
+		})
+
+		Describe("MessagePack", func() {
+			post := func(path string, body interface{}) *http.Response {
+				payload, err := codec.MsgPack.Marshal(body)
+				Expect(err).To(BeNil())
+				req, err := http.NewRequest("POST", server.URL+path, bytes.NewReader(payload))
+				Expect(err).To(BeNil())
+				req.Header.Set("Content-Type", "application/x-msgpack")
+				req.Header.Set("Accept", "application/x-msgpack, application/json;q=0.5")
+				req.Header.Set("X-Howler-User-Id", "U000000001")
+				req.Header.Set("X-Howler-Team-Id", "T000000001")
+				req.Header.Set("X-Howler-Gateway-Secret", "g4teway")
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).To(BeNil())
+				Expect(resp.Header.Get("Content-Type")).To(Equal("application/x-msgpack"))
+				return resp
+			}
+
+			It("should decode requests and encode responses as MessagePack", func() {
+				resp := post("/api/message.post", model.Message{ChannelId: "C000000001", Text: "Hello msgpack"})
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(200))
+				var posted model.MessageResponse
+				Expect(codec.MsgPack.Decode(resp.Body, &posted)).To(Succeed())
+				Expect(posted.Id).NotTo(BeEmpty())
+
+				resp = post("/api/message.get", model.GetMessageRequest{MessageId: posted.Id, ChannelId: "C000000001"})
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(200))
+				var msg model.Message
+				Expect(codec.MsgPack.Decode(resp.Body, &msg)).To(Succeed())
+				Expect(msg.Text).To(Equal("Hello msgpack"))
+				Expect(msg.CreatedAt.IsZero()).To(BeFalse())
+			})
+
+			It("should encode errors as MessagePack", func() {
+				resp := post("/api/message.get", model.GetMessageRequest{MessageId: "M000000001", ChannelId: "C000000001"})
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(404))
+				var body errors.ErrorResponse
+				Expect(codec.MsgPack.Decode(resp.Body, &body)).To(Succeed())
+				Expect(body.Message).To(Equal("Message 'M000000001' not found"))
+			})
+		})
+
+		Describe("request limits", func() {
+			post := func(path, body string) (int, errors.ErrorResponse) {
+				req, err := http.NewRequest("POST", server.URL+path, strings.NewReader(body))
+				Expect(err).To(BeNil())
+				req.Header.Set("X-Howler-User-Id", "U000000001")
+				req.Header.Set("X-Howler-Team-Id", "T000000001")
+				req.Header.Set("X-Howler-Gateway-Secret", "g4teway")
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).To(BeNil())
+				defer resp.Body.Close()
+
+				var errResp errors.ErrorResponse
+				json.NewDecoder(resp.Body).Decode(&errResp)
+				return resp.StatusCode, errResp
+			}
+
+			It("should reject bodies larger than the max body size", func() {
+				text := strings.Repeat("a", int(serviceCtx.Http.MaxBodySize))
+				code, body := post("/api/message.post", `{"channelId": "C000000001", "text": "`+text+`"}`)
+				Expect(code).To(Equal(413))
+				Expect(body.Message).To(ContainSubstring("exceeds the limit"))
+			})
+
+			It("should reject trailing documents and unknown fields", func() {
+				code, body := post("/api/message.get",
+					`{"messageId": "M000000001", "channelId": "C000000001"} {"messageId": "M000000002"}`)
+				Expect(code).To(Equal(400))
+				Expect(body.Message).To(Equal("Received Invalid JSON - unexpected data after the end of the request"))
+
+				code, body = post("/api/message.get", `{"messageId": "M000000001", "channelId": "C000000001", "admin": true}`)
+				Expect(code).To(Equal(400))
+				Expect(body.Message).To(ContainSubstring("unknown field"))
+			})
+
+			It("should only compress responses larger than the threshold", func() {
+				// The transport asks for gzip and reports if the response was decompressed
+				resp, err := http.Get(server.URL + "/api/openapi.json")
+				Expect(err).To(BeNil())
+				defer resp.Body.Close()
+				Expect(resp.Uncompressed).To(BeTrue())
+				var doc api.OpenApiDocument
+				Expect(json.NewDecoder(resp.Body).Decode(&doc)).To(Succeed())
+				Expect(doc.Paths).NotTo(BeEmpty())
+
+				resp, err = http.Post(server.URL+"/api/message.get", "application/json", strings.NewReader("{}"))
+				Expect(err).To(BeNil())
+				resp.Body.Close()
+				Expect(resp.Uncompressed).To(BeFalse())
+				Expect(resp.Header["Vary"]).To(ContainElement("Accept-Encoding"))
+			})
+
+			It("should send deflate responses in the zlib format", func() {
+				req, err := http.NewRequest("GET", server.URL+"/api/openapi.json", nil)
+				Expect(err).To(BeNil())
+				req.Header.Set("Accept-Encoding", "deflate")
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).To(BeNil())
+				defer resp.Body.Close()
+				Expect(resp.Header.Get("Content-Encoding")).To(Equal("deflate"))
+
+				reader, err := zlib.NewReader(resp.Body)
+				Expect(err).To(BeNil())
+				var doc api.OpenApiDocument
+				Expect(json.NewDecoder(reader).Decode(&doc)).To(Succeed())
+				Expect(doc.Paths).NotTo(BeEmpty())
+			})
+		})
+
+		Describe("/rpc", func() {
+			const batch = `[
+				{"jsonrpc": "2.0", "method": "message.get", "params": {"messageId": "M000000404", "channelId": "C000000404"}, "id": 1},
+				{"jsonrpc": "2.0", "method": "team.nope", "id": 2},
+				{"jsonrpc": "2.0", "method": "message.get", "params": {}}
+			]`
+
+			It("should dispatch a batch posted over http", func() {
+				resp, err := http.Post(server.URL+"/rpc", "application/json", strings.NewReader(batch))
+				Expect(err).To(BeNil())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(200))
+
+				var replies []rpc.Response
+				Expect(json.NewDecoder(resp.Body).Decode(&replies)).To(Succeed())
+				Expect(len(replies)).To(Equal(2))
+				Expect(replies[0].Error.Code).To(Equal(rpc.CodeServerError))
+				Expect(replies[0].Error.Message).To(Equal("Message 'M000000404' not found"))
+				Expect(replies[1].Error.Code).To(Equal(rpc.CodeMethodNotFound))
+			})
+
+			It("should reply with no content to notifications", func() {
+				resp, err := http.Post(server.URL+"/rpc", "application/json",
+					strings.NewReader(`{"jsonrpc": "2.0", "method": "message.get", "params": {}}`))
+				Expect(err).To(BeNil())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(204))
+			})
+
+			It("should dispatch calls sent over a websocket", func() {
+				conn, err := websocket.Dial(strings.Replace(server.URL, "http", "ws", 1)+"/rpc", "", server.URL)
+				Expect(err).To(BeNil())
+				defer conn.Close()
+
+				Expect(websocket.Message.Send(conn, batch)).To(Succeed())
+				var replies []rpc.Response
+				Expect(websocket.JSON.Receive(conn, &replies)).To(Succeed())
+				Expect(len(replies)).To(Equal(2))
+				Expect(string(replies[0].Id)).To(Equal("1"))
+				Expect(replies[0].Error.Code).To(Equal(rpc.CodeServerError))
+			})
+		})
+	})
+
+	Describe("CORS", func() {
+		BeforeEach(func() {
+			parser := service.ParseRethinkArgs(nil)
+			_, err := parser.ParseIni([]byte("[store-backends]\ndefault = sqlite:///:memory:\n" +
+				"[cors]\nallowed-origins = https://howler.chat, https://*.howler.chat\nmax-age = 600\n"))
+			Expect(err).To(BeNil())
+			serviceCtx = service.NewServiceContext(parser)
+			Expect(serviceCtx.Start()).To(Succeed())
+			server = httptest.NewServer(service.NewService(serviceCtx))
+		})
+
+		AfterEach(func() {
+			serviceCtx.Stop()
+			server.Close()
+		})
+
+		preflight := func(origin, method, headers string) *http.Response {
+			req, err := http.NewRequest("OPTIONS", server.URL+"/api/message.post", nil)
+			Expect(err).To(BeNil())
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", method)
+			req.Header.Set("Access-Control-Request-Headers", headers)
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+			return resp
+		}
+
+		It("should answer preflight requests from allowed origins", func() {
+			resp := preflight("https://app.howler.chat", "POST", "content-type")
+			Expect(resp.StatusCode).To(Equal(204))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal("https://app.howler.chat"))
+			Expect(resp.Header.Get("Access-Control-Allow-Methods")).To(Equal("GET, POST, OPTIONS"))
+			Expect(resp.Header.Get("Access-Control-Max-Age")).To(Equal("600"))
+
+			Expect(preflight("https://evil.com", "POST", "").StatusCode).To(Equal(403))
+			Expect(preflight("https://howler.chat", "DELETE", "").StatusCode).To(Equal(403))
+			Expect(preflight("https://howler.chat", "POST", "X-Howler-User-Id").StatusCode).To(Equal(403))
+		})
+
+		It("should only add the allow origin header for allowed origins", func() {
+			get := func(origin string) *http.Response {
+				req, err := http.NewRequest("GET", server.URL+"/api/methods", nil)
+				Expect(err).To(BeNil())
+				req.Header.Set("Origin", origin)
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).To(BeNil())
+				resp.Body.Close()
+				return resp
+			}
+
+			resp := get("https://howler.chat")
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal("https://howler.chat"))
+			Expect(resp.Header["Vary"]).To(ContainElement("Origin"))
+
+			resp = get("https://howler.chat.evil.com")
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(BeEmpty())
+		})
+
+		It("should reject requests that change something from origins that are not allowed", func() {
+			post := func(origin string) *http.Response {
+				// A form can send 'text/plain' cross origin without a preflight
+				req, err := http.NewRequest("POST", server.URL+"/api/message.post",
+					strings.NewReader(`{"channelId": "C000000001", "text": "hello"}`))
+				Expect(err).To(BeNil())
+				req.Header.Set("Content-Type", "text/plain")
+				req.Header.Set("Origin", origin)
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).To(BeNil())
+				resp.Body.Close()
+				return resp
+			}
+
+			Expect(post("https://evil.com").StatusCode).To(Equal(403))
+
+			resp := post("https://app.howler.chat")
+			Expect(resp.StatusCode).NotTo(Equal(403))
+			Expect(resp.Header.Get("Access-Control-Expose-Headers")).To(Equal("X-Request-Id, Deprecation, Sunset"))
+		})
+
+		It("should only accept websocket handshakes from allowed origins", func() {
+			endpoint := strings.Replace(server.URL, "http", "ws", 1) + "/rpc"
+			conn, err := websocket.Dial(endpoint, "", "https://app.howler.chat")
+			Expect(err).To(BeNil())
+			conn.Close()
+
+			_, err = websocket.Dial(endpoint, "", "https://evil.com")
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+	Describe("/admin", func() {
+		BeforeEach(func() {
+			parser := service.ParseRethinkArgs(nil)
+			_, err := parser.ParseIni([]byte("admin-token = s3cret\n[rethink]\npassword = hunter2\n" +
+				"[store-backends]\ndefault = sqlite:///:memory:\n"))
+			Expect(err).To(BeNil())
+			serviceCtx = service.NewServiceContext(parser)
+			Expect(serviceCtx.Start()).To(Succeed())
+			server = httptest.NewServer(service.NewService(serviceCtx))
+		})
+
+		AfterEach(func() {
+			serviceCtx.Stop()
+			server.Close()
+		})
+
+		call := func(method, path, body, token string, result interface{}) int {
+			req, err := http.NewRequest(method, server.URL+"/admin"+path, strings.NewReader(body))
+			Expect(err).To(BeNil())
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).To(BeNil())
+			defer resp.Body.Close()
+			if result != nil && (resp.StatusCode == 200 || resp.StatusCode == 202) {
+				Expect(json.NewDecoder(resp.Body).Decode(result)).To(Succeed())
+			}
+			return resp.StatusCode
+		}
+
+		It("should require the admin token", func() {
+			Expect(call("GET", "/log.level", "", "", nil)).To(Equal(401))
+			Expect(call("GET", "/log.level", "", "wrong", nil)).To(Equal(401))
+			Expect(call("GET", "/log.level", "", "s3cret", nil)).To(Equal(200))
+		})
+
+		It("should purge the messages of a channel", func() {
+			ctx := context.Background()
+			dbStore, err := serviceCtx.Router.Route(ctx, "")
+			Expect(err).To(BeNil())
+			for _, text := range []string{"one", "two"} {
+				Expect(dbStore.InsertMessage(ctx, &model.Message{ChannelId: "C000000001", UserId: "U000000001",
+					Text: text})).To(Succeed())
+			}
+
+			var result service.PurgeChannelResponse
+			Expect(call("POST", "/channel.purge", `{"channelId": "C000000001"}`, "s3cret", &result)).To(Equal(200))
+			Expect(result.Purged).To(Equal(2))
+			Expect(call("POST", "/channel.purge", `{"channelId": ""}`, "s3cret", nil)).To(Equal(406))
+		})
+
+		It("should dump the config with secrets masked", func() {
+			var config map[string]interface{}
+			Expect(call("GET", "/config", "", "s3cret", &config)).To(Equal(200))
+			Expect(config["admin-token"]).To(Equal("*****"))
+			Expect(config["rethink"]).To(HaveKeyWithValue("password", "*****"))
+			Expect(config["store-backends"]).To(HaveKeyWithValue("default", "sqlite:///:memory:"))
+		})
+
+		It("should change the log level", func() {
+			var result service.LogLevelResponse
+			Expect(call("GET", "/log.level", "", "s3cret", &result)).To(Equal(200))
+			previous := result.Level
+			defer call("POST", "/log.level", `{"level": "`+previous+`"}`, "s3cret", nil)
+
+			Expect(call("POST", "/log.level", `{"level": "debug"}`, "s3cret", &result)).To(Equal(200))
+			Expect(result.Level).To(Equal("debug"))
+			Expect(call("POST", "/log.level", `{"level": "loud"}`, "s3cret", nil)).To(Equal(406))
+		})
+
+		It("should refuse to reconnect an in memory store and list realtime connections", func() {
+			// Reconnecting would replace the in memory database with an empty one
+			Expect(call("POST", "/store.reconnect", `{"backend": "default"}`, "s3cret", nil)).To(Equal(409))
+			var reconnect service.ReconnectStoreResponse
+			Expect(call("POST", "/store.reconnect", `{}`, "s3cret", &reconnect)).To(Equal(200))
+			Expect(reconnect.Backends).To(BeEmpty())
+			Expect(call("POST", "/store.reconnect", `{"backend": "unknown"}`, "s3cret", nil)).To(Equal(404))
+
+			sub := serviceCtx.Hub.Subscribe("C000000001", "U000000001")
+			defer sub.Close()
+			var connections service.ConnectionsResponse
+			Expect(call("GET", "/realtime.connections", "", "s3cret", &connections)).To(Equal(200))
+			Expect(connections.Connections).To(HaveLen(1))
+			Expect(connections.Connections[0].UserId).To(Equal("U000000001"))
+			Expect(connections.Channels).To(Equal(map[string]int{"C000000001": 1}))
+		})
+
+		It("should export a team and import the archive into another team", func() {
+			ctx := context.Background()
+			dbStore, err := serviceCtx.Router.Route(ctx, "")
+			Expect(err).To(BeNil())
+			user := &model.User{TeamId: "T000000001", Handle: "alice", DisplayName: "Alice"}
+			Expect(dbStore.InsertUser(ctx, user)).To(Succeed())
+			Expect(dbStore.InsertMessage(ctx, &model.Message{ChannelId: "C000000001", UserId: user.Id,
+				Text: "Hello"})).To(Succeed())
+
+			var job archive.JobStatus
+			Expect(call("POST", "/team.export", `{"teamId": "T000000001"}`, "s3cret", &job)).To(Equal(202))
+			Eventually(func() string {
+				Expect(call("POST", "/job.get", `{"jobId": "`+job.Id+`"}`, "s3cret", &job)).To(Equal(200))
+				return job.State
+			}).Should(Equal(archive.JobDone))
+			Expect(job.Progress.Messages).To(Equal(1))
+			Expect(call("POST", "/job.get", `{"jobId": "J000000001"}`, "s3cret", nil)).To(Equal(404))
+
+			req, _ := http.NewRequest("POST", server.URL+"/admin/job.download",
+				strings.NewReader(`{"jobId": "`+job.Id+`"}`))
+			req.Header.Set("Authorization", "Bearer s3cret")
+			resp, _ := http.DefaultClient.Do(req)
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/zip"))
+			zipFile, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			var imported archive.JobStatus
+			Expect(call("POST", "/archive.import?teamId=T000000002", string(zipFile), "s3cret",
+				&imported)).To(Equal(202))
+			Eventually(func() string {
+				Expect(call("POST", "/job.get", `{"jobId": "`+imported.Id+`"}`, "s3cret",
+					&imported)).To(Equal(200))
+				return imported.State
+			}).Should(Equal(archive.JobDone))
+			// Only failed imports can be resumed
+			Expect(call("POST", "/job.resume", `{"jobId": "`+imported.Id+`"}`, "s3cret", nil)).To(Equal(409))
+
+			users, _ := dbStore.ListUser(ctx, &model.ListUserRequest{TeamId: "T000000002", Limit: 10})
+			Expect(users).To(HaveLen(1))
+			Expect(users[0].Handle).To(Equal("alice"))
+			Expect(call("POST", "/archive.import?teamId=T000000002", "not a zip", "s3cret", nil)).To(Equal(400))
+		})
+	})
 })
@@ -11,9 +11,11 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/trace"
 	"github.com/thrawn01/args"
 	"golang.org/x/net/context"
 	"golang.org/x/net/context/ctxhttp"
@@ -59,12 +61,33 @@ func CurlString(req *http.Request, payload *[]byte) string {
 	return strings.Join(parts, " ")
 }
 
+// Post the value as json, if the context is traced the call is recorded as a client span and the trace is
+// propagated to the server via the 'traceparent' header
 func Post(ctx context.Context, url string, value interface{}) (*http.Response, error) {
 	payload, err := json.Marshal(value)
 	if err != nil {
 		return nil, err
 	}
-	return ctxhttp.Post(ctx, nil, url, contentType, bytes.NewReader(payload))
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	ctx, span := trace.StartClientSpan(ctx, "POST "+req.URL.Path)
+	span.SetAttribute("http.method", "POST")
+	span.SetAttribute("http.url", url)
+	trace.Inject(ctx, req.Header)
+
+	resp, err := ctxhttp.Do(ctx, nil, req)
+	if err != nil {
+		span.SetError(err)
+	} else {
+		span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+	}
+	span.Finish()
+	return resp, err
 }
 
 // Return the message associated with this error
@@ -101,6 +124,20 @@ func ParseRethinkArgs(argv *[]string) *args.ArgParser {
 	rethink.AddOption("--user").Env("RETHINK_USER")
 	rethink.AddOption("--password").Env("RETHINK_PASSWORD")
 	rethink.AddOption("--db").Env("RETHINK_DATABASE")
+	rethink.AddOption("--initial-cap").Env("RETHINK_INITIAL_CAP")
+	rethink.AddOption("--max-open").Env("RETHINK_MAX_OPEN")
+	parser.AddConfigGroup("store-backends")
+	parser.AddConfigGroup("store-teams")
+	parser.AddConfigGroup("store-durability")
+	parser.AddConfigGroup("store-read-mode")
+	parser.AddConfigGroup("cors")
+	parser.AddConfigGroup("api-deprecations")
+	parser.AddOption("--admin-token").Env("ADMIN_TOKEN")
+	parser.AddOption("--gateway-secret").Env("GATEWAY_SECRET")
+	parser.AddOption("--grpc-bind").Env("GRPC_BIND")
+	parser.AddOption("--grpc-tls-cert").Env("GRPC_TLS_CERT")
+	parser.AddOption("--grpc-tls-key").Env("GRPC_TLS_KEY")
+	parser.AddOption("--grpc-client-ca").Env("GRPC_CLIENT_CA")
 	parser.ParseArgs(argv)
 	return parser
 }
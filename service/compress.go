@@ -0,0 +1,157 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pressly/chi"
+	"golang.org/x/net/context"
+)
+
+// Encodings we compress responses with, in order of preference. HTTP 'deflate' is the zlib format (RFC 1950),
+// not a raw deflate stream
+var compressEncodings = []string{"gzip", "deflate"}
+
+// Compresses responses of at least `minSize` bytes with the encoding the client prefers according to the
+// 'Accept-Encoding' header. Smaller responses are sent as is, as compressing them saves little and costs cpu
+func Compress(minSize int) func(chi.Handler) chi.Handler {
+	return func(next chi.Handler) chi.Handler {
+		return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+			if encoding == "" {
+				next.ServeHTTPC(ctx, resp, req)
+				return
+			}
+
+			writer := &compressWriter{ResponseWriter: resp, encoding: encoding, minSize: minSize}
+			defer writer.Close()
+			next.ServeHTTPC(ctx, writer, req)
+		})
+	}
+}
+
+// Returns the encoding the client prefers, or "" if the client accepts none of our encodings
+func negotiateEncoding(accept string) string {
+	result, best := "", 0.0
+	for _, item := range strings.Split(accept, ",") {
+		// 'Accept-Encoding' values are not media types, but they share the same parameter syntax
+		encoding, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, exists := params["q"]; exists {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if encoding == "*" {
+			encoding = compressEncodings[0]
+		}
+
+		for _, supported := range compressEncodings {
+			// The first of equally preferred encodings wins
+			if encoding == supported && quality > best {
+				result, best = encoding, quality
+			}
+		}
+	}
+	return result
+}
+
+// Buffers the response until it reaches `minSize`, after which the response is compressed. If the handler
+// finishes before then the buffered response is written uncompressed by Close()
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	code     int
+	buffer   []byte
+	// Nil until we decide to compress
+	compressor io.WriteCloser
+	// True once the headers were sent without compression
+	passThrough bool
+}
+
+func (self *compressWriter) WriteHeader(code int) {
+	if self.code == 0 {
+		self.code = code
+	}
+}
+
+func (self *compressWriter) Write(buf []byte) (int, error) {
+	if self.compressor != nil {
+		return self.compressor.Write(buf)
+	}
+	if self.passThrough {
+		return self.ResponseWriter.Write(buf)
+	}
+
+	self.buffer = append(self.buffer, buf...)
+	if len(self.buffer) < self.minSize {
+		return len(buf), nil
+	}
+	if err := self.start(); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// Send the headers and the buffered response, compressed unless the handler already encoded the response
+func (self *compressWriter) start() error {
+	header := self.Header()
+	if header.Get("Content-Encoding") != "" {
+		return self.flush()
+	}
+
+	header.Set("Content-Encoding", self.encoding)
+	// The length of the compressed response is unknown until it is written
+	header.Del("Content-Length")
+	self.writeHeader()
+
+	if self.encoding == "gzip" {
+		self.compressor = gzip.NewWriter(self.ResponseWriter)
+	} else {
+		self.compressor = zlib.NewWriter(self.ResponseWriter)
+	}
+	_, err := self.compressor.Write(self.buffer)
+	self.buffer = nil
+	return err
+}
+
+// Send the headers and the buffered response uncompressed
+func (self *compressWriter) flush() error {
+	self.passThrough = true
+	self.writeHeader()
+	_, err := self.ResponseWriter.Write(self.buffer)
+	self.buffer = nil
+	return err
+}
+
+func (self *compressWriter) writeHeader() {
+	if self.code != 0 {
+		self.ResponseWriter.WriteHeader(self.code)
+	}
+}
+
+// Finish the response, must be called once the handler returns
+func (self *compressWriter) Close() error {
+	if self.compressor != nil {
+		return self.compressor.Close()
+	}
+	if !self.passThrough {
+		return self.flush()
+	}
+	return nil
+}
@@ -1,32 +1,475 @@
 package service
 
 import (
+	"crypto/subtle"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
 	"github.com/howler-chat/api-service/api"
+	"github.com/howler-chat/api-service/archive"
+	"github.com/howler-chat/api-service/audit"
+	"github.com/howler-chat/api-service/auth"
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/metrics"
+	"github.com/howler-chat/api-service/realtime"
 	"github.com/howler-chat/api-service/store"
+	// Register the embedded bolt store driver
+	_ "github.com/howler-chat/api-service/store/bolt"
 	"github.com/howler-chat/api-service/store/rethink"
+	"github.com/howler-chat/api-service/trace"
+	// Register the sqlite and postgres store drivers
+	_ "github.com/howler-chat/api-service/store/sql"
+	"github.com/pkg/errors"
 	"github.com/thrawn01/args"
+	"golang.org/x/net/context"
 )
 
 // This handles all the context for the service, including hot reloading of objects and config changes
 type ServiceContext struct {
-	RethinkContext *rethink.RethinkContext
-	Api            api.HowlerApi
-	Store          store.HowlerStore
+	Router       *store.Router
+	Api          api.HowlerApi
+	Tracer       *trace.Tracer
+	AccessLog    AccessLogConfig
+	Http         HttpConfig
+	Admin        AdminConfig
+	Grpc         GrpcConfig
+	Gateway      GatewayConfig
+	Jobs         *archive.Jobs
+	AuditSink    audit.Sink
+	Hub          *realtime.Hub
+	parser       *args.ArgParser
+	mutex        sync.RWMutex
+	consistency  store.ConsistencyConfig
+	cors         CorsConfig
+	deprecations DeprecationConfig
 }
 
 // This should create a new context based on the config passed in via the parser
 func NewServiceContext(parser *args.ArgParser) *ServiceContext {
 	return &ServiceContext{
-		RethinkContext: rethink.NewRethinkContext(parser),
-		Api:            api.NewApi(),
-		Store:          rethink.NewStore(),
+		Router:    store.NewRouter(),
+		Api:       api.NewTracedApi(api.NewApi()),
+		AccessLog: DefaultAccessLog,
+		Http:      DefaultHttpConfig,
+		Hub:       realtime.NewHub(),
+		parser:    parser,
 	}
 }
 
-func (self *ServiceContext) Start() {
-	self.RethinkContext.Start()
+func (self *ServiceContext) Start() error {
+	opts := self.parser.GetOpts()
+
+	consistency, err := ConsistencyConfig(opts)
+	if err != nil {
+		return err
+	}
+	cors, err := NewCorsConfig(opts)
+	if err != nil {
+		return err
+	}
+	deprecations, err := NewDeprecationConfig(opts)
+	if err != nil {
+		return err
+	}
+	if self.AccessLog, err = NewAccessLogConfig(opts); err != nil {
+		return err
+	}
+	if self.Http, err = NewHttpConfig(opts); err != nil {
+		return err
+	}
+	if self.Admin, err = NewAdminConfig(opts); err != nil {
+		return err
+	}
+	if self.Grpc, err = NewGrpcConfig(opts); err != nil {
+		return err
+	}
+	self.Gateway = GatewayConfig{Secret: opts.String("gateway-secret")}
+	if self.Jobs, err = NewJobs(opts); err != nil {
+		return err
+	}
+	if self.Tracer, err = NewTracer(opts); err != nil {
+		return err
+	}
+	if path := opts.String("audit-file"); path != "" {
+		if self.AuditSink, err = audit.NewFileSink(path); err != nil {
+			return err
+		}
+	}
+	if err := self.Router.Reload(RouterConfig(opts)); err != nil {
+		return err
+	}
+	self.setConsistency(consistency)
+	self.setCors(cors)
+	self.setDeprecations(deprecations)
+	return nil
 }
 
 func (self *ServiceContext) Stop() {
-	self.RethinkContext.Stop()
+	self.Router.Stop()
+	if self.AuditSink != nil {
+		self.AuditSink.Close()
+	}
+	if self.Tracer != nil {
+		// Export the spans of requests that finished before we stopped
+		if err := self.Tracer.Stop(); err != nil {
+			log.Errorf("Tracer stop failed - %s", err.Error())
+		}
+	}
+}
+
+// Re-read the config file (if any) and apply the changes to the running service
+func (self *ServiceContext) Reload() error {
+	opts := self.parser.GetOpts()
+
+	if path := opts.String("config"); path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "while reading config file '%s'", path)
+		}
+		if opts, err = self.parser.ParseIni(content); err != nil {
+			return errors.Wrapf(err, "while parsing '%s'", path)
+		}
+	}
+
+	// Validate the new config before applying any of it
+	consistency, err := ConsistencyConfig(opts)
+	if err != nil {
+		return errors.Wrap(err, "while reloading store consistency")
+	}
+
+	cors, err := NewCorsConfig(opts)
+	if err != nil {
+		return errors.Wrap(err, "while reloading cors")
+	}
+
+	deprecations, err := NewDeprecationConfig(opts)
+	if err != nil {
+		return errors.Wrap(err, "while reloading api deprecations")
+	}
+
+	if err := self.Router.Reload(RouterConfig(opts)); err != nil {
+		return errors.Wrap(err, "while reloading store routes")
+	}
+	self.setConsistency(consistency)
+	self.setCors(cors)
+	self.setDeprecations(deprecations)
+	log.Info("Config Reloaded")
+	self.auditSystem(audit.ConfigReload, opts.String("config"))
+	return nil
+}
+
+// Record a change made by the service itself in the audit log of the default store backend
+func (self *ServiceContext) auditSystem(action, detail string) {
+	self.auditAs(context.Background(), audit.SystemActor, "", action, audit.TargetService, detail)
+}
+
+// Record an event by `actor` in the audit log of the store backend for the team, or the default backend if
+// `teamId` is empty
+func (self *ServiceContext) auditAs(ctx context.Context, actor, teamId, action, targetType, targetId string) {
+	dbStore, err := self.Router.Route(ctx, teamId)
+	if err != nil {
+		log.WithField("type", "audit").Errorf("Failed to record audit event '%s' - %s", action, err.GetMessage())
+		return
+	}
+	ctx = store.AddStore(ctx, dbStore)
+	if self.AuditSink != nil {
+		ctx = audit.AddSink(ctx, self.AuditSink)
+	}
+	event := audit.NewEvent(ctx, action, targetType, targetId, nil, nil)
+	event.ActorId, event.TeamId = actor, teamId
+	audit.Record(ctx, event)
+}
+
+// Add the store of the team making the request, the api and everything else the api needs to the context.
+// `endpoint` names the api endpoint the request is for, IE: 'message.get'
+func (self *ServiceContext) Setup(ctx context.Context, endpoint string) (context.Context, HttpError) {
+	// Route the request to the store backend that holds the data for this team
+	var teamId string
+	if principal, err := auth.GetPrincipal(ctx); err == nil {
+		teamId = principal.TeamId
+	}
+
+	dbStore, err := self.Router.Route(ctx, teamId)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = store.AddStore(ctx, dbStore)
+	ctx = store.AddConsistency(ctx, self.Consistency(endpoint))
+	ctx = api.AddApi(ctx, self.Api)
+	ctx = realtime.AddHub(ctx, self.Hub)
+
+	// Audit events are also written to the audit file, if configured
+	if self.AuditSink != nil {
+		ctx = audit.AddSink(ctx, self.AuditSink)
+	}
+	return ctx, nil
+}
+
+// Returns the consistency store operations should use for the api endpoint
+func (self *ServiceContext) Consistency(endpoint string) store.Consistency {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.consistency.For(endpoint)
+}
+
+func (self *ServiceContext) setConsistency(config store.ConsistencyConfig) {
+	self.mutex.Lock()
+	self.consistency = config
+	self.mutex.Unlock()
+
+	// Expose the settings in use, such that overrides are visible on /metrics
+	metrics.StoreConsistency.Reset()
+	metrics.StoreConsistency.WithLabelValues("default", config.Default.Durability, config.Default.ReadMode).Set(1)
+	for endpoint, consistency := range config.Endpoints {
+		metrics.StoreConsistency.WithLabelValues(endpoint, consistency.Durability, consistency.ReadMode).Set(1)
+	}
+}
+
+// Returns the CORS config currently in use
+func (self *ServiceContext) Cors() CorsConfig {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.cors
+}
+
+func (self *ServiceContext) setCors(config CorsConfig) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.cors = config
+}
+
+// Returns the deprecation of the method in the version, or nil if clients may keep calling it
+func (self *ServiceContext) Deprecation(version *api.Version, method string) *api.Deprecation {
+	if deprecation := version.Deprecation(method); deprecation != nil {
+		return deprecation
+	}
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.deprecations[version.Name]
+}
+
+func (self *ServiceContext) setDeprecations(config DeprecationConfig) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.deprecations = config
+}
+
+// Backup the store backends that support online backups to the directory given by '--backup-dir'
+func (self *ServiceContext) Backup() error {
+	dir := self.parser.GetOpts().String("backup-dir")
+	if dir == "" {
+		return errors.New("no --backup-dir configured")
+	}
+
+	names, err := self.Router.Backup(dir)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		log.Info("No store backends support online backups")
+	}
+	self.auditSystem(audit.Backup, dir)
+	return nil
+}
+
+// Build the durability and read mode of each api endpoint from the config. Endpoints use the 'default' of each
+// group for any setting they don't override.
+//
+//	[store-durability]
+//	default = hard
+//	message.post = soft
+//
+//	[store-read-mode]
+//	message.get = majority
+func ConsistencyConfig(opts *args.Options) (store.ConsistencyConfig, error) {
+	config := store.ConsistencyConfig{
+		Default:   store.DefaultConsistency,
+		Endpoints: map[string]store.Consistency{},
+	}
+
+	durability := opts.Group("store-durability").ToMap()
+	readMode := opts.Group("store-read-mode").ToMap()
+	if value, ok := durability["default"]; ok {
+		config.Default.Durability = value.(string)
+	}
+	if value, ok := readMode["default"]; ok {
+		config.Default.ReadMode = value.(string)
+	}
+
+	override := func(endpoint string, apply func(*store.Consistency)) {
+		consistency, ok := config.Endpoints[endpoint]
+		if !ok {
+			consistency = config.Default
+		}
+		apply(&consistency)
+		config.Endpoints[endpoint] = consistency
+	}
+	for endpoint, value := range durability {
+		if endpoint != "default" {
+			override(endpoint, func(consistency *store.Consistency) { consistency.Durability = value.(string) })
+		}
+	}
+	for endpoint, value := range readMode {
+		if endpoint != "default" {
+			override(endpoint, func(consistency *store.Consistency) { consistency.ReadMode = value.(string) })
+		}
+	}
+	return config, config.Validate()
+}
+
+// Parses an option that must be a number between 0 and 1, returns 1 if the option is not set
+func parseRatio(opts *args.Options, name string) (float64, error) {
+	value := opts.String(name)
+	if value == "" {
+		return 1, nil
+	}
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return 0, errors.Errorf("invalid --%s '%s'; expected a number between 0 and 1", name, value)
+	}
+	return ratio, nil
+}
+
+// Limits and compression applied to requests made to '/api' and '/rpc'
+type HttpConfig struct {
+	// Requests with a larger body are rejected with '413 Request Entity Too Large'
+	MaxBodySize int64
+	// Responses smaller than this many bytes are not compressed
+	CompressMinSize int
+}
+
+var DefaultHttpConfig = HttpConfig{
+	MaxBodySize:     1 << 20,
+	CompressMinSize: 1024,
+}
+
+// How the service knows a request came through the gateway in front of it. The gateway authenticates users and
+// asserts their identity with the 'X-Howler-*' headers, and proves it is the gateway by sending the shared secret
+type GatewayConfig struct {
+	Secret string
+}
+
+// Returns true if `secret` is the gateway secret. Always false if no secret is configured, so identity headers
+// are never trusted by default
+func (self GatewayConfig) Verify(secret string) bool {
+	return self.Secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(self.Secret)) == 1
+}
+
+// Parses an option that must be a positive number, returns `def` if the option is not set
+func parseSize(opts *args.Options, name string, def int64) (int64, error) {
+	value := opts.String(name)
+	if value == "" {
+		return def, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 1 {
+		return 0, errors.Errorf("invalid --%s '%s'; expected a positive number of bytes", name, value)
+	}
+	return size, nil
+}
+
+// Build the http config from the '--max-body-size' and '--compress-min-size' options
+func NewHttpConfig(opts *args.Options) (HttpConfig, error) {
+	config := DefaultHttpConfig
+
+	var err error
+	if config.MaxBodySize, err = parseSize(opts, "max-body-size", config.MaxBodySize); err != nil {
+		return config, err
+	}
+	minSize, err := parseSize(opts, "compress-min-size", int64(config.CompressMinSize))
+	if err != nil {
+		return config, err
+	}
+	config.CompressMinSize = int(minSize)
+	return config, nil
+}
+
+// Build the access log config from the '--access-log-*' and '--trusted-proxies' options
+func NewAccessLogConfig(opts *args.Options) (AccessLogConfig, error) {
+	config := DefaultAccessLog
+
+	switch format := opts.String("access-log-format"); format {
+	case "":
+	case AccessLogJson, AccessLogCLF, AccessLogNone:
+		config.Format = format
+	default:
+		return config, errors.Errorf("unknown --access-log-format '%s'; expected 'json', 'clf' or 'none'", format)
+	}
+
+	var err error
+	if config.SampleRatio, err = parseRatio(opts, "access-log-sample-ratio"); err != nil {
+		return config, err
+	}
+	if config.TrustedProxies, err = ParseTrustedProxies(opts.String("trusted-proxies")); err != nil {
+		return config, errors.Wrap(err, "while parsing --trusted-proxies")
+	}
+	return config, nil
+}
+
+// Create the archive jobs, exports are written to '--archive-dir' or a directory in the system temp directory
+func NewJobs(opts *args.Options) (*archive.Jobs, error) {
+	dir := opts.String("archive-dir")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "howler-archives")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "while creating --archive-dir")
+	}
+	return archive.NewJobs(dir), nil
+}
+
+// Create the tracer selected by '--trace-exporter', returns nil if tracing is disabled
+func NewTracer(opts *args.Options) (*trace.Tracer, error) {
+	ratio, err := parseRatio(opts, "trace-sample-ratio")
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.String("trace-exporter") {
+	case "", "none":
+		return nil, nil
+	case "otlp":
+		endpoint := opts.String("trace-endpoint")
+		if endpoint == "" {
+			return nil, errors.New("--trace-exporter 'otlp' requires a --trace-endpoint")
+		}
+		return trace.NewTracer(trace.NewOTLPExporter(endpoint, "howler-api"), ratio), nil
+	case "stdout":
+		return trace.NewTracer(trace.NewWriterExporter(os.Stdout), ratio), nil
+	case "file":
+		exporter, err := trace.NewFileExporter(opts.String("trace-file"))
+		if err != nil {
+			return nil, err
+		}
+		return trace.NewTracer(exporter, ratio), nil
+	}
+	return nil, errors.Errorf("unknown --trace-exporter '%s'; expected 'otlp', 'stdout', 'file' or 'none'",
+		opts.String("trace-exporter"))
+}
+
+// Build the store routing table from the config. If no 'default' store backend is configured, the options in
+// the `[rethink]` group are used as the default backend
+func RouterConfig(opts *args.Options) store.RouterConfig {
+	config := store.RouterConfig{
+		Backends:  map[string]string{},
+		Teams:     map[string]string{},
+		SlowQuery: time.Duration(opts.Int("slow-query-ms")) * time.Millisecond,
+	}
+
+	for name, dsn := range opts.Group("store-backends").ToMap() {
+		config.Backends[name] = dsn.(string)
+	}
+	for teamId, name := range opts.Group("store-teams").ToMap() {
+		config.Teams[teamId] = name.(string)
+	}
+
+	if _, ok := config.Backends[store.DefaultBackend]; !ok {
+		config.Backends[store.DefaultBackend] = rethink.BuildDSN(opts.Group("rethink"))
+	}
+	return config
 }
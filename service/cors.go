@@ -0,0 +1,244 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/pkg/errors"
+	"github.com/pressly/chi"
+	"github.com/thrawn01/args"
+	"golang.org/x/net/context"
+)
+
+// Describes which browser origins may call the service, from the '[cors]' group of the config
+type CorsConfig struct {
+	// Exact origins IE: 'https://howler.chat', a wildcard subdomain IE: 'https://*.howler.chat' or '*' for any
+	// origin. CORS is disabled if empty
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// Response headers the browser lets the client read, in addition to the simple response headers
+	ExposedHeaders []string
+	// Allow the browser to send cookies and authorization headers
+	AllowCredentials bool
+	// How long in seconds the browser may cache a preflight response, 0 lets the browser decide
+	MaxAge int
+}
+
+var DefaultCors = CorsConfig{
+	AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+	AllowedHeaders: []string{"Accept", "Content-Type", "X-Request-Id"},
+	ExposedHeaders: []string{"X-Request-Id", "Deprecation", "Sunset"},
+}
+
+// Build the cors config from the '[cors]' group of the config
+//
+//	[cors]
+//	allowed-origins = https://howler.chat, https://*.howler.chat
+//	allowed-methods = GET, POST, OPTIONS
+//	allowed-headers = Accept, Content-Type, X-Request-Id
+//	exposed-headers = X-Request-Id, Deprecation, Sunset
+//	allow-credentials = true
+//	max-age = 600
+func NewCorsConfig(opts *args.Options) (CorsConfig, error) {
+	group := opts.Group("cors")
+	config := DefaultCors
+
+	config.AllowedOrigins = splitList(group.String("allowed-origins"))
+	if methods := splitList(group.String("allowed-methods")); len(methods) != 0 {
+		for i := range methods {
+			methods[i] = strings.ToUpper(methods[i])
+		}
+		config.AllowedMethods = methods
+	}
+	if headers := splitList(group.String("allowed-headers")); len(headers) != 0 {
+		for i := range headers {
+			headers[i] = http.CanonicalHeaderKey(headers[i])
+		}
+		config.AllowedHeaders = headers
+	}
+	if headers := splitList(group.String("exposed-headers")); len(headers) != 0 {
+		for i := range headers {
+			headers[i] = http.CanonicalHeaderKey(headers[i])
+		}
+		config.ExposedHeaders = headers
+	}
+
+	if value := group.String("allow-credentials"); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, errors.Errorf("invalid [cors] allow-credentials '%s'; expected 'true' or 'false'", value)
+		}
+		config.AllowCredentials = allow
+	}
+	if value := group.String("max-age"); value != "" {
+		maxAge, err := strconv.Atoi(value)
+		if err != nil || maxAge < 0 {
+			return config, errors.Errorf("invalid [cors] max-age '%s'; expected a number of seconds", value)
+		}
+		config.MaxAge = maxAge
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		if strings.Count(origin, "*") > 1 {
+			return config, errors.Errorf("invalid [cors] allowed-origins '%s'; only one wildcard is allowed", origin)
+		}
+		// Browsers refuse credentials when the allowed origin is '*'
+		if origin == "*" && config.AllowCredentials {
+			return config, errors.New("[cors] allowed-origins '*' can not be used with allow-credentials")
+		}
+	}
+	return config, nil
+}
+
+// Splits a comma separated list, ignoring empty items
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Returns the value of the 'Access-Control-Allow-Origin' header for `origin`, or "" if the origin is not allowed
+func (self *CorsConfig) allowOrigin(origin string) string {
+	lower := strings.ToLower(origin)
+	for _, allowed := range self.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" {
+			return "*"
+		}
+		if allowed == lower {
+			return origin
+		}
+
+		// Wildcard subdomains, IE: 'https://*.howler.chat' matches 'https://app.howler.chat'
+		star := strings.Index(allowed, "*")
+		if star == -1 {
+			continue
+		}
+		prefix, suffix := allowed[:star], allowed[star+1:]
+		if len(lower) > len(prefix)+len(suffix) && strings.HasPrefix(lower, prefix) &&
+			strings.HasSuffix(lower, suffix) && !strings.Contains(lower[len(prefix):len(lower)-len(suffix)], "/") {
+			return origin
+		}
+	}
+	return ""
+}
+
+// Returns true if `origin` is the scheme and host the request was sent to, IE: the page was served by us
+func sameOrigin(origin string, req *http.Request) bool {
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == req.Host
+}
+
+// Methods a browser may send cross origin without a preflight, that do not change anything
+func safeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+func (self *CorsConfig) allowMethod(method string) bool {
+	for _, allowed := range self.AllowedMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if every header in the 'Access-Control-Request-Headers' of a preflight is allowed
+func (self *CorsConfig) allowHeaders(requested string) bool {
+	for _, header := range splitList(requested) {
+		header = http.CanonicalHeaderKey(header)
+		allowed := false
+		for _, item := range self.AllowedHeaders {
+			if item == header {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Adds the CORS headers for browser clients from the origins in the config. Answers preflight requests with
+// '204 No Content', or '403 Forbidden' if the origin, method or headers requested are not allowed.
+//
+// Browsers send some cross origin POSTs (IE: a form or a 'text/plain' body) without a preflight, and hide only
+// the response. So requests that change something from an origin that is neither ours nor allowed are rejected
+// with '403 Forbidden' before they are handled
+func Cors(serviceCtx *ServiceContext) func(chi.Handler) chi.Handler {
+	return func(next chi.Handler) chi.Handler {
+		return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTPC(ctx, resp, req)
+				return
+			}
+			config := serviceCtx.Cors()
+			allowOrigin := config.allowOrigin(origin)
+
+			if allowOrigin == "" && !safeMethod(req.Method) && !sameOrigin(origin, req) {
+				writeError(ctx, resp, NewHttpError(ctx, http.StatusForbidden, nil,
+					"CORS request from '%s' with method '%s' not allowed", origin, req.Method))
+				return
+			}
+			if len(config.AllowedOrigins) == 0 {
+				next.ServeHTTPC(ctx, resp, req)
+				return
+			}
+
+			header := resp.Header()
+			header.Add("Vary", "Origin")
+
+			requestMethod := req.Header.Get("Access-Control-Request-Method")
+			if req.Method != "OPTIONS" || requestMethod == "" {
+				// Not a preflight, the browser hides the response from the client if the origin is not allowed
+				if allowOrigin != "" {
+					header.Set("Access-Control-Allow-Origin", allowOrigin)
+					if len(config.ExposedHeaders) != 0 {
+						header.Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+					}
+					if config.AllowCredentials {
+						header.Set("Access-Control-Allow-Credentials", "true")
+					}
+				}
+				next.ServeHTTPC(ctx, resp, req)
+				return
+			}
+
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			requestHeaders := req.Header.Get("Access-Control-Request-Headers")
+			if allowOrigin == "" || !config.allowMethod(requestMethod) || !config.allowHeaders(requestHeaders) {
+				writeError(ctx, resp, NewHttpError(ctx, http.StatusForbidden, nil,
+					"CORS request from '%s' with method '%s' and headers '%s' not allowed",
+					origin, requestMethod, requestHeaders))
+				return
+			}
+
+			header.Set("Access-Control-Allow-Origin", allowOrigin)
+			header.Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+			header.Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+			if config.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if config.MaxAge != 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+			}
+			resp.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/howler-chat/api-service/api"
+	"github.com/pkg/errors"
+	"github.com/thrawn01/args"
+)
+
+// The layout of the dates in the '[api-deprecations]' group of the config
+const deprecationDate = "2006-01-02"
+
+// The versions of the api the operator has deprecated, by version name
+type DeprecationConfig map[string]*api.Deprecation
+
+// Build the deprecations from the '[api-deprecations]' group of the config. The key is the version and the value
+// the date it was deprecated, '<version>-sunset' is the date the version will be removed
+//
+//	[api-deprecations]
+//	unversioned = 2026-10-19
+//	unversioned-sunset = 2027-04-19
+func NewDeprecationConfig(opts *args.Options) (DeprecationConfig, error) {
+	versions := map[string]*api.Version{api.Unversioned.Name: api.Unversioned}
+	for _, version := range api.Versions {
+		versions[version.Name] = version
+	}
+
+	config := DeprecationConfig{}
+	sunsets := map[string]time.Time{}
+	for key, value := range opts.Group("api-deprecations").ToMap() {
+		name := strings.TrimSuffix(key, "-sunset")
+		version, exists := versions[name]
+		if !exists {
+			return nil, errors.Errorf("invalid [api-deprecations] '%s'; no api version named '%s'", key, name)
+		}
+		date, err := time.Parse(deprecationDate, value.(string))
+		if err != nil {
+			return nil, errors.Errorf("invalid [api-deprecations] %s '%s'; expected a date like '2006-01-02'",
+				key, value)
+		}
+
+		if name != key {
+			sunsets[name] = date
+			continue
+		}
+		if version.Successor == "" {
+			return nil, errors.Errorf("invalid [api-deprecations] '%s'; the current version can not be deprecated",
+				key)
+		}
+		config[name] = &api.Deprecation{Since: date, Successor: version.Successor}
+	}
+
+	for name, sunset := range sunsets {
+		deprecation, exists := config[name]
+		if !exists {
+			return nil, errors.Errorf("invalid [api-deprecations] '%s-sunset'; '%s' is not deprecated", name, name)
+		}
+		if !sunset.After(deprecation.Since) {
+			return nil, errors.Errorf("invalid [api-deprecations] '%s-sunset'; must be after the deprecation", name)
+		}
+		deprecation.Sunset = sunset
+	}
+	return config, nil
+}
@@ -0,0 +1,318 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/howler-chat/api-service/api"
+	"github.com/howler-chat/api-service/auth"
+	. "github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/metrics"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/pb"
+	"github.com/howler-chat/api-service/realtime"
+	"github.com/howler-chat/api-service/trace"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/howler-chat/api-service/validate"
+	"github.com/pkg/errors"
+	"github.com/thrawn01/args"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The api endpoint each gRPC method is treated as when choosing the store consistency, IE: a GetMessage call
+// uses the consistency configured for 'message.get'
+var grpcEndpoints = map[string]string{
+	"/howler.Howler/PostMessage":      "message.post",
+	"/howler.Howler/GetMessage":       "message.get",
+	"/howler.Howler/ListMessages":     "message.list",
+	"/howler.Howler/SubscribeChannel": "channel.subscribe",
+}
+
+// Where and how the gRPC service listens, from the '--grpc-*' options
+type GrpcConfig struct {
+	// The interface to bind, gRPC is disabled if empty
+	Bind string
+	// If not nil, gRPC is served with TLS and (if '--grpc-client-ca' is set) requires a client certificate
+	TLS *tls.Config
+}
+
+// Build the gRPC config from the '--grpc-*' options. The gateway secret and identity metadata would be readable by
+// anyone on the network, so binding anything other than a loopback interface requires TLS
+func NewGrpcConfig(opts *args.Options) (GrpcConfig, error) {
+	config := GrpcConfig{Bind: opts.String("grpc-bind")}
+	if config.Bind == "" {
+		return config, nil
+	}
+
+	if opts.String("grpc-tls-cert") != "" || opts.String("grpc-tls-key") != "" {
+		var err error
+		config.TLS, err = newServerTLS(opts, "grpc")
+		return config, err
+	}
+	if opts.String("grpc-client-ca") != "" {
+		return config, errors.New("--grpc-client-ca requires --grpc-tls-cert and --grpc-tls-key")
+	}
+
+	host, _, err := net.SplitHostPort(config.Bind)
+	if err != nil {
+		return config, errors.Wrapf(err, "invalid --grpc-bind '%s'", config.Bind)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return config, errors.Errorf("--grpc-bind '%s' is not a loopback interface and requires "+
+			"--grpc-tls-cert and --grpc-tls-key", config.Bind)
+	}
+	return config, nil
+}
+
+// Returns a gRPC server for the Howler service in howler.proto, backed by the same api as the http service
+func NewGrpcServer(serviceCtx *ServiceContext) *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpcUnaryInterceptor(serviceCtx)),
+		grpc.StreamInterceptor(grpcStreamInterceptor(serviceCtx)),
+	}
+	if serviceCtx.Grpc.TLS != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(serviceCtx.Grpc.TLS)))
+	}
+	server := grpc.NewServer(options...)
+	pb.RegisterHowlerServer(server, &grpcServer{})
+	return server
+}
+
+// Prepares the context of a gRPC call the same way the http middleware prepares the context of a request
+func grpcSetup(serviceCtx *ServiceContext, ctx context.Context, method string) (context.Context, *trace.Span, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if values := md.Get(key); len(values) != 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	requestId := get("x-request-id")
+	if requestId == "" {
+		requestId = utils.NewId()
+	}
+	ctx = utils.AddRequestId(ctx, requestId)
+
+	// Same as Authenticate(), only the gateway may assert the identity of the user
+	if get("x-howler-user-id") != "" || get("x-howler-team-id") != "" || get("x-howler-scopes") != "" {
+		if !serviceCtx.Gateway.Verify(get("x-howler-gateway-secret")) {
+			return ctx, nil, status.Error(codes.Unauthenticated, "Identity metadata is only accepted from the gateway")
+		}
+		ctx = auth.AddPrincipal(ctx, &auth.Principal{
+			UserId: get("x-howler-user-id"),
+			TeamId: get("x-howler-team-id"),
+			Scopes: parseScopes(get("x-howler-scopes")),
+		})
+	}
+
+	var span *trace.Span
+	if serviceCtx.Tracer != nil {
+		parent, _ := trace.ParseTraceParent(get(trace.TraceParentHeader))
+		ctx, span = serviceCtx.Tracer.StartServerSpan(ctx, method, parent)
+		span.SetAttribute("rpc.system", "grpc")
+		span.SetAttribute("rpc.method", method)
+		span.SetAttribute("howler.request_id", requestId)
+	}
+
+	ctx, err := serviceCtx.Setup(ctx, grpcEndpoints[method])
+	if err != nil {
+		return ctx, span, toStatus(err)
+	}
+	return ctx, span, nil
+}
+
+// Records the metrics and finishes the span of a gRPC call
+func grpcFinish(method string, span *trace.Span, start time.Time, err error) {
+	code := status.Code(err)
+	metrics.GRPCRequestCount.WithLabelValues(method, code.String()).Inc()
+	metrics.GRPCRequestDuration.WithLabelValues(method, code.String()).Observe(time.Since(start).Seconds())
+
+	span.SetAttribute("rpc.grpc.status_code", code.String())
+	if code == codes.Internal || code == codes.Unavailable || code == codes.Unknown {
+		span.SetError(err)
+	}
+	span.Finish()
+}
+
+func grpcUnaryInterceptor(serviceCtx *ServiceContext) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, span, err := grpcSetup(serviceCtx, ctx, info.FullMethod)
+		if err != nil {
+			grpcFinish(info.FullMethod, span, start, err)
+			return nil, err
+		}
+
+		// Same limit as requests to '/api'
+		ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+
+		resp, err := handler(ctx, req)
+		grpcFinish(info.FullMethod, span, start, err)
+		return resp, err
+	}
+}
+
+func grpcStreamInterceptor(serviceCtx *ServiceContext) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, span, err := grpcSetup(serviceCtx, stream.Context(), info.FullMethod)
+		if err != nil {
+			grpcFinish(info.FullMethod, span, start, err)
+			return err
+		}
+
+		open := metrics.GRPCStreamsOpen.WithLabelValues(info.FullMethod)
+		open.Inc()
+		defer open.Dec()
+
+		// Streams are long lived, so unlike unary calls they have no time limit
+		err = handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+		grpcFinish(info.FullMethod, span, start, err)
+		return err
+	}
+}
+
+// Replaces the context of a stream with the context prepared by grpcSetup()
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (self *contextStream) Context() context.Context {
+	return self.ctx
+}
+
+// Convert an api error into a gRPC status, the message is the same the http client would receive
+func toStatus(err HttpError) error {
+	code := codes.Unknown
+	switch err.GetCode() {
+	case http.StatusBadRequest, http.StatusNotAcceptable:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusGatewayTimeout:
+		code = codes.DeadlineExceeded
+	case http.StatusInternalServerError:
+		code = codes.Internal
+	}
+	return status.Error(code, err.GetMessage())
+}
+
+// Implements pb.HowlerServer by invoking the api methods, which authorize and validate the request
+type grpcServer struct{}
+
+// Invoke the api method, the result is the model returned by the HowlerApi
+func invokeApi(ctx context.Context, name string, request api.Request) (interface{}, error) {
+	result, err := api.Methods.Get(name).Invoke(ctx, request)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return result, nil
+}
+
+func (self *grpcServer) PostMessage(ctx context.Context, in *pb.Message) (*pb.PostMessageResponse, error) {
+	msg := model.Message{ChannelId: in.ChannelId, Text: in.Text}
+	result, err := invokeApi(ctx, "message.post", &msg)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PostMessageResponse{Id: result.(*model.Message).Id}, nil
+}
+
+func (self *grpcServer) GetMessage(ctx context.Context, in *pb.GetMessageRequest) (*pb.Message, error) {
+	request := model.GetMessageRequest{MessageId: in.MessageId, ChannelId: in.ChannelId}
+	result, err := invokeApi(ctx, "message.get", &request)
+	if err != nil {
+		return nil, err
+	}
+	return toPbMessage(result.(*model.Message)), nil
+}
+
+func (self *grpcServer) ListMessages(ctx context.Context, in *pb.ListMessageRequest) (*pb.MessageList, error) {
+	request := model.ListMessageRequest{ChannelId: in.ChannelId}
+	result, err := invokeApi(ctx, "message.list", &request)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := result.([]model.Message)
+	list := &pb.MessageList{}
+	for i := range messages {
+		list.Messages = append(list.Messages, toPbMessage(&messages[i]))
+	}
+	return list, nil
+}
+
+// Known limitation; the realtime.Hub is per process, so subscribers only receive messages posted to this instance
+func (self *grpcServer) SubscribeChannel(in *pb.SubscribeChannelRequest, stream pb.Howler_SubscribeChannelServer) error {
+	ctx := stream.Context()
+
+	if err := validate.IsValidId(in.ChannelId); err != nil {
+		return status.Errorf(codes.InvalidArgument, "Validation Failed on 'channelId' - '%s'", err.Error())
+	}
+	principal, err := auth.GetPrincipal(ctx)
+	if err != nil {
+		return toStatus(err)
+	}
+	if err := auth.CanAccessChannel(ctx, in.ChannelId); err != nil {
+		return toStatus(api.ToHttpError(ctx, err))
+	}
+
+	hub := realtime.GetHub(ctx)
+	if hub == nil {
+		return status.Error(codes.Unimplemented, "Realtime delivery of messages is not enabled")
+	}
+	sub := hub.Subscribe(in.ChannelId, principal.UserId)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-sub.Messages:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "Subscriber fell too far behind, re-subscribe")
+			}
+			if err := stream.Send(toPbMessage(msg)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toPbMessage(msg *model.Message) *pb.Message {
+	result := &pb.Message{
+		Id:        msg.Id,
+		ChannelId: msg.ChannelId,
+		UserId:    msg.UserId,
+		Text:      msg.Text,
+	}
+	if createdAt, err := ptypes.TimestampProto(msg.CreatedAt); err == nil {
+		result.CreatedAt = createdAt
+	}
+	return result
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service_test
+
+import (
+	"net"
+
+	"github.com/howler-chat/api-service/pb"
+	"github.com/howler-chat/api-service/service"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("gRPC", func() {
+	var serviceCtx *service.ServiceContext
+	var server *grpc.Server
+	var conn *grpc.ClientConn
+	var client pb.HowlerClient
+
+	const channelId = "C000000001"
+
+	// Authenticate as the gateway would
+	authCtx := func() context.Context {
+		return metadata.NewOutgoingContext(context.Background(),
+			metadata.Pairs("x-howler-user-id", "U000000001", "x-howler-team-id", "T000000001",
+				"x-howler-gateway-secret", "g4teway"))
+	}
+
+	BeforeEach(func() {
+		parser := service.ParseRethinkArgs(nil)
+		_, err := parser.ParseIni([]byte("gateway-secret = g4teway\n[store-backends]\ndefault = sqlite:///:memory:\n"))
+		Expect(err).To(BeNil())
+		serviceCtx = service.NewServiceContext(parser)
+		Expect(serviceCtx.Start()).To(Succeed())
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		server = service.NewGrpcServer(serviceCtx)
+		go server.Serve(listener)
+
+		conn, err = grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+		Expect(err).To(BeNil())
+		client = pb.NewHowlerClient(conn)
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		server.Stop()
+		serviceCtx.Stop()
+	})
+
+	It("should post, get and list messages", func() {
+		posted, err := client.PostMessage(authCtx(), &pb.Message{ChannelId: channelId, Text: "Hello gRPC"})
+		Expect(err).To(BeNil())
+		Expect(posted.Id).NotTo(BeEmpty())
+
+		msg, err := client.GetMessage(authCtx(), &pb.GetMessageRequest{MessageId: posted.Id, ChannelId: channelId})
+		Expect(err).To(BeNil())
+		Expect(msg.Text).To(Equal("Hello gRPC"))
+		Expect(msg.UserId).To(Equal("U000000001"))
+		Expect(msg.CreatedAt.Seconds).NotTo(BeZero())
+
+		list, err := client.ListMessages(authCtx(), &pb.ListMessageRequest{ChannelId: channelId})
+		Expect(err).To(BeNil())
+		Expect(len(list.Messages)).To(Equal(1))
+		Expect(list.Messages[0].Id).To(Equal(posted.Id))
+	})
+
+	It("should map api errors to status codes", func() {
+		_, err := client.GetMessage(authCtx(), &pb.GetMessageRequest{MessageId: "M000000001", ChannelId: channelId})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+		Expect(status.Convert(err).Message()).To(Equal("Message 'M000000001' not found"))
+
+		_, err = client.PostMessage(context.Background(), &pb.Message{ChannelId: channelId, Text: "Anonymous"})
+		Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+
+		// Only the gateway may assert who the caller is
+		forged := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-howler-user-id", "U000000001"))
+		_, err = client.PostMessage(forged, &pb.Message{ChannelId: channelId, Text: "Forged"})
+		Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+	})
+
+	It("should require TLS to bind gRPC to an interface other than loopback", func() {
+		newConfig := func(ini string) (service.GrpcConfig, error) {
+			parser := service.ParseRethinkArgs(nil)
+			opts, err := parser.ParseIni([]byte(ini))
+			Expect(err).To(BeNil())
+			return service.NewGrpcConfig(opts)
+		}
+
+		config, err := newConfig("grpc-bind = 127.0.0.1:8081\n")
+		Expect(err).To(BeNil())
+		Expect(config.TLS).To(BeNil())
+
+		_, err = newConfig("grpc-bind = 0.0.0.0:8081\n")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("requires --grpc-tls-cert"))
+	})
+
+	It("should stream messages posted to a subscribed channel", func() {
+		ctx, cancel := context.WithCancel(authCtx())
+		defer cancel()
+
+		stream, err := client.SubscribeChannel(ctx, &pb.SubscribeChannelRequest{ChannelId: channelId})
+		Expect(err).To(BeNil())
+		Eventually(func() int { return serviceCtx.Hub.Subscribers(channelId) }).Should(Equal(1))
+
+		posted, err := client.PostMessage(authCtx(), &pb.Message{ChannelId: channelId, Text: "Realtime"})
+		Expect(err).To(BeNil())
+
+		msg, err := stream.Recv()
+		Expect(err).To(BeNil())
+		Expect(msg.Id).To(Equal(posted.Id))
+		Expect(msg.Text).To(Equal("Realtime"))
+
+		cancel()
+		Eventually(func() int { return serviceCtx.Hub.Subscribers(channelId) }).Should(Equal(0))
+	})
+})
@@ -12,94 +12,255 @@ package service
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"golang.org/x/net/context"
 
+	"github.com/howler-chat/api-service/utils"
 	"github.com/oxtoacart/bpool"
+	"github.com/pkg/errors"
 	"github.com/pressly/chi"
-	"github.com/pressly/chi/middleware"
 )
 
-var bufferPool bpool.BufferPool
+var bufferPool = bpool.NewBufferPool(64)
 
-func Logger(next chi.Handler) chi.Handler {
-	return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
-		buf := bufferPool.Get()
+const (
+	AccessLogJson = "json"
+	AccessLogCLF  = "clf"
+	AccessLogNone = "none"
+)
 
-		// TODO: Parse X-Forward-Host if present
+// Common Log Format time layout
+const clfTime = "02/Jan/2006:15:04:05 -0700"
 
-		// Add the client remote address
-		remoteAddress, _, err := net.SplitHostPort(req.RemoteAddr)
-		if err != nil {
-			remoteAddress = req.RemoteAddr
+// Describes how requests are written to the access log
+type AccessLogConfig struct {
+	// One of 'json', 'clf' or 'none'
+	Format string
+	// The 'X-Forwarded-For' header is only believed if it was added by one of these networks
+	TrustedProxies []*net.IPNet
+	// The fraction of 2xx responses that are logged, every other response is always logged
+	SampleRatio float64
+	Writer      io.Writer
+}
+
+var DefaultAccessLog = AccessLogConfig{
+	Format:      AccessLogCLF,
+	SampleRatio: 1,
+	Writer:      os.Stdout,
+}
+
+type contextKey int
+
+const (
+	accessDetailKey contextKey = 0
+	adminKey        contextKey = 1
+)
+
+// Details about the request only known to handlers further down the chain
+type accessDetail struct {
+	UserId string
+	Route  string
+}
+
+type accessEntry struct {
+	Time      string  `json:"time"`
+	ClientIp  string  `json:"clientIp"`
+	UserId    string  `json:"userId,omitempty"`
+	RequestId string  `json:"requestId,omitempty"`
+	Method    string  `json:"method"`
+	Uri       string  `json:"uri"`
+	Proto     string  `json:"proto"`
+	Route     string  `json:"route,omitempty"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+func addAccessDetail(ctx context.Context, detail *accessDetail) context.Context {
+	return context.WithValue(ctx, accessDetailKey, detail)
+}
+
+// Returns the access details of the request, if the request is not logged the details are discarded
+func getAccessDetail(ctx context.Context) *accessDetail {
+	if detail, ok := ctx.Value(accessDetailKey).(*accessDetail); ok {
+		return detail
+	}
+	return &accessDetail{}
+}
+
+// Writes an entry to the access log for each request. In 'clf' mode the request id, route and latency in
+// milliseconds are appended to the standard Common Log Format fields
+func AccessLogger(config AccessLogConfig) func(chi.Handler) chi.Handler {
+	var mutex sync.Mutex
+	writer := config.Writer
+	if writer == nil {
+		writer = os.Stdout
+	}
+
+	return func(next chi.Handler) chi.Handler {
+		if config.Format == AccessLogNone {
+			return next
 		}
+		return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+			detail := &accessDetail{}
+			// Wrap the ResponseWriter so we can capture the Status() and BytesWritten()
+			wrapResp := wrapWriter(resp)
 
-		buf.WriteString(remoteAddress)
-		buf.WriteString(" - ")
+			// Run the handler
+			startTime := time.Now()
+			next.ServeHTTPC(addAccessDetail(ctx, detail), wrapResp, req)
+			elapsed := time.Since(startTime)
 
-		// Add the authenticated user (if none then '-')
-		if req.URL.User != nil {
-			if name := req.URL.User.Username(); name != "" {
-				buf.WriteString(name)
+			status := wrapResp.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			// Successful requests make up most of our traffic, only log a sample of them
+			if status >= 200 && status < 300 && config.SampleRatio < 1 && rand.Float64() >= config.SampleRatio {
+				return
+			}
+
+			entry := accessEntry{
+				ClientIp:  clientIp(req, config.TrustedProxies),
+				UserId:    detail.UserId,
+				RequestId: utils.GetRequestId(ctx),
+				Method:    req.Method,
+				Uri:       req.URL.RequestURI(),
+				Proto:     req.Proto,
+				Route:     detail.Route,
+				Status:    status,
+				Bytes:     wrapResp.BytesWritten(),
+				LatencyMs: float64(elapsed) / float64(time.Millisecond),
+			}
+
+			buf := bufferPool.Get()
+			if config.Format == AccessLogJson {
+				entry.Time = startTime.Format(time.RFC3339Nano)
+				if payload, err := json.Marshal(&entry); err == nil {
+					buf.Write(payload)
+				}
 			} else {
-				buf.WriteString("-")
+				writeCLF(buf, &entry, startTime)
 			}
-		} else {
-			buf.WriteString("-")
+			buf.WriteByte('\n')
+
+			mutex.Lock()
+			writer.Write(buf.Bytes())
+			mutex.Unlock()
+			bufferPool.Put(buf)
+		})
+	}
+}
+
+func writeCLF(buf *bytes.Buffer, entry *accessEntry, startTime time.Time) {
+	var scratch [64]byte
+
+	buf.WriteString(dashIfEmpty(entry.ClientIp))
+	buf.WriteString(" - ")
+	buf.WriteString(dashIfEmpty(entry.UserId))
+	buf.WriteString(" [")
+	buf.Write(startTime.AppendFormat(scratch[:0], clfTime))
+	buf.WriteString("] \"")
+	buf.WriteString(entry.Method)
+	buf.WriteString(" ")
+	buf.WriteString(entry.Uri)
+	buf.WriteString(" ")
+	buf.WriteString(entry.Proto)
+	buf.WriteString("\" ")
+	buf.WriteString(strconv.Itoa(entry.Status))
+	buf.WriteString(" ")
+	buf.WriteString(strconv.Itoa(entry.Bytes))
+	buf.WriteString(" ")
+	buf.WriteString(dashIfEmpty(entry.RequestId))
+	buf.WriteString(" ")
+	buf.WriteString(dashIfEmpty(entry.Route))
+	buf.WriteString(" ")
+	buf.Write(strconv.AppendFloat(scratch[:0], entry.LatencyMs, 'f', 3, 64))
+}
+
+func dashIfEmpty(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Returns the address of the client. If the request came from a trusted proxy, 'X-Forwarded-For' is walked from
+// the closest proxy back until we find an address we don't trust, that address is the client.
+func clientIp(req *http.Request, trusted []*net.IPNet) string {
+	remoteAddress, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remoteAddress = req.RemoteAddr
+	}
+	if !isTrusted(remoteAddress, trusted) {
+		return remoteAddress
+	}
+
+	forwarded := strings.Split(strings.Join(req.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if address == "" {
+			continue
+		}
+		// Anything before a malformed entry could have been made up by the client
+		if net.ParseIP(address) == nil {
+			break
 		}
+		remoteAddress = address
+		if !isTrusted(address, trusted) {
+			break
+		}
+	}
+	return remoteAddress
+}
 
-		// Time
-		buf.WriteString(" [")
-		// TODO: Use AppendFormat to avoid allocated a new buffer on each Format() call
-		buf.WriteString(time.Now().Format("01/Jan/2015:01:01:01 -0600"))
-		buf.WriteString("] ")
-		// Http Verb
-		buf.WriteString(" ")
-		buf.WriteString(req.Method)
-		// Uri
-		buf.WriteString(" ")
-		buf.WriteString(req.URL.RequestURI())
-		buf.WriteString(" ")
-		// Proto
-		buf.WriteString(req.Proto)
-		buf.WriteString(" ")
-
-		// Wrap the ResponseWriter so we can capture the Status() and BytesWritten()
-		wrapResp := wrapWriter(resp)
-
-		// Run the handler
-		startTime := time.Now()
-		next.ServeHTTPC(ctx, wrapResp, req)
-		stopTime := time.Now()
-
-		// Time Elapsed
-		elapsed := stopTime.Sub(startTime)
-		buf.WriteString(elapsed.String())
-		buf.WriteString(" ")
-
-		// Status and Payload Size
-		status := wrapResp.Status()
-		if status == middleware.StatusClientClosedRequest {
-			buf.WriteString("[disconnected]")
-		} else {
-			// Status Code
-			buf.WriteString(strconv.Itoa(status))
-			buf.WriteString(" ")
-			// Result Size
-			buf.WriteString(strconv.Itoa(wrapResp.BytesWritten()))
+func isTrusted(address string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
 		}
+	}
+	return false
+}
 
-		// Write out the log entry
-		log.Info(buf)
-		// Put the buffer back into the pool
-		bufferPool.Put(buf)
-	})
+// Parses a comma separated list of networks, IE: '10.0.0.0/8, 192.168.1.10'. Addresses without a mask are
+// treated as a single host
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, errors.Errorf("invalid trusted proxy '%s'", item)
+		}
+		result = append(result, network)
+	}
+	return result, nil
 }
 
 // writerProxy is a proxy around an http.ResponseWriter that allows you to hook
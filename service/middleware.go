@@ -1,15 +1,24 @@
 package service
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"path"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/howler-chat/api-service/api"
+	"github.com/howler-chat/api-service/auth"
+	"github.com/howler-chat/api-service/codec"
+	"github.com/howler-chat/api-service/errors"
 	"github.com/howler-chat/api-service/metrics"
-	"github.com/howler-chat/api-service/store"
-	"github.com/howler-chat/api-service/store/rethink"
+	"github.com/howler-chat/api-service/trace"
+	"github.com/howler-chat/api-service/utils"
 	"github.com/pressly/chi"
 	"golang.org/x/net/context"
 )
@@ -28,6 +37,19 @@ func PanicRecoverer(next chi.Handler) chi.Handler {
 	})
 }
 
+// Assigns an id to the request, such that logs and errors for the same request can be matched up. If the gateway
+// in front of the service provided an 'X-Request-Id' it is used instead
+func RequestId(next chi.Handler) chi.Handler {
+	return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		requestId := req.Header.Get("X-Request-Id")
+		if requestId == "" {
+			requestId = utils.NewId()
+		}
+		resp.Header().Set("X-Request-Id", requestId)
+		next.ServeHTTPC(utils.AddRequestId(ctx, requestId), resp, req)
+	})
+}
+
 // Sets the 'Content-Type' to 'application/json'
 func MimeJson(next chi.Handler) chi.Handler {
 	return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
@@ -37,37 +59,187 @@ func MimeJson(next chi.Handler) chi.Handler {
 	})
 }
 
-// Records request count, and latency
-func RecordMetrics(next chi.Handler) chi.Handler {
+// Chooses the codec used to decode the request from the 'Content-Type' and the codec used to encode the response
+// from the 'Accept' header of the request. JSON is used if the client has no preference
+func Negotiate(next chi.Handler) chi.Handler {
 	return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
-		// TODO: Record some metrics about the request
+		response := codec.Negotiate(req.Header.Get("Accept"))
+		resp.Header().Set("Content-Type", response.ContentType())
+		resp.Header().Add("Vary", "Accept")
 
-		metrics.HTTPRequestCount.WithLabelValues(req.Method, req.URL.Path).Inc()
-		startTime := time.Now()
+		ctx = codec.AddCodecs(ctx, codec.ForContentType(req.Header.Get("Content-Type")), response)
 		next.ServeHTTPC(ctx, resp, req)
-		stopTime := time.Now()
-
-		elapsed := stopTime.Sub(startTime)
-		metrics.HTTPRequestLatency.WithLabelValues(req.Method, req.URL.Path).
-			Observe(float64(elapsed) / float64(time.Millisecond))
 	})
 }
 
-func SetupContext(serviceCtx *ServiceContext) func(chi.Handler) chi.Handler {
+// Reads the request body before it is decoded, rejecting bodies larger than `maxSize` with
+// '413 Request Entity Too Large'. Such that a client can not exhaust our memory with an endless body
+func LimitBody(maxSize int64) func(chi.Handler) chi.Handler {
+	return func(next chi.Handler) chi.Handler {
+		return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > maxSize {
+				req.Body.Close()
+				writeError(ctx, resp, errors.HttpErrorRequestTooLarge(ctx, maxSize))
+				return
+			}
+
+			// The 'Content-Length' is not required, so read one more byte than we allow to detect a larger body
+			payload, err := ioutil.ReadAll(io.LimitReader(req.Body, maxSize+1))
+			req.Body.Close()
+			if err != nil {
+				writeError(ctx, resp, errors.NewHttpError(ctx, http.StatusBadRequest, nil,
+					"Failed to read request - %s", err.Error()))
+				return
+			}
+			if int64(len(payload)) > maxSize {
+				writeError(ctx, resp, errors.HttpErrorRequestTooLarge(ctx, maxSize))
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(payload))
+			next.ServeHTTPC(ctx, resp, req)
+		})
+	}
+}
+
+// Records request count, latency, size and the number of requests in flight. The metrics are labeled with
+// `route` instead of the request path, such that unknown paths can't create new label values
+func RecordMetrics(route string) func(chi.Handler) chi.Handler {
+	return func(next chi.Handler) chi.Handler {
+		return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+			inFlight := metrics.HTTPRequestsInFlight.WithLabelValues(route)
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			if req.ContentLength >= 0 {
+				metrics.HTTPRequestSize.WithLabelValues(route, req.Method).Observe(float64(req.ContentLength))
+			}
+
+			// Wrap the ResponseWriter so we can capture the Status() and BytesWritten()
+			wrapResp := wrapWriter(resp)
+
+			startTime := time.Now()
+			next.ServeHTTPC(ctx, wrapResp, req)
+			elapsed := time.Since(startTime)
+
+			code := wrapResp.Status()
+			if code == 0 {
+				code = http.StatusOK
+			}
+			status := strconv.Itoa(code)
+
+			metrics.HTTPRequestCount.WithLabelValues(route, req.Method, status).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(route, req.Method, status).Observe(elapsed.Seconds())
+			metrics.HTTPResponseSize.WithLabelValues(route, req.Method, status).
+				Observe(float64(wrapResp.BytesWritten()))
+		})
+	}
+}
+
+// Starts a server span for each request, named after the route. If the caller sent a 'traceparent' header the span
+// continues the callers trace. Does nothing if tracer is nil
+func TraceRequest(tracer *trace.Tracer, route string) func(chi.Handler) chi.Handler {
+	return func(next chi.Handler) chi.Handler {
+		if tracer == nil {
+			return next
+		}
+		return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+			ctx, span := tracer.StartServerSpan(ctx, route, trace.Extract(req.Header))
+			span.SetAttribute("http.method", req.Method)
+			span.SetAttribute("http.route", route)
+			span.SetAttribute("http.target", req.URL.Path)
+			span.SetAttribute("howler.request_id", utils.GetRequestId(ctx))
+
+			wrapResp := wrapWriter(resp)
+			next.ServeHTTPC(ctx, wrapResp, req)
+
+			code := wrapResp.Status()
+			if code == 0 {
+				code = http.StatusOK
+			}
+			span.SetAttribute("http.status_code", strconv.Itoa(code))
+			if code >= 500 {
+				span.SetError(fmt.Errorf("%d %s", code, http.StatusText(code)))
+			}
+			span.Finish()
+		})
+	}
+}
+
+// Records metrics, traces and names the route in the access log for each request to the route
+func Instrument(serviceCtx *ServiceContext, route string) func(chi.Handler) chi.Handler {
+	recordMetrics := RecordMetrics(route)
+	traceRequest := TraceRequest(serviceCtx.Tracer, route)
 	return func(next chi.Handler) chi.Handler {
+		handler := recordMetrics(traceRequest(next))
 		return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+			getAccessDetail(ctx).Route = route
+			handler.ServeHTTPC(ctx, resp, req)
+		})
+	}
+}
 
-			// TODO: At some point we will have some logic here to decide what rethink session should be
-			// associated with this request, (probably based on user or team)
-			ctx = rethink.AddRethinkSession(ctx, serviceCtx.RethinkContext.GetRethinkSession())
+// The gateway sends the '--gateway-secret' in this header with every request
+const GatewaySecretHeader = "X-Howler-Gateway-Secret"
 
-			// TODO: If in the future we migrate teams to a different store (mongodb?) we would have logic
-			// here to decide what Store interface to use for this request, right now we always use rethink
-			ctx = store.AddStore(ctx, serviceCtx.Store)
+// The headers the gateway asserts the identity of the user with
+var identityHeaders = []string{"X-Howler-User-Id", "X-Howler-Team-Id", "X-Howler-Scopes"}
 
-			// Same for API
-			ctx = api.AddApi(ctx, serviceCtx.Api)
+// Identifies the user making the request and adds the principal to the context. The identity is asserted by the
+// gateway in front of the service, requests with identity headers that don't carry the gateway secret are rejected
+func Authenticate(serviceCtx *ServiceContext) func(chi.Handler) chi.Handler {
+	return func(next chi.Handler) chi.Handler {
+		return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+			asserted := false
+			for _, header := range identityHeaders {
+				asserted = asserted || req.Header.Get(header) != ""
+			}
+			if !asserted {
+				next.ServeHTTPC(ctx, resp, req)
+				return
+			}
 
+			if !serviceCtx.Gateway.Verify(req.Header.Get(GatewaySecretHeader)) {
+				log.WithFields(log.Fields{
+					"type":      "auth",
+					"requestId": utils.GetRequestId(ctx),
+					"remote":    req.RemoteAddr,
+				}).Warn("Rejected identity headers without the gateway secret")
+				writeError(ctx, resp, errors.NewHttpError(ctx, http.StatusUnauthorized, nil,
+					"Identity headers are only accepted from the gateway"))
+				return
+			}
+
+			userId := req.Header.Get("X-Howler-User-Id")
+			getAccessDetail(ctx).UserId = userId
+			ctx = auth.AddPrincipal(ctx, &auth.Principal{
+				UserId: userId,
+				TeamId: req.Header.Get("X-Howler-Team-Id"),
+				Scopes: parseScopes(req.Header.Get("X-Howler-Scopes")),
+			})
+			next.ServeHTTPC(ctx, resp, req)
+		})
+	}
+}
+
+// Scopes are separated by spaces or commas, IE: 'admin audit:read'
+func parseScopes(header string) []string {
+	return strings.FieldsFunc(header, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+func SetupContext(serviceCtx *ServiceContext) func(chi.Handler) chi.Handler {
+	return func(next chi.Handler) chi.Handler {
+		return chi.HandlerFunc(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+			// The durability and read mode requested for this endpoint, IE: 'message.get' for both
+			// '/api/message.get' and '/api/v1/message.get'
+			endpoint := path.Base(req.URL.Path)
+
+			ctx, err := serviceCtx.Setup(ctx, endpoint)
+			if err != nil {
+				writeError(ctx, resp, err)
+				return
+			}
 			next.ServeHTTPC(ctx, resp, req)
 		})
 	}
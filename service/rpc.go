@@ -0,0 +1,112 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/rpc"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/pressly/chi"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+)
+
+// The largest JSON-RPC message we accept from a websocket client
+const maxRpcMessage = 1 << 20
+
+// Returns a JSON-RPC server for the HowlerApi, each call uses the store consistency of the endpoint it names
+func NewRpcServer(serviceCtx *ServiceContext) *rpc.Server {
+	server := rpc.NewServer(rpc.NewApiRegistry())
+	server.Context = func(ctx context.Context, method string) context.Context {
+		return store.AddConsistency(ctx, serviceCtx.Consistency(method))
+	}
+	return server
+}
+
+// Handles a JSON-RPC call or batch POSTed to '/rpc'. If the request only contained notifications we reply with
+// '204 No Content'
+func RpcPost(server *rpc.Server) chi.HandlerFunc {
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		payload, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			httpErr := errors.NewHttpError(ctx, http.StatusBadRequest, nil, "Failed to read request - %s", err.Error())
+			resp.WriteHeader(httpErr.GetCode())
+			resp.Write(httpErr.ToJson())
+			return
+		}
+
+		reply := server.Handle(ctx, payload)
+		if reply == nil {
+			resp.WriteHeader(http.StatusNoContent)
+			return
+		}
+		resp.Write(reply)
+	}
+}
+
+// Upgrades a GET of '/rpc' to a websocket. Each message received is a JSON-RPC call or batch, replies are sent in
+// the order the calls were received
+func RpcWebSocket(serviceCtx *ServiceContext, server *rpc.Server) chi.HandlerFunc {
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		wsServer := websocket.Server{Handshake: checkOrigin(serviceCtx), Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = maxRpcMessage
+			defer conn.Close()
+
+			for {
+				var payload []byte
+				if err := websocket.Message.Receive(conn, &payload); err != nil {
+					return
+				}
+
+				// Each message is a request of its own; with a request id and the same time limit as '/api'
+				msgCtx, cancel := context.WithTimeout(utils.AddRequestId(ctx, utils.NewId()), requestTimeout)
+				reply := server.Handle(msgCtx, payload)
+				cancel()
+
+				if reply == nil {
+					continue
+				}
+				if err := websocket.Message.Send(conn, string(reply)); err != nil {
+					log.WithField("requestId", utils.GetRequestId(ctx)).
+						Debugf("RPC websocket closed - %s", err.Error())
+					return
+				}
+			}
+		}}
+		wsServer.ServeHTTP(resp, req)
+	}
+}
+
+// Browsers do not apply CORS to websockets, a page on any site could open one with the credentials of the user.
+// Handshakes with an 'Origin' are only accepted from our own host or the allowed origins of the '[cors]' config,
+// anything else is answered with '403 Forbidden'
+func checkOrigin(serviceCtx *ServiceContext) func(*websocket.Config, *http.Request) error {
+	return func(config *websocket.Config, req *http.Request) error {
+		origin := req.Header.Get("Origin")
+		// Not a browser
+		if origin == "" {
+			return nil
+		}
+		if sameOrigin(origin, req) {
+			return nil
+		}
+		cors := serviceCtx.Cors()
+		if cors.allowOrigin(origin) != "" {
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"type":   "cors",
+			"origin": origin,
+		}).Warn("Rejected websocket handshake from an origin that is not allowed")
+		return fmt.Errorf("websocket origin '%s' not allowed", origin)
+	}
+}
@@ -6,16 +6,23 @@ package service
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"golang.org/x/net/context"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/howler-chat/api-service/api"
+	"github.com/howler-chat/api-service/codec"
 	"github.com/howler-chat/api-service/errors"
+	"github.com/howler-chat/api-service/metrics"
 	"github.com/pressly/chi"
 	"github.com/pressly/chi/middleware"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thrawn01/args"
 )
 
@@ -24,83 +31,220 @@ func Serve(parser *args.ArgParser) error {
 	defer ctx.Stop()
 
 	// Start Context Services
-	ctx.Start()
+	if err := ctx.Start(); err != nil {
+		return err
+	}
+
+	// Reload the config when we receive a SIGHUP, and backup the embedded stores on SIGUSR1
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGUSR1 {
+				if err := ctx.Backup(); err != nil {
+					log.Errorf("Store backup failed - %s", err.Error())
+				}
+				continue
+			}
+			if err := ctx.Reload(); err != nil {
+				log.Errorf("Config reload failed - %s", err.Error())
+			}
+		}
+	}()
+
+	// Serve gRPC on a port of its own, if enabled
+	if ctx.Grpc.Bind != "" {
+		listener, err := net.Listen("tcp", ctx.Grpc.Bind)
+		if err != nil {
+			return err
+		}
+		grpcServer := NewGrpcServer(ctx)
+		defer grpcServer.Stop()
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Errorf("gRPC server failed - %s", err.Error())
+			}
+		}()
+	}
+
+	// Serve the admin api to operators with a client certificate on a port of its own, if enabled
+	if ctx.Admin.TLS != nil {
+		adminServer := &http.Server{
+			Addr:      parser.GetOpts().String("admin-bind"),
+			Handler:   NewAdminService(ctx),
+			TLSConfig: ctx.Admin.TLS,
+		}
+		defer adminServer.Close()
+		go func() {
+			if err := adminServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				log.Errorf("Admin server failed - %s", err.Error())
+			}
+		}()
+	}
 
 	// Listen on our selected interface
 	return http.ListenAndServe(parser.GetOpts().String("bind"), NewService(ctx))
 }
 
+// Requests not completed within this time are canceled
+const requestTimeout = 2500 * time.Millisecond
+
 func NewRouter() chi.Router {
 	router := chi.NewRouter()
 
-	// Add NotFound Handler
-	router.NotFound(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
-		err := errors.NewClientError(404, fmt.Sprintf("Path '%s' Not Found", req.URL.RequestURI()), nil)
-		resp.WriteHeader(404)
-		resp.Write(err.ToJson())
-	})
+	// Add NotFound Handler, all unknown paths share the same 'not_found' route label
+	notFound := RecordMetrics("not_found")(chi.HandlerFunc(NotFound))
+	router.NotFound(notFound.ServeHTTPC)
 
 	return router
 }
 
+func NotFound(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	err := errors.NewClientError(404, fmt.Sprintf("Path '%s' Not Found", req.URL.RequestURI()), nil)
+	resp.WriteHeader(404)
+	resp.Write(err.ToJson())
+}
+
 func NewService(ctx *ServiceContext) http.Handler {
+	metrics.Init()
 	router := NewRouter()
 
 	// Capture any panics
 	router.Use(PanicRecoverer)
+	// Identify each request in our logs and errors
+	router.Use(RequestId)
 	// Stop processing if client disconnects
 	//router.Use(middleware.CloseNotify)
 	// Log Requests
-	router.Use(Logger)
-	// Stop processing after 2.5 seconds.
-	router.Use(middleware.Timeout(2500 * time.Millisecond))
-	// Inject the correct rethink session into our current context
-	router.Use(SetupContext(ctx))
+	router.Use(AccessLogger(ctx.AccessLog))
+	// Allow browser clients from the origins in the config, and answer their preflight requests
+	router.Use(Cors(ctx))
+	// Identify the client making the request
+	router.Use(Authenticate(ctx))
 
 	router.Route("/api", func(router chi.Router) {
-		// Set JSON headers for every request
-		router.Use(MimeJson)
-		// Record Metrics for every request
-		router.Use(RecordMetrics)
+		// Encode requests and responses as the client asked, JSON unless the client prefers MessagePack
+		router.Use(Negotiate)
+		// Compress large responses if the client accepts gzip or deflate
+		router.Use(Compress(ctx.Http.CompressMinSize))
+		// Reject request bodies larger than we are willing to decode
+		router.Use(LimitBody(ctx.Http.MaxBodySize))
+		// Inject the store for the team making the request into our current context
+		router.Use(SetupContext(ctx))
+		// Stop processing after 2.5 seconds.
+		router.Use(middleware.Timeout(requestTimeout))
 
 		// Use '.' dot to indicate to our users this is not a rest endpoint
-		router.Post("/message.post", MessagePost)
-		router.Post("/message.get", MessageGet)
-		router.Post("/message.list", MessageList)
+		for _, method := range api.Methods.Methods() {
+			// Every version shares the same route label, calls by version are counted separately
+			for _, version := range api.Versions {
+				router.Post("/"+version.Name+"/"+method.Name, Instrument(ctx, method.Name),
+					ApiMethod(ctx, version, method))
+			}
+			router.Post("/"+method.Name, Instrument(ctx, method.Name), ApiMethod(ctx, api.Unversioned, method))
+		}
+		// Describe the methods above, such that clients can discover the api
+		router.Get("/methods", Instrument(ctx, "methods"), MethodList)
+		router.Get("/openapi.json", Instrument(ctx, "openapi"), OpenApiSpec(ctx))
+	})
+
+	// JSON-RPC 2.0 access to the same api, over http or a websocket
+	rpcServer := NewRpcServer(ctx)
+	router.Group(func(router chi.Router) {
+		router.Use(SetupContext(ctx))
+		router.Use(MimeJson)
+
+		router.Post("/rpc", Compress(ctx.Http.CompressMinSize), LimitBody(ctx.Http.MaxBodySize),
+			middleware.Timeout(requestTimeout), Instrument(ctx, "rpc"), RpcPost(rpcServer))
+		// Websocket connections are long lived, each message has its own timeout instead
+		router.Get("/rpc", Instrument(ctx, "rpc.websocket"), RpcWebSocket(ctx, rpcServer))
 	})
 
+	// Operational tasks, only for operators with the admin token
+	router.Route("/admin", AdminRoutes(ctx))
+
 	// Expose the metrics we have collected
-	router.Get("/metrics", prometheus.Handler())
+	router.Get("/metrics", metrics.Handler())
 
 	return router
 }
 
-func MessagePost(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
-	chatApi := api.GetApi(ctx)
-	payload, err := chatApi.PostMessage(ctx, req.Body)
-	if err != nil {
-		resp.WriteHeader(err.GetCode())
+// Dispatches the request body to the api method as served by the version
+func ApiMethod(serviceCtx *ServiceContext, version *api.Version, method *api.Method) chi.HandlerFunc {
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		// Deprecations are read on every call, such that a config reload can deprecate a version
+		deprecation := serviceCtx.Deprecation(version, method.Name)
+		metrics.APIVersionCalls.WithLabelValues(version.Name, method.Name,
+			strconv.FormatBool(deprecation != nil)).Inc()
+		if deprecation != nil {
+			setDeprecation(resp.Header(), deprecation, method)
+		}
+
+		result, err := version.Call(ctx, method, req.Body, codec.GetRequestCodec(ctx))
+		req.Body.Close()
+		if err != nil {
+			writeError(ctx, resp, err)
+			return
+		}
+		writeResponse(ctx, resp, "service.ApiMethod()", result)
+	}
+}
+
+// Tell the client the method is deprecated (https://www.rfc-editor.org/rfc/rfc9745), when it will be removed
+// (https://www.rfc-editor.org/rfc/rfc8594) and where the method has moved to
+func setDeprecation(header http.Header, deprecation *api.Deprecation, method *api.Method) {
+	header.Set("Deprecation", fmt.Sprintf("@%d", deprecation.Since.Unix()))
+	if !deprecation.Sunset.IsZero() {
+		header.Set("Sunset", deprecation.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if deprecation.Successor != "" {
+		header.Set("Link", fmt.Sprintf(`</api/%s/%s>; rel="successor-version"`, deprecation.Successor, method.Name))
 	}
-	resp.Write(payload)
-	req.Body.Close()
 }
 
-func MessageGet(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
-	chatApi := api.GetApi(ctx)
-	payload, err := chatApi.GetMessage(ctx, req.Body)
+func MethodList(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	writeResponse(ctx, resp, "service.MethodList()", api.Methods.Info())
+}
+
+// Describe the api, the operations of versions deprecated in the config are marked as deprecated
+func OpenApiSpec(serviceCtx *ServiceContext) chi.HandlerFunc {
+	return func(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+		doc := api.OpenApi(api.Methods)
+		for _, method := range api.Methods.Methods() {
+			for _, version := range append([]*api.Version{api.Unversioned}, api.Versions...) {
+				if serviceCtx.Deprecation(version, method.Name) == nil {
+					continue
+				}
+				path := "/api/" + version.Name + "/" + method.Name
+				if version == api.Unversioned {
+					path = "/api/" + method.Name
+				}
+				doc.Paths[path]["post"].Deprecated = true
+			}
+		}
+		writeResponse(ctx, resp, "service.OpenApiSpec()", doc)
+	}
+}
+
+// Encode the value with the codec negotiated for the response
+func writeResponse(ctx context.Context, resp http.ResponseWriter, method string, value interface{}) {
+	encoding := codec.GetResponseCodec(ctx)
+	payload, err := encoding.Marshal(value)
 	if err != nil {
-		resp.WriteHeader(err.GetCode())
+		writeError(ctx, resp, errors.HttpErrorInternalEncoding(ctx, method, encoding.Name(), err))
+		return
 	}
 	resp.Write(payload)
-	req.Body.Close()
 }
 
-func MessageList(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
-	chatApi := api.GetApi(ctx)
-	payload, err := chatApi.MessageList(ctx, req.Body)
-	if err != nil {
-		resp.WriteHeader(err.GetCode())
+// Encode the error with the codec negotiated for the response, falling back to JSON
+func writeError(ctx context.Context, resp http.ResponseWriter, err errors.HttpError) {
+	encoding := codec.GetResponseCodec(ctx)
+	payload, marshalErr := encoding.Marshal(err)
+	if marshalErr != nil {
+		encoding, payload = codec.JSON, err.ToJson()
 	}
+	resp.Header().Set("Content-Type", encoding.ContentType())
+	resp.WriteHeader(err.GetCode())
 	resp.Write(payload)
-	req.Body.Close()
 }
@@ -1,9 +1,12 @@
 package service_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/howler-chat/api-service/service"
 	. "github.com/onsi/ginkgo"
@@ -45,4 +48,52 @@ var _ = Describe("Service", func() {
 			})
 		})
 	})
+
+	Describe("Access Log", func() {
+		It("should log the client behind trusted proxies as json", func() {
+			var buf bytes.Buffer
+			proxies, err := service.ParseTrustedProxies("10.0.0.0/8")
+			Expect(err).To(BeNil())
+			serviceCtx.AccessLog = service.AccessLogConfig{
+				Format:         service.AccessLogJson,
+				TrustedProxies: proxies,
+				SampleRatio:    1,
+				Writer:         &buf,
+			}
+			serviceCtx.Gateway = service.GatewayConfig{Secret: "g4teway"}
+			server = service.NewService(serviceCtx)
+
+			req, _ = http.NewRequest("GET", "/path-not-found", nil)
+			req.Header.Set("X-Howler-Gateway-Secret", "g4teway")
+			req.RemoteAddr = "10.0.0.1:4321"
+			req.Header.Set("X-Forwarded-For", "198.51.100.7, 203.0.113.9, 10.0.0.2")
+			req.Header.Set("X-Howler-User-Id", "U1")
+			req.Header.Set("X-Request-Id", "R1")
+			server.ServeHTTP(resp, req)
+
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(buf.Bytes(), &entry)).To(Succeed())
+			Expect(entry["clientIp"]).To(Equal("203.0.113.9"))
+			Expect(entry["userId"]).To(Equal("U1"))
+			Expect(entry["requestId"]).To(Equal("R1"))
+			Expect(entry["status"]).To(Equal(float64(404)))
+			_, err = time.Parse(time.RFC3339Nano, entry["time"].(string))
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Describe("Metrics", func() {
+		It("should label requests by route instead of path", func() {
+			req, _ = http.NewRequest("GET", "/unknown-path-1", nil)
+			server.ServeHTTP(httptest.NewRecorder(), req)
+
+			req, _ = http.NewRequest("GET", "/metrics", nil)
+			server.ServeHTTP(resp, req)
+			Expect(resp.Code).To(Equal(200))
+			Expect(resp.Body.String()).To(ContainSubstring(
+				`howler_api_http_request_count{code="404",method="GET",route="not_found"}`))
+			Expect(resp.Body.String()).To(Not(ContainSubstring("unknown-path-1")))
+			Expect(resp.Body.String()).To(ContainSubstring("go_goroutines"))
+		})
+	})
 })
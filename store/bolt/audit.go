@@ -0,0 +1,90 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/howler-chat/api-service/validate"
+	"golang.org/x/net/context"
+)
+
+// Audit events are keyed by the team id and a null byte followed by the `messageKey()` of the event. Events for
+// the service itself have an empty team id, which bolt does not allow as a bucket name; hence a single bucket
+func auditKey(event *model.AuditEvent) []byte {
+	return append(auditPrefix(event.TeamId), messageKey(event.CreatedAt, event.Id)...)
+}
+
+func auditPrefix(teamId string) []byte {
+	return append([]byte(teamId), 0)
+}
+
+func (self *BoltStore) InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	if event.Id == "" {
+		event.Id = utils.NewId()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	err := self.db.Update(func(tx *bolt.Tx) error {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(auditBucket).Put(auditKey(event), payload)
+	})
+
+	if err != nil {
+		return Error("InsertAuditEvent()", err.Error())
+	}
+	return nil
+}
+
+func (self *BoltStore) ListAuditEvent(ctx context.Context, req *model.ListAuditRequest) ([]model.AuditEvent, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = validate.DefaultLimit
+	}
+
+	var events []model.AuditEvent
+	err := self.db.View(func(tx *bolt.Tx) error {
+		prefix := auditPrefix(req.TeamId)
+		cursor := tx.Bucket(auditBucket).Cursor()
+
+		// Walk backwards from the last event of the team, the byte after the null separator starts the next team
+		key, value := cursor.Seek(append([]byte(req.TeamId), 1))
+		if key == nil {
+			key, value = cursor.Last()
+		} else {
+			key, value = cursor.Prev()
+		}
+
+		for ; key != nil && bytes.HasPrefix(key, prefix) && len(events) < limit; key, value = cursor.Prev() {
+			var event model.AuditEvent
+			if err := json.Unmarshal(value, &event); err != nil {
+				return err
+			}
+			// Events are sorted newest first, nothing before this will match
+			if !req.Since.IsZero() && event.CreatedAt.Before(req.Since) {
+				break
+			}
+			if req.Matches(&event) {
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, Error("ListAuditEvent()", err.Error())
+	}
+	return events, nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package bolt implements the HowlerStore over a single local B+tree file. This allows the service to run on a single
+node with no external dependencies.
+
+	[store-backends]
+	default = bolt:///var/lib/howler/howler.db?durability=hard
+
+Every write is a bolt transaction, which is copy on write and will not corrupt the file if the process or host
+crashes. With 'durability=hard' (the default) each transaction is fsync'd before the write is acknowledged, with
+'durability=soft' fsync is skipped and the most recent writes may be lost if the host crashes.
+
+Because bolt holds an exclusive lock on the file, changing the dsn of a running bolt backend requires a restart.
+*/
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/howler-chat/api-service/store"
+)
+
+func init() {
+	store.RegisterDriver("bolt", NewBackend)
+}
+
+// The top level buckets, nested buckets are noted next to their parent
+var (
+	// A bucket per channel id, messages are keyed by `messageKey()` so they are sorted by creation time
+	messageBucket = []byte("Message")
+	// Message id to the channel id and message key
+	messageIdBucket    = []byte("MessageId")
+	conversationBucket = []byte("Conversation")
+	// A bucket per user id, holding the ids of the conversations the user participates in
+	participantBucket = []byte("ConversationParticipant")
+	userBucket        = []byte("User")
+	// A bucket per team id, holding the handle key to user id. Keeps handles unique and users sorted by handle
+	handleBucket = []byte("UserHandle")
+	teamBucket   = []byte("Team")
+	// Audit events keyed by `auditKey()` so events of a team are sorted by creation time
+	auditBucket = []byte("AuditEvent")
+)
+
+var buckets = [][]byte{messageBucket, messageIdBucket, conversationBucket, participantBucket,
+	userBucket, handleBucket, teamBucket, auditBucket}
+
+type BoltStore struct {
+	db   *bolt.DB
+	name string
+}
+
+// Create a new store backend from a dsn in the form 'bolt:///var/lib/howler/howler.db?durability=soft'
+func NewBackend(name string, dsn *url.URL) (store.Backend, error) {
+	path, noSync, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't wait forever if another process holds the lock on the file
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("while opening '%s' - %s", path, err)
+	}
+	db.NoSync = noSync
+
+	boltStore := NewStore(name, db)
+	if err := boltStore.createBuckets(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("while creating buckets in '%s' - %s", path, err)
+	}
+	return boltStore, nil
+}
+
+func NewStore(name string, db *bolt.DB) *BoltStore {
+	return &BoltStore{
+		db:   db,
+		name: name,
+	}
+}
+
+// Returns the path to the bolt file and true if fsync should be skipped
+func ParseDSN(dsn *url.URL) (string, bool, error) {
+	if dsn.Scheme != "bolt" {
+		return "", false, fmt.Errorf("unsupported bolt dsn scheme '%s'", dsn.Scheme)
+	}
+
+	path := dsn.Host + dsn.Path
+	if path == "" {
+		return "", false, fmt.Errorf("bolt dsn '%s' must include a file path", dsn.String())
+	}
+
+	switch durability := dsn.Query().Get("durability"); durability {
+	case "", "hard":
+		return path, false, nil
+	case "soft":
+		return path, true, nil
+	default:
+		return "", false, fmt.Errorf("invalid durability '%s' in bolt dsn, expected 'hard' or 'soft'", durability)
+	}
+}
+
+func (self *BoltStore) createBuckets() error {
+	return self.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// The file is opened when the backend is created, there is nothing to start
+func (self *BoltStore) Start() {}
+
+// Bolt holds an exclusive lock on the file, a new instance can't open it until this one is stopped
+func (self *BoltStore) ReconnectPolicy() store.ReconnectPolicy {
+	return store.ReconnectStopFirst
+}
+
+func (self *BoltStore) Stop() {
+	self.db.Close()
+}
+
+// Write a consistent copy of the database to `writer` while the store continues to accept reads and writes
+func (self *BoltStore) Backup(writer io.Writer) (int64, error) {
+	var size int64
+	err := self.db.View(func(tx *bolt.Tx) error {
+		var err error
+		size, err = tx.WriteTo(writer)
+		return err
+	})
+	return size, err
+}
+
+// Backup the database to the file at `path`. The backup is written to a temporary file in the same directory and
+// renamed once it is safely on disk, such that `path` always contains a complete backup.
+func (self *BoltStore) BackupFile(path string) (int64, error) {
+	tmp, err := os.OpenFile(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp"),
+		os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := self.Backup(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return size, os.Rename(tmp.Name(), path)
+}
+
+// Messages are keyed by the big endian creation time in nanoseconds followed by the message id, such that
+// a cursor walks the messages of a channel in the order they were created
+func messageKey(createdAt time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(createdAt.UnixNano()))
+	return append(key, id...)
+}
+
+// The message id bucket value is the channel id followed by a null byte and the message key
+func messageIdValue(channelId string, key []byte) []byte {
+	return append(append([]byte(channelId), 0), key...)
+}
+
+func splitMessageIdValue(value []byte) (string, []byte) {
+	idx := bytes.IndexByte(value, 0)
+	if idx == -1 {
+		return "", nil
+	}
+	return string(value[:idx]), value[idx+1:]
+}
+
+func put(bucket *bolt.Bucket, key string, obj interface{}) error {
+	payload, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), payload)
+}
+
+// Returns false if the key doesn't exist in the bucket
+func get(bucket *bolt.Bucket, key string, obj interface{}) (bool, error) {
+	payload := bucket.Get([]byte(key))
+	if payload == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(payload, obj)
+}
+
+func Error(method string, msg string) error {
+	tags := map[string]string{"type": "bolt", "method": method}
+	return store.Unavailable(tags, "Bolt Error - %s", msg)
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bolt_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/store/bolt"
+	"github.com/howler-chat/api-service/store/storetest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestBoltStore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Bolt Store Suite")
+}
+
+var dir string
+var count int
+
+var _ = BeforeSuite(func() {
+	var err error
+	dir, err = ioutil.TempDir("", "howler-bolt")
+	Expect(err).To(BeNil())
+})
+
+var _ = AfterSuite(func() {
+	os.RemoveAll(dir)
+})
+
+// Every spec gets a new database file
+func newBackend() store.Backend {
+	count++
+	dsn, err := url.Parse(fmt.Sprintf("bolt://%s?durability=soft", filepath.Join(dir, fmt.Sprintf("%d.db", count))))
+	Expect(err).To(BeNil())
+	backend, err := bolt.NewBackend("test", dsn)
+	Expect(err).To(BeNil())
+	backend.Start()
+	return backend
+}
+
+var _ = storetest.DescribeStore("Bolt", newBackend)
+
+var _ = Describe("BoltStore", func() {
+	var backend store.Backend
+
+	BeforeEach(func() {
+		backend = newBackend()
+	})
+
+	AfterEach(func() {
+		backend.Stop()
+	})
+
+	Describe("BackupFile()", func() {
+		It("should write a usable copy of the database while open", func() {
+			path := filepath.Join(dir, "backup.db")
+			size, err := backend.(store.Backuper).BackupFile(path)
+			Expect(err).To(BeNil())
+			Expect(size).To(BeNumerically(">", 0))
+
+			dsn, _ := url.Parse("bolt://" + path)
+			restored, err := bolt.NewBackend("restored", dsn)
+			Expect(err).To(BeNil())
+			restored.Stop()
+		})
+	})
+})
+
+var _ = Describe("Router.Reconnect()", func() {
+	It("should reopen a bolt backend that holds the lock on its file", func() {
+		router := store.NewRouter()
+		defer router.Stop()
+		err := router.Reload(store.RouterConfig{
+			Backends: map[string]string{"default": "bolt://" + filepath.Join(dir, "reconnect.db")},
+		})
+		Expect(err).To(BeNil())
+
+		names, err := router.Reconnect("default")
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"default"}))
+	})
+})
@@ -0,0 +1,136 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bolt
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/validate"
+	"golang.org/x/net/context"
+)
+
+// Find the conversation with the same id, or create it if it doesn't exist. On return `conversation` contains the
+// stored version of the conversation, the bool is true if this call created it
+func (self *BoltStore) OpenConversation(ctx context.Context, conversation *model.Conversation) (bool, error) {
+	var existing model.Conversation
+	var found bool
+
+	err := self.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		conversations := tx.Bucket(conversationBucket)
+		if found, err = get(conversations, conversation.Id, &existing); err != nil || found {
+			return err
+		}
+
+		now := time.Now().UTC()
+		conversation.CreatedAt = now
+		conversation.LastActivity = now
+		if err := put(conversations, conversation.Id, conversation); err != nil {
+			return err
+		}
+
+		for _, userId := range conversation.Participants {
+			participant, err := tx.Bucket(participantBucket).CreateBucketIfNotExists([]byte(userId))
+			if err != nil {
+				return err
+			}
+			if err := participant.Put([]byte(conversation.Id), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return false, Error("OpenConversation()", err.Error())
+	}
+	if !found {
+		return true, nil
+	}
+
+	// Conversation ids are derived from a hash of the participants, guard against collisions
+	if strings.Join(existing.Participants, ",") != strings.Join(conversation.Participants, ",") {
+		return false, store.Conflict("Conversation '%s' already exists with different participants",
+			conversation.Id)
+	}
+	*conversation = existing
+	return false, nil
+}
+
+// Get a conversation, returns ErrNotFound if the conversation doesn't exist
+func (self *BoltStore) GetConversation(ctx context.Context, id string) (*model.Conversation, error) {
+	var conversation model.Conversation
+	var found bool
+	err := self.db.View(func(tx *bolt.Tx) error {
+		var err error
+		found, err = get(tx.Bucket(conversationBucket), id, &conversation)
+		return err
+	})
+
+	if err != nil {
+		return nil, Error("GetConversation()", err.Error())
+	}
+	if !found {
+		return nil, store.NotFound("Conversation '%s' not found", id)
+	}
+	return &conversation, nil
+}
+
+// List conversations the user participates in, most recently active first
+func (self *BoltStore) ListConversation(ctx context.Context, req *model.ListConversationRequest) ([]model.Conversation, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = validate.DefaultLimit
+	}
+
+	var conversations []model.Conversation
+	err := self.db.View(func(tx *bolt.Tx) error {
+		participant := tx.Bucket(participantBucket).Bucket([]byte(req.UserId))
+		if participant == nil {
+			return nil
+		}
+
+		all := tx.Bucket(conversationBucket)
+		return participant.ForEach(func(id, _ []byte) error {
+			var conversation model.Conversation
+			if found, err := get(all, string(id), &conversation); err != nil || !found {
+				return err
+			}
+			conversations = append(conversations, conversation)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, Error("ListConversation()", err.Error())
+	}
+
+	sort.Sort(byLastActivity(conversations))
+	if req.Offset >= len(conversations) {
+		return nil, nil
+	}
+	conversations = conversations[req.Offset:]
+	if len(conversations) > limit {
+		conversations = conversations[:limit]
+	}
+	return conversations, nil
+}
+
+// Sorts conversations by the most recently active first, and by id if equally recent such that pages are stable
+type byLastActivity []model.Conversation
+
+func (self byLastActivity) Len() int      { return len(self) }
+func (self byLastActivity) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+func (self byLastActivity) Less(i, j int) bool {
+	if self[i].LastActivity.Equal(self[j].LastActivity) {
+		return self[i].Id < self[j].Id
+	}
+	return self[i].LastActivity.After(self[j].LastActivity)
+}
@@ -0,0 +1,187 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bolt
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"golang.org/x/net/context"
+)
+
+// Insert the message on the requested channel
+func (self *BoltStore) InsertMessage(ctx context.Context, msg *model.Message) error {
+	msg.CreatedAt = time.Now().UTC()
+	return self.insertMessage(ctx, "InsertMessage()", msg)
+}
+
+// Insert the message on the requested channel, keeping the time it was created
+func (self *BoltStore) ImportMessage(ctx context.Context, msg *model.Message) error {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+	return self.insertMessage(ctx, "ImportMessage()", msg)
+}
+
+func (self *BoltStore) insertMessage(ctx context.Context, method string, msg *model.Message) error {
+	msg.Id = utils.NewId()
+	err := self.db.Update(func(tx *bolt.Tx) error {
+		channel, err := tx.Bucket(messageBucket).CreateBucketIfNotExists([]byte(msg.ChannelId))
+		if err != nil {
+			return err
+		}
+
+		key := messageKey(msg.CreatedAt, msg.Id)
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if err := channel.Put(key, payload); err != nil {
+			return err
+		}
+		if err := tx.Bucket(messageIdBucket).Put([]byte(msg.Id), messageIdValue(msg.ChannelId, key)); err != nil {
+			return err
+		}
+
+		// If the channel is a conversation, record the activity
+		var conversation model.Conversation
+		conversations := tx.Bucket(conversationBucket)
+		if found, err := get(conversations, msg.ChannelId, &conversation); err != nil || !found {
+			return err
+		}
+		if !msg.CreatedAt.After(conversation.LastActivity) {
+			return nil
+		}
+		conversation.LastActivity = msg.CreatedAt
+		return put(conversations, conversation.Id, &conversation)
+	})
+
+	if err != nil {
+		return Error(method, err.Error())
+	}
+	return nil
+}
+
+// Get a message, returns ErrNotFound if the message doesn't exist on the requested channel
+func (self *BoltStore) GetMessage(ctx context.Context, req *model.GetMessageRequest) (*model.Message, error) {
+	var msg *model.Message
+	err := self.db.View(func(tx *bolt.Tx) error {
+		channelId, key := splitMessageIdValue(tx.Bucket(messageIdBucket).Get([]byte(req.MessageId)))
+		if channelId != req.ChannelId {
+			return nil
+		}
+
+		channel := tx.Bucket(messageBucket).Bucket([]byte(channelId))
+		if channel == nil {
+			return nil
+		}
+		payload := channel.Get(key)
+		if payload == nil {
+			return nil
+		}
+		msg = &model.Message{}
+		return json.Unmarshal(payload, msg)
+	})
+
+	if err != nil {
+		return nil, Error("GetMessage()", err.Error())
+	}
+	if msg == nil {
+		return nil, store.NotFound("Message '%s' not found", req.MessageId)
+	}
+	return msg, nil
+}
+
+// List the messages on the channel in the order they were created
+func (self *BoltStore) ListMessage(ctx context.Context, req *model.ListMessageRequest) ([]model.Message, error) {
+	var messages []model.Message
+	err := self.db.View(func(tx *bolt.Tx) error {
+		channel := tx.Bucket(messageBucket).Bucket([]byte(req.ChannelId))
+		if channel == nil {
+			return nil
+		}
+
+		return channel.ForEach(func(key, payload []byte) error {
+			var msg model.Message
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				return err
+			}
+			messages = append(messages, msg)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, Error("ListMessage()", err.Error())
+	}
+	return messages, nil
+}
+
+// Remove every message on the channel, returns the number of messages removed
+func (self *BoltStore) PurgeChannel(ctx context.Context, channelId string) (int, error) {
+	var count int
+	err := self.db.Update(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messageBucket)
+		channel := messages.Bucket([]byte(channelId))
+		if channel == nil {
+			return nil
+		}
+
+		ids := tx.Bucket(messageIdBucket)
+		err := channel.ForEach(func(key, payload []byte) error {
+			var msg model.Message
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				return err
+			}
+			count++
+			return ids.Delete([]byte(msg.Id))
+		})
+		if err != nil {
+			return err
+		}
+		return messages.DeleteBucket([]byte(channelId))
+	})
+
+	if err != nil {
+		return 0, Error("PurgeChannel()", err.Error())
+	}
+	return count, nil
+}
+
+// Bolt has no index of messages by user, so every channel is scanned until a message by one of the users is found
+func (self *BoltStore) ListChannelIds(ctx context.Context, userIds []string) ([]string, error) {
+	users := make(map[string]bool, len(userIds))
+	for _, userId := range userIds {
+		users[userId] = true
+	}
+
+	var channelIds []string
+	err := self.db.View(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messageBucket)
+		return messages.ForEach(func(channelId, _ []byte) error {
+			cursor := messages.Bucket(channelId).Cursor()
+			for key, payload := cursor.First(); key != nil; key, payload = cursor.Next() {
+				var msg model.Message
+				if err := json.Unmarshal(payload, &msg); err != nil {
+					return err
+				}
+				if users[msg.UserId] {
+					channelIds = append(channelIds, string(channelId))
+					return nil
+				}
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, Error("ListChannelIds()", err.Error())
+	}
+	return channelIds, nil
+}
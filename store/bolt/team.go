@@ -0,0 +1,31 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bolt
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"golang.org/x/net/context"
+)
+
+// Get a team, returns ErrNotFound if the team doesn't exist
+func (self *BoltStore) GetTeam(ctx context.Context, id string) (*model.Team, error) {
+	var team model.Team
+	var found bool
+	err := self.db.View(func(tx *bolt.Tx) error {
+		var err error
+		found, err = get(tx.Bucket(teamBucket), id, &team)
+		return err
+	})
+
+	if err != nil {
+		return nil, Error("GetTeam()", err.Error())
+	}
+	if !found {
+		return nil, store.NotFound("Team '%s' not found", id)
+	}
+	return &team, nil
+}
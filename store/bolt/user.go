@@ -0,0 +1,149 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bolt
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/howler-chat/api-service/validate"
+	"golang.org/x/net/context"
+)
+
+// Reserve the handle of the user within their team, returns false if another user holds the handle
+func reserveHandle(tx *bolt.Tx, user *model.User) (bool, error) {
+	team, err := tx.Bucket(handleBucket).CreateBucketIfNotExists([]byte(user.TeamId))
+	if err != nil {
+		return false, err
+	}
+
+	holder := team.Get([]byte(user.HandleKey()))
+	if holder != nil {
+		return string(holder) == user.Id, nil
+	}
+	return true, team.Put([]byte(user.HandleKey()), []byte(user.Id))
+}
+
+func (self *BoltStore) InsertUser(ctx context.Context, user *model.User) error {
+	if user.Id == "" {
+		user.Id = utils.NewId()
+	}
+
+	var reserved bool
+	err := self.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if reserved, err = reserveHandle(tx, user); err != nil || !reserved {
+			return err
+		}
+		return put(tx.Bucket(userBucket), user.Id, user)
+	})
+
+	if err != nil {
+		return Error("InsertUser()", err.Error())
+	}
+	if !reserved {
+		return store.Conflict("Handle '%s' is already taken", user.Handle)
+	}
+	return nil
+}
+
+// Get a user, returns ErrNotFound if the user doesn't exist
+func (self *BoltStore) GetUser(ctx context.Context, id string) (*model.User, error) {
+	var user model.User
+	var found bool
+	err := self.db.View(func(tx *bolt.Tx) error {
+		var err error
+		found, err = get(tx.Bucket(userBucket), id, &user)
+		return err
+	})
+
+	if err != nil {
+		return nil, Error("GetUser()", err.Error())
+	}
+	if !found {
+		return nil, store.NotFound("User '%s' not found", id)
+	}
+	return &user, nil
+}
+
+// List the users on the team ordered by handle
+func (self *BoltStore) ListUser(ctx context.Context, req *model.ListUserRequest) ([]model.User, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = validate.DefaultLimit
+	}
+
+	var users []model.User
+	err := self.db.View(func(tx *bolt.Tx) error {
+		team := tx.Bucket(handleBucket).Bucket([]byte(req.TeamId))
+		if team == nil {
+			return nil
+		}
+
+		all := tx.Bucket(userBucket)
+		cursor := team.Cursor()
+		skip := req.Offset
+		for key, userId := cursor.First(); key != nil && len(users) < limit; key, userId = cursor.Next() {
+			var user model.User
+			found, err := get(all, string(userId), &user)
+			if err != nil {
+				return err
+			}
+			if !found || (user.Deactivated && !req.IncludeDeactivated) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			users = append(users, user)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, Error("ListUser()", err.Error())
+	}
+	return users, nil
+}
+
+// Replace the user, returns 409 if the handle is already taken within the team
+func (self *BoltStore) UpdateUser(ctx context.Context, user *model.User) error {
+	var existing model.User
+	var found, reserved bool
+
+	err := self.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		users := tx.Bucket(userBucket)
+		if found, err = get(users, user.Id, &existing); err != nil || !found {
+			return err
+		}
+		if reserved, err = reserveHandle(tx, user); err != nil || !reserved {
+			return err
+		}
+
+		// Release the old handle if it changed
+		if existing.TeamId != user.TeamId || existing.HandleKey() != user.HandleKey() {
+			if team := tx.Bucket(handleBucket).Bucket([]byte(existing.TeamId)); team != nil {
+				if err := team.Delete([]byte(existing.HandleKey())); err != nil {
+					return err
+				}
+			}
+		}
+		return put(users, user.Id, user)
+	})
+
+	if err != nil {
+		return Error("UpdateUser()", err.Error())
+	}
+	if !found {
+		return store.NotFound("User '%s' not found", user.Id)
+	}
+	if !reserved {
+		return store.Conflict("Handle '%s' is already taken", user.Handle)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// Writes are acknowledged once they are safely on disk
+	DurabilityHard = "hard"
+	// Writes are acknowledged once they are in memory, recent writes may be lost on a crash
+	DurabilitySoft = "soft"
+
+	// Read from the primary replica
+	ReadModeSingle = "single"
+	// Only return data acknowledged by a majority of replicas, slower but never rolled back
+	ReadModeMajority = "majority"
+	// Read from any replica, fastest but the data may be out of date
+	ReadModeOutdated = "outdated"
+)
+
+// The write durability and read mode requested for store operations. Backends that can't honour a setting (IE: sql
+// and bolt, which have a single replica and set durability in their dsn) ignore it.
+type Consistency struct {
+	Durability string
+	ReadMode   string
+}
+
+var DefaultConsistency = Consistency{
+	Durability: DurabilityHard,
+	ReadMode:   ReadModeSingle,
+}
+
+func (self Consistency) Validate() error {
+	switch self.Durability {
+	case DurabilityHard, DurabilitySoft:
+	default:
+		return fmt.Errorf("invalid durability '%s', expected 'hard' or 'soft'", self.Durability)
+	}
+
+	switch self.ReadMode {
+	case ReadModeSingle, ReadModeMajority, ReadModeOutdated:
+	default:
+		return fmt.Errorf("invalid read mode '%s', expected 'single', 'majority' or 'outdated'", self.ReadMode)
+	}
+	return nil
+}
+
+// The consistency of each api endpoint, IE: 'message.get'
+type ConsistencyConfig struct {
+	// Used by endpoints not listed in Endpoints
+	Default   Consistency
+	Endpoints map[string]Consistency
+}
+
+// Returns the consistency for the endpoint
+func (self *ConsistencyConfig) For(endpoint string) Consistency {
+	if consistency, ok := self.Endpoints[endpoint]; ok {
+		return consistency
+	}
+	return self.Default
+}
+
+func (self *ConsistencyConfig) Validate() error {
+	if err := self.Default.Validate(); err != nil {
+		return fmt.Errorf("default consistency - %s", err)
+	}
+	for endpoint, consistency := range self.Endpoints {
+		if err := consistency.Validate(); err != nil {
+			return fmt.Errorf("consistency for endpoint '%s' - %s", endpoint, err)
+		}
+	}
+	return nil
+}
+
+func AddConsistency(ctx context.Context, consistency Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey, consistency)
+}
+
+// Returns the consistency requested for this request, or DefaultConsistency if none was requested
+func GetConsistency(ctx context.Context) Consistency {
+	obj, ok := ctx.Value(consistencyKey).(Consistency)
+	if !ok {
+		return DefaultConsistency
+	}
+	return obj
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Every error returned by a HowlerStore is caused by one of these, use Cause() to find out which
+var (
+	// The requested object doesn't exist
+	ErrNotFound = errors.New("not found")
+	// The write conflicts with an existing object, IE: a handle already taken
+	ErrConflict = errors.New("conflict")
+	// The backend could not complete the request, the client may retry
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// An Error describes why a store method failed
+type Error struct {
+	cause   error
+	message string
+	// Describes the backend and method that failed, used when logging and counting unavailable errors
+	Tags map[string]string
+}
+
+func (self *Error) Error() string {
+	return self.message
+}
+
+// Returns the sentinel error, satisfies the causer interface of github.com/pkg/errors
+func (self *Error) Cause() error {
+	return self.cause
+}
+
+func NotFound(msg string, stuff ...interface{}) error {
+	return &Error{cause: ErrNotFound, message: fmt.Sprintf(msg, stuff...)}
+}
+
+func Conflict(msg string, stuff ...interface{}) error {
+	return &Error{cause: ErrConflict, message: fmt.Sprintf(msg, stuff...)}
+}
+
+func Unavailable(tags map[string]string, msg string, stuff ...interface{}) error {
+	return &Error{cause: ErrUnavailable, message: fmt.Sprintf(msg, stuff...), Tags: tags}
+}
+
+// Returns the sentinel error that caused `err`. Errors not created by a store are assumed to be ErrUnavailable
+func Cause(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch cause := errors.Cause(err); cause {
+	case ErrNotFound, ErrConflict, ErrUnavailable:
+		return cause
+	}
+	return ErrUnavailable
+}
@@ -0,0 +1,225 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/howler-chat/api-service/metrics"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/trace"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// The InstrumentedStore wraps a HowlerStore and records the latency, errors and rows returned of every call. Calls
+// that take longer than SlowQuery are logged, and calls made within a traced request are recorded as spans.
+type InstrumentedStore struct {
+	// The name of the backend, used to label the metrics
+	Backend string
+	Store   HowlerStore
+	// Log calls that take longer than this, 0 disables logging
+	SlowQuery time.Duration
+}
+
+func NewInstrumentedStore(backend string, store HowlerStore, slowQuery time.Duration) *InstrumentedStore {
+	return &InstrumentedStore{
+		Backend:   backend,
+		Store:     store,
+		SlowQuery: slowQuery,
+	}
+}
+
+// Record the outcome of a call and finish its span. Rows should be -1 for calls that don't return rows
+func (self *InstrumentedStore) observe(ctx context.Context, span *trace.Span, method, channelId string,
+	start time.Time, rows int, err error) {
+	elapsed := time.Since(start)
+	metrics.StoreLatency.WithLabelValues(self.Backend, method).Observe(elapsed.Seconds())
+
+	span.SetAttribute("store.backend", self.Backend)
+	if channelId != "" {
+		span.SetAttribute("store.channel_id", channelId)
+	}
+
+	if err != nil {
+		class := errorClass(ctx, err)
+		metrics.StoreErrors.WithLabelValues(self.Backend, method, class).Inc()
+		span.SetAttribute("store.error_class", class)
+		// Not found and conflicts are answers, not failures of the store
+		if class == "unavailable" {
+			span.SetError(err)
+		}
+	} else if rows >= 0 {
+		metrics.StoreRows.WithLabelValues(self.Backend, method).Observe(float64(rows))
+		span.SetAttribute("store.rows", strconv.Itoa(rows))
+	}
+	span.Finish()
+
+	if self.SlowQuery != 0 && elapsed > self.SlowQuery {
+		log.WithFields(log.Fields{
+			"type":      "store",
+			"backend":   self.Backend,
+			"method":    method,
+			"channelId": channelId,
+			"requestId": utils.GetRequestId(ctx),
+			"elapsed":   elapsed.String(),
+		}).Warnf("Slow store operation, %s took %s", method, elapsed)
+	}
+}
+
+// Returns the metric label for the cause of the error. Calls the client gave up on are counted apart from
+// unavailable, as they say nothing about the health of the backend
+func errorClass(ctx context.Context, err error) string {
+	switch Cause(err) {
+	case ErrNotFound:
+		return "not_found"
+	case ErrConflict:
+		return "conflict"
+	}
+
+	// Backends report a cancelled call as unavailable, and often only keep the message of the context error
+	cause := errors.Cause(err)
+	if cause != context.Canceled && cause != context.DeadlineExceeded {
+		cause = ctx.Err()
+	}
+	switch cause {
+	case context.Canceled:
+		return "canceled"
+	case context.DeadlineExceeded:
+		return "deadline_exceeded"
+	}
+	return "unavailable"
+}
+
+func (self *InstrumentedStore) InsertMessage(ctx context.Context, msg *model.Message) error {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.InsertMessage")
+	err := self.Store.InsertMessage(ctx, msg)
+	self.observe(ctx, span, "InsertMessage", msg.ChannelId, start, -1, err)
+	return err
+}
+
+func (self *InstrumentedStore) ImportMessage(ctx context.Context, msg *model.Message) error {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.ImportMessage")
+	err := self.Store.ImportMessage(ctx, msg)
+	self.observe(ctx, span, "ImportMessage", msg.ChannelId, start, -1, err)
+	return err
+}
+
+func (self *InstrumentedStore) GetMessage(ctx context.Context, req *model.GetMessageRequest) (*model.Message, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.GetMessage")
+	msg, err := self.Store.GetMessage(ctx, req)
+	self.observe(ctx, span, "GetMessage", req.ChannelId, start, 1, err)
+	return msg, err
+}
+
+func (self *InstrumentedStore) ListMessage(ctx context.Context, req *model.ListMessageRequest) ([]model.Message, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.ListMessage")
+	messages, err := self.Store.ListMessage(ctx, req)
+	self.observe(ctx, span, "ListMessage", req.ChannelId, start, len(messages), err)
+	return messages, err
+}
+
+func (self *InstrumentedStore) PurgeChannel(ctx context.Context, channelId string) (int, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.PurgeChannel")
+	count, err := self.Store.PurgeChannel(ctx, channelId)
+	self.observe(ctx, span, "PurgeChannel", channelId, start, count, err)
+	return count, err
+}
+
+func (self *InstrumentedStore) ListChannelIds(ctx context.Context, userIds []string) ([]string, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.ListChannelIds")
+	channelIds, err := self.Store.ListChannelIds(ctx, userIds)
+	self.observe(ctx, span, "ListChannelIds", "", start, len(channelIds), err)
+	return channelIds, err
+}
+
+func (self *InstrumentedStore) OpenConversation(ctx context.Context, conversation *model.Conversation) (bool, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.OpenConversation")
+	created, err := self.Store.OpenConversation(ctx, conversation)
+	self.observe(ctx, span, "OpenConversation", conversation.Id, start, -1, err)
+	return created, err
+}
+
+func (self *InstrumentedStore) GetConversation(ctx context.Context, id string) (*model.Conversation, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.GetConversation")
+	conversation, err := self.Store.GetConversation(ctx, id)
+	self.observe(ctx, span, "GetConversation", id, start, 1, err)
+	return conversation, err
+}
+
+func (self *InstrumentedStore) ListConversation(ctx context.Context, req *model.ListConversationRequest) ([]model.Conversation, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.ListConversation")
+	conversations, err := self.Store.ListConversation(ctx, req)
+	self.observe(ctx, span, "ListConversation", "", start, len(conversations), err)
+	return conversations, err
+}
+
+func (self *InstrumentedStore) InsertUser(ctx context.Context, user *model.User) error {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.InsertUser")
+	err := self.Store.InsertUser(ctx, user)
+	self.observe(ctx, span, "InsertUser", "", start, -1, err)
+	return err
+}
+
+func (self *InstrumentedStore) GetUser(ctx context.Context, id string) (*model.User, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.GetUser")
+	user, err := self.Store.GetUser(ctx, id)
+	self.observe(ctx, span, "GetUser", "", start, 1, err)
+	return user, err
+}
+
+func (self *InstrumentedStore) ListUser(ctx context.Context, req *model.ListUserRequest) ([]model.User, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.ListUser")
+	users, err := self.Store.ListUser(ctx, req)
+	self.observe(ctx, span, "ListUser", "", start, len(users), err)
+	return users, err
+}
+
+func (self *InstrumentedStore) UpdateUser(ctx context.Context, user *model.User) error {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.UpdateUser")
+	err := self.Store.UpdateUser(ctx, user)
+	self.observe(ctx, span, "UpdateUser", "", start, -1, err)
+	return err
+}
+
+func (self *InstrumentedStore) GetTeam(ctx context.Context, id string) (*model.Team, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.GetTeam")
+	team, err := self.Store.GetTeam(ctx, id)
+	self.observe(ctx, span, "GetTeam", "", start, 1, err)
+	return team, err
+}
+
+func (self *InstrumentedStore) InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.InsertAuditEvent")
+	err := self.Store.InsertAuditEvent(ctx, event)
+	self.observe(ctx, span, "InsertAuditEvent", "", start, -1, err)
+	return err
+}
+
+func (self *InstrumentedStore) ListAuditEvent(ctx context.Context, req *model.ListAuditRequest) ([]model.AuditEvent, error) {
+	start := time.Now()
+	ctx, span := trace.StartSpan(ctx, "store.ListAuditEvent")
+	events, err := self.Store.ListAuditEvent(ctx, req)
+	self.observe(ctx, span, "ListAuditEvent", "", start, len(events), err)
+	return events, err
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package store_test
+
+import (
+	"testing"
+
+	"github.com/howler-chat/api-service/metrics"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/context"
+)
+
+func TestStore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Store Suite")
+}
+
+// Returns the error it was given from every call, calls not used by the specs panic
+type fakeStore struct {
+	store.HowlerStore
+	err      error
+	messages []model.Message
+}
+
+func (self *fakeStore) ListMessage(ctx context.Context, req *model.ListMessageRequest) ([]model.Message, error) {
+	return self.messages, self.err
+}
+
+func errorCount(backend, class string) float64 {
+	var metric dto.Metric
+	Expect(metrics.StoreErrors.WithLabelValues(backend, "ListMessage", class).Write(&metric)).To(Succeed())
+	return metric.GetCounter().GetValue()
+}
+
+var _ = Describe("InstrumentedStore", func() {
+	cancelled := func() context.Context {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ctx
+	}
+
+	DescribeTable("should count errors by class",
+		func(ctx context.Context, err error, class string) {
+			backend := "fake-" + class
+			instrumented := store.NewInstrumentedStore(backend, &fakeStore{err: err}, 0)
+			before := errorCount(backend, class)
+
+			_, result := instrumented.ListMessage(ctx, &model.ListMessageRequest{ChannelId: "C000000001"})
+			Expect(result).To(Equal(err))
+			Expect(errorCount(backend, class)).To(Equal(before + 1))
+		},
+		Entry("not found", context.Background(), store.NotFound("Message not found"), "not_found"),
+		Entry("conflict", context.Background(), store.Conflict("Handle taken"), "conflict"),
+		Entry("unavailable", context.Background(), store.Unavailable(nil, "connection refused"), "unavailable"),
+		Entry("unknown errors", context.Background(), errors.New("boom"), "unavailable"),
+		Entry("canceled", context.Background(), context.Canceled, "canceled"),
+		Entry("deadline exceeded", context.Background(), errors.Wrap(context.DeadlineExceeded, "while listing"),
+			"deadline_exceeded"),
+		Entry("unavailable after the caller cancelled", cancelled(),
+			store.Unavailable(nil, "context canceled"), "canceled"),
+	)
+
+	It("should not count successful calls as errors", func() {
+		instrumented := store.NewInstrumentedStore("fake-ok", &fakeStore{messages: []model.Message{{}}}, 0)
+		before := errorCount("fake-ok", "unavailable")
+
+		messages, err := instrumented.ListMessage(context.Background(),
+			&model.ListMessageRequest{ChannelId: "C000000001"})
+		Expect(err).To(BeNil())
+		Expect(messages).To(HaveLen(1))
+		Expect(errorCount("fake-ok", "unavailable")).To(Equal(before))
+	})
+})
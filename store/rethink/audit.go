@@ -0,0 +1,77 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rethink
+
+import (
+	"time"
+
+	"github.com/dancannon/gorethink"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/howler-chat/api-service/validate"
+	"golang.org/x/net/context"
+)
+
+func (self *RethinkStore) InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return Error("InsertAuditEvent()", err.Error())
+	}
+
+	if event.Id == "" {
+		event.Id = utils.NewId()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	changed, err := gorethink.Table("AuditEvent").Insert(event).RunWrite(session, writeOpts(ctx))
+	if err != nil {
+		return Error("InsertAuditEvent()", err.Error())
+	} else if changed.Errors != 0 {
+		return Error("InsertAuditEvent()", changed.FirstError)
+	}
+	return nil
+}
+
+func (self *RethinkStore) ListAuditEvent(ctx context.Context, req *model.ListAuditRequest) ([]model.AuditEvent, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return nil, Error("ListAuditEvent()", err.Error())
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = validate.DefaultLimit
+	}
+
+	query := gorethink.Table("AuditEvent").GetAllByIndex("TeamId", req.TeamId)
+	if req.Action != "" {
+		query = query.Filter(gorethink.Row.Field("Action").Eq(req.Action))
+	}
+	if req.ActorId != "" {
+		query = query.Filter(gorethink.Row.Field("ActorId").Eq(req.ActorId))
+	}
+	if req.TargetId != "" {
+		query = query.Filter(gorethink.Row.Field("TargetId").Eq(req.TargetId))
+	}
+	if !req.Since.IsZero() {
+		query = query.Filter(gorethink.Row.Field("CreatedAt").Ge(req.Since))
+	}
+	if !req.Until.IsZero() {
+		query = query.Filter(gorethink.Row.Field("CreatedAt").Lt(req.Until))
+	}
+
+	var events []model.AuditEvent
+	cursor, err := query.OrderBy(gorethink.Desc("CreatedAt"), gorethink.Desc("id")).Limit(limit).
+		Run(session, readOpts(ctx))
+
+	if err != nil {
+		return nil, Error("ListAuditEvent()", err.Error())
+	} else if err := cursor.All(&events); err != nil {
+		return nil, Error("ListAuditEvent().All()", err.Error())
+	}
+	return events, nil
+}
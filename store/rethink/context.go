@@ -1,11 +1,14 @@
 package rethink
 
 import (
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/dancannon/gorethink"
-	"github.com/thrawn01/args"
+	"github.com/howler-chat/api-service/metrics"
+	"github.com/howler-chat/api-service/utils"
 	"golang.org/x/net/context"
 )
 
@@ -14,19 +17,42 @@ type contextKey int
 const (
 	rethinkContextKey contextKey = 0
 	rethinkStoreKey   contextKey = 1
-	rethinkSessionKey contextKey = 2
 )
 
+// How often the connect job checks the session is still connected
+const healthCheckInterval = time.Second
+
+// The RethinkContext maintains a connected session (which is a connection pool) to a rethinkdb cluster, and
+// reconnects with exponential backoff when the connection is lost
 type RethinkContext struct {
-	rethinkChan chan *gorethink.Session
-	done        chan struct{}
-	parser      *args.ArgParser
+	name        string
+	connectOpts gorethink.ConnectOpts
+	mutex       sync.Mutex
+	session     *gorethink.Session
+	connected   bool
+	// Closed when a connected session is available, replaced when the session disconnects
+	ready chan struct{}
+	// Wakes the connect job when a request finds the session disconnected
+	reconnect chan struct{}
+	done      chan struct{}
 }
 
-func NewRethinkContext(parser *args.ArgParser) *RethinkContext {
+func NewRethinkContext(name string, connectOpts gorethink.ConnectOpts) *RethinkContext {
 	return &RethinkContext{
-		parser: parser,
+		name:        name,
+		connectOpts: connectOpts,
+		ready:       make(chan struct{}),
+		reconnect:   make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+}
+
+// The database the store uses, rethinkdb uses 'test' if the dsn doesn't name one
+func (self *RethinkContext) Database() string {
+	if self.connectOpts.Database == "" {
+		return "test"
 	}
+	return self.connectOpts.Database
 }
 
 func (self *RethinkContext) Stop() {
@@ -34,73 +60,136 @@ func (self *RethinkContext) Stop() {
 }
 
 func (self *RethinkContext) Start() {
-	self.rethinkChan = make(chan *gorethink.Session)
+	metrics.RethinkPoolSize.WithLabelValues(self.name, "initial_cap").Set(float64(self.connectOpts.InitialCap))
+	metrics.RethinkPoolSize.WithLabelValues(self.name, "max_open").Set(float64(self.connectOpts.MaxOpen))
+	metrics.RethinkConnected.WithLabelValues(self.name).Set(0)
 
 	go func() {
-		var session *gorethink.Session
-		defer close(self.rethinkChan)
-		var err error
+		backoff := utils.NewBackoff()
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+		defer self.closeSession()
 
 		for {
-			// If we already have a session object, and we are already connected
-			if session != nil && session.IsConnected() {
-				// Feed a rethink session into the channel, until done channel is closed
-				select {
-				case self.rethinkChan <- session:
-				case <-self.done:
-					return
+			if !self.isConnected() {
+				// Attempt to connect to rethinkdb
+				session, err := gorethink.Connect(self.connectOpts)
+				// If something went wrong
+				if err != nil {
+					delay := backoff.Next()
+					metrics.RethinkReconnectCount.WithLabelValues(self.name).Inc()
+					logrus.WithFields(logrus.Fields{
+						"type":    "rethink",
+						"method":  "RethinkConnectJob()",
+						"backend": self.name,
+						"attempt": backoff.Attempts(),
+					}).Errorf("Rethinkdb Connect Failed, retry in %s - %s", delay, err.Error())
+
+					// Sleep until our next attempt, or until the done channel is closed
+					timer := time.NewTimer(delay)
+					select {
+					case <-timer.C:
+						continue
+					case <-self.done:
+						timer.Stop()
+						return
+					}
 				}
-				continue
+				backoff.Reset()
+				self.setSession(session)
 			}
 
-			// Always fetch the latest version of the config
-			config := self.parser.GetOpts()
-
-			// Attempt to connect to rethinkdb
-			session, err = gorethink.Connect(gorethink.ConnectOpts{
-				Addresses: config.Group("rethink").StringSlice("endpoints"),
-				Database:  config.Group("rethink").String("database"),
-				Username:  config.Group("rethink").String("user"),
-				Password:  config.Group("rethink").String("password"),
-			})
-			// If something went wrong
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"type":   "rethink",
-					"method": "RethinkConnectJob()",
-				}).Errorf("Rethinkdb Connect Failed - %s", err.Error())
-
-				// Sleep for 1 second, or until the done channel is closed
-				timer := time.NewTimer(time.Second).C
-				select {
-				case <-timer:
-					continue
-				case <-self.done:
-					return
-				}
+			// Check the session is still connected periodically, or when a request finds it disconnected
+			select {
+			case <-ticker.C:
+			case <-self.reconnect:
+			case <-self.done:
+				return
 			}
 		}
 	}()
 }
 
-func (self *RethinkContext) GetRethinkSession() *gorethink.Session {
-	return <-self.rethinkChan
+// Returns true if we have a connected session. If the session has disconnected, requests will wait for the
+// connect job to establish a new session
+func (self *RethinkContext) isConnected() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.session != nil && self.session.IsConnected() {
+		return true
+	}
+	if self.connected {
+		self.connected = false
+		self.ready = make(chan struct{})
+		metrics.RethinkConnected.WithLabelValues(self.name).Set(0)
+	}
+	return false
 }
 
-func AddRethinkContext(ctx context.Context, service *RethinkContext) context.Context {
-	return context.WithValue(ctx, rethinkContextKey, service)
+func (self *RethinkContext) setSession(session *gorethink.Session) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.session != nil {
+		self.session.Close()
+	}
+	self.session = session
+	self.connected = true
+	// Release any requests waiting for a session
+	close(self.ready)
+	metrics.RethinkConnected.WithLabelValues(self.name).Set(1)
 }
 
-func AddRethinkSession(ctx context.Context, session *gorethink.Session) context.Context {
-	return context.WithValue(ctx, rethinkSessionKey, session)
+func (self *RethinkContext) closeSession() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.session != nil {
+		self.session.Close()
+		self.session = nil
+	}
+	metrics.RethinkConnected.WithLabelValues(self.name).Set(0)
 }
 
-func GetRethinkSession(ctx context.Context) *gorethink.Session {
-	obj, ok := ctx.Value(rethinkSessionKey).(*gorethink.Session)
-	if !ok {
-		panic("No rethink.RethinkContext found in context")
+// Returns a connected session, waiting for the connect job to reconnect if needed. Gives up when the context
+// is cancelled or reaches its deadline. The session returned is safe for concurrent use.
+func (self *RethinkContext) GetRethinkSession(ctx context.Context) (*gorethink.Session, error) {
+	for {
+		if self.isConnected() {
+			self.mutex.Lock()
+			session := self.session
+			self.mutex.Unlock()
+			return session, nil
+		}
+
+		self.mutex.Lock()
+		ready := self.ready
+		self.mutex.Unlock()
+
+		// Wake the connect job, unless it was already asked
+		select {
+		case self.reconnect <- struct{}{}:
+		default:
+		}
+
+		waiting := metrics.RethinkSessionWaiting.WithLabelValues(self.name)
+		waiting.Inc()
+		select {
+		case <-ready:
+			waiting.Dec()
+		case <-ctx.Done():
+			waiting.Dec()
+			return nil, fmt.Errorf("no connection available to backend '%s' - %s", self.name, ctx.Err())
+		case <-self.done:
+			waiting.Dec()
+			return nil, fmt.Errorf("backend '%s' has stopped", self.name)
+		}
 	}
-	return obj
+}
+
+func AddRethinkContext(ctx context.Context, service *RethinkContext) context.Context {
+	return context.WithValue(ctx, rethinkContextKey, service)
 }
 
 func GetRethinkContext(ctx context.Context) *RethinkContext {
@@ -0,0 +1,99 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rethink
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dancannon/gorethink"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/validate"
+	"golang.org/x/net/context"
+)
+
+// Find the conversation with the same id, or create it if it doesn't exist. On return `conversation` contains the
+// stored version of the conversation, the bool is true if this call created it
+func (self *RethinkStore) OpenConversation(ctx context.Context, conversation *model.Conversation) (bool, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return false, Error("OpenConversation()", err.Error())
+	}
+
+	now := time.Now().UTC()
+	conversation.CreatedAt = now
+	conversation.LastActivity = now
+
+	changed, err := gorethink.Table("Conversation").Insert(conversation).RunWrite(session, writeOpts(ctx))
+	if err != nil {
+		return false, Error("OpenConversation()", err.Error())
+	}
+	// Another request created the conversation first
+	if changed.Errors != 0 && !strings.HasPrefix(changed.FirstError, "Duplicate primary key") {
+		return false, Error("OpenConversation()", changed.FirstError)
+	}
+
+	existing, err := self.GetConversation(ctx, conversation.Id)
+	if err != nil {
+		return false, err
+	}
+
+	// Conversation ids are derived from a hash of the participants, guard against collisions
+	if strings.Join(existing.Participants, ",") != strings.Join(conversation.Participants, ",") {
+		return false, store.Conflict("Conversation '%s' already exists with different participants",
+			conversation.Id)
+	}
+	*conversation = *existing
+	return changed.Inserted == 1, nil
+}
+
+// Get a conversation, returns ErrNotFound if the conversation doesn't exist
+func (self *RethinkStore) GetConversation(ctx context.Context, id string) (*model.Conversation, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return nil, Error("GetConversation()", err.Error())
+	}
+
+	cursor, err := gorethink.Table("Conversation").Get(id).Run(session, readOpts(ctx))
+	if err != nil {
+		return nil, Error("GetConversation()", err.Error())
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, store.NotFound("Conversation '%s' not found", id)
+	}
+
+	var conversation model.Conversation
+	if err := cursor.One(&conversation); err != nil {
+		return nil, Error("GetConversation().One()", err.Error())
+	}
+	return &conversation, nil
+}
+
+func (self *RethinkStore) ListConversation(ctx context.Context, req *model.ListConversationRequest) ([]model.Conversation, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return nil, Error("ListConversation()", err.Error())
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = validate.DefaultLimit
+	}
+
+	var conversations []model.Conversation
+	cursor, err := gorethink.Table("Conversation").
+		GetAllByIndex("Participants", req.UserId).
+		OrderBy(gorethink.Desc("LastActivity"), "id").Skip(req.Offset).Limit(limit).Run(session, readOpts(ctx))
+
+	if err != nil {
+		return nil, Error("ListConversation()", err.Error())
+	} else if err := cursor.All(&conversations); err != nil {
+		return nil, Error("ListConversation().All()", err.Error())
+	}
+	return conversations, nil
+}
@@ -6,66 +6,188 @@ package rethink
 
 import (
 	"fmt"
+	"io/ioutil"
+	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/dancannon/gorethink"
-	"github.com/howler-chat/api-service/errors"
 	"github.com/howler-chat/api-service/model"
 	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/store/rethink/migrations"
 	"golang.org/x/net/context"
 )
 
-type RethinkStore struct{}
+type RethinkStore struct {
+	rethinkCtx *RethinkContext
+}
+
+func NewStore(rethinkCtx *RethinkContext) *RethinkStore {
+	return &RethinkStore{rethinkCtx: rethinkCtx}
+}
 
-func NewStore() store.HowlerStore {
-	return &RethinkStore{}
+// Start connecting to rethinkdb, the schema is created or upgraded once connected
+func (self *RethinkStore) Start() {
+	self.rethinkCtx.Start()
+	go self.migrate()
+}
+
+// Apply any pending schema migrations, like the sql store does on start. Deployments created before the
+// 'Conversation' table existed would otherwise fail every message.post. Failures are logged and requests will
+// fail until the schema is fixed with 'migrate up'
+func (self *RethinkStore) migrate() {
+	session, err := self.rethinkCtx.GetRethinkSession(context.Background())
+	if err != nil {
+		// The store stopped before it connected
+		return
+	}
+	migrator := migrations.NewMigrator(session, self.rethinkCtx.Database(), migrations.Options{}, ioutil.Discard)
+	if err := migrator.Up(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"type":    "rethink",
+			"method":  "RethinkStore.Start()",
+			"backend": self.rethinkCtx.name,
+		}).Errorf("Schema migration failed - %s", err.Error())
+	}
+}
+
+func (self *RethinkStore) Stop() {
+	self.rethinkCtx.Stop()
 }
 
 // Insert the message on the requested channel
-func (self *RethinkStore) InsertMessage(ctx context.Context, msg *model.Message) errors.HttpError {
-	session := GetRethinkSession(ctx)
+func (self *RethinkStore) InsertMessage(ctx context.Context, msg *model.Message) error {
+	msg.CreatedAt = time.Now().UTC()
+	return self.insertMessage(ctx, "InsertMessage()", msg)
+}
+
+// Insert the message on the requested channel, keeping the time it was created
+func (self *RethinkStore) ImportMessage(ctx context.Context, msg *model.Message) error {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+	return self.insertMessage(ctx, "ImportMessage()", msg)
+}
+
+func (self *RethinkStore) insertMessage(ctx context.Context, method string, msg *model.Message) error {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return Error(method, err.Error())
+	}
 
-	changed, err := gorethink.Table("Message").Insert(msg).RunWrite(session, runOpts)
+	// Rethinkdb generates the id
+	msg.Id = ""
+	changed, err := gorethink.Table("Message").Insert(msg).RunWrite(session, writeOpts(ctx))
 	if err != nil {
-		return Error(ctx, "InsertMessage()", err.Error())
+		return Error(method, err.Error())
 	} else if changed.Errors != 0 {
-		return Error(ctx, "InsertMessage()", changed.FirstError)
+		return Error(method, changed.FirstError)
 	}
 	if len(changed.GeneratedKeys) == 0 {
-		return Error(ctx, "InsertMessage()",
+		return Error(method,
 			fmt.Sprintf("GeneratedKeys Empty after insert %+v", changed))
 	}
 	msg.Id = changed.GeneratedKeys[0]
+
+	// If the channel is a conversation, record the activity. (Does nothing if the conversation doesn't exist or
+	// was active more recently)
+	_, err = gorethink.Table("Conversation").Get(msg.ChannelId).
+		Update(func(conversation gorethink.Term) interface{} {
+			return gorethink.Branch(conversation.Field("LastActivity").Lt(msg.CreatedAt),
+				map[string]interface{}{"LastActivity": msg.CreatedAt}, map[string]interface{}{})
+		}).RunWrite(session, writeOpts(ctx))
+	if err != nil {
+		return Error(method+".Update()", err.Error())
+	}
 	return nil
 }
 
-// Get a message, will return non nil error if the message doesn't exist
-func (self *RethinkStore) GetMessage(ctx context.Context, req *model.GetMessageRequest) (*model.Message, errors.HttpError) {
-	session := GetRethinkSession(ctx)
+// Get a message, returns ErrNotFound if the message doesn't exist on the requested channel
+func (self *RethinkStore) GetMessage(ctx context.Context, req *model.GetMessageRequest) (*model.Message, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return nil, Error("GetMessage()", err.Error())
+	}
+
+	cursor, err := gorethink.Table("Message").Get(req.MessageId).Run(session, readOpts(ctx))
+	if err != nil {
+		return nil, Error("GetMessage()", err.Error())
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, store.NotFound("Message '%s' not found", req.MessageId)
+	}
 
 	var message model.Message
-	cursor, err := gorethink.Table("Message").
-		Filter(gorethink.Row.Field("ChannelId").Eq(req.ChannelId).
-			And(gorethink.Row.Field("MessageId").Eq(req.MessageId))).Run(session, runOpts)
+	if err := cursor.One(&message); err != nil {
+		return nil, Error("GetMessage().One()", err.Error())
+	}
 
-	if err != nil {
-		return nil, Error(ctx, "GetMessage()", err.Error())
-	} else if err := cursor.One(&message); err != nil {
-		return nil, Error(ctx, "GetMessage().One()", err.Error())
+	// Messages are only visible on the channel they were posted to
+	if message.ChannelId != req.ChannelId {
+		return nil, store.NotFound("Message '%s' not found", req.MessageId)
 	}
 	return &message, nil
 }
 
-func (self *RethinkStore) ListMessage(ctx context.Context, req *model.ListMessageRequest) ([]model.Message, errors.HttpError) {
-	session := GetRethinkSession(ctx)
+func (self *RethinkStore) ListMessage(ctx context.Context, req *model.ListMessageRequest) ([]model.Message, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return nil, Error("ListMessage()", err.Error())
+	}
 
 	var messages []model.Message
 	cursor, err := gorethink.Table("Message").
-		Filter(gorethink.Row.Field("ChannelId").Eq(req.ChannelId)).Run(session, runOpts)
+		GetAllByIndex("ChannelId", req.ChannelId).OrderBy("CreatedAt").Run(session, readOpts(ctx))
 
 	if err != nil {
-		return nil, Error(ctx, "ListMessage()", err.Error())
+		return nil, Error("ListMessage()", err.Error())
 	} else if err := cursor.All(&messages); err != nil {
-		return nil, Error(ctx, "ListMessage().All()", err.Error())
+		return nil, Error("ListMessage().All()", err.Error())
 	}
 	return messages, nil
 }
+
+// Remove every message on the channel, returns the number of messages removed
+func (self *RethinkStore) PurgeChannel(ctx context.Context, channelId string) (int, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return 0, Error("PurgeChannel()", err.Error())
+	}
+
+	changed, err := gorethink.Table("Message").GetAllByIndex("ChannelId", channelId).Delete().
+		RunWrite(session, writeOpts(ctx))
+	if err != nil {
+		return 0, Error("PurgeChannel()", err.Error())
+	} else if changed.Errors != 0 {
+		return 0, Error("PurgeChannel()", changed.FirstError)
+	}
+	return changed.Deleted, nil
+}
+
+func (self *RethinkStore) ListChannelIds(ctx context.Context, userIds []string) ([]string, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return nil, Error("ListChannelIds()", err.Error())
+	}
+
+	keys := make([]interface{}, 0, len(userIds))
+	for _, userId := range userIds {
+		keys = append(keys, userId)
+	}
+
+	// Distinct() returns the channel ids sorted
+	var channelIds []string
+	cursor, err := gorethink.Table("Message").GetAllByIndex("UserId", keys...).Field("ChannelId").Distinct().
+		Run(session, readOpts(ctx))
+
+	if err != nil {
+		return nil, Error("ListChannelIds()", err.Error())
+	} else if err := cursor.All(&channelIds); err != nil {
+		return nil, Error("ListChannelIds().All()", err.Error())
+	}
+	return channelIds, nil
+}
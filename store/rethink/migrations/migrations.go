@@ -0,0 +1,315 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package migrations creates and upgrades the rethinkdb schema used by the rethink store. Migrations are ordered by
+version and the highest version applied is recorded in the 'Migration' table of the database. Every step is
+idempotent, so it is safe to run the migrations on every deploy.
+
+To add a migration append it to the `All` list with the next version number, never modify or re-order a migration
+that has been released. The shard and replica options are not a migration, they are applied to every table each time
+the migrations are run.
+*/
+package migrations
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dancannon/gorethink"
+	"github.com/pkg/errors"
+)
+
+// The table used to record which migrations have been applied
+const MigrationTable = "Migration"
+
+// Options applied to the tables created or reconfigured by the migrations
+type Options struct {
+	// Number of shards for each table, 0 uses the rethinkdb default
+	Shards int
+	// Number of replicas for each table, 0 uses the rethinkdb default
+	Replicas int
+	// Print the changes that would be made, without making them
+	DryRun bool
+}
+
+// The options of a new table. Gorethink only omits options that are nil, so shards, replicas and the primary key
+// are only set if provided and rethinkdb uses its defaults otherwise
+func (self Options) TableCreateOpts(primaryKey string) gorethink.TableCreateOpts {
+	var opts gorethink.TableCreateOpts
+	if primaryKey != "" {
+		opts.PrimaryKey = primaryKey
+	}
+	if self.Shards > 0 {
+		opts.Shards = self.Shards
+	}
+	if self.Replicas > 0 {
+		opts.Replicas = self.Replicas
+	}
+	return opts
+}
+
+// The options to reconfigure a table that currently has `shards` shards of `replicas` replicas. Rethinkdb requires
+// both, so an option not provided keeps the current value
+func (self Options) ReconfigureOpts(shards, replicas int) gorethink.ReconfigureOpts {
+	if self.Shards > 0 {
+		shards = self.Shards
+	}
+	if self.Replicas > 0 {
+		replicas = self.Replicas
+	}
+	return gorethink.ReconfigureOpts{Shards: shards, Replicas: replicas}
+}
+
+// A Migration is a versioned set of schema changes
+type Migration struct {
+	Version     int
+	Description string
+	Steps       []Step
+}
+
+// All the migrations in the order they must be applied
+var All = []Migration{
+	{
+		Version:     1,
+		Description: "Create tables",
+		Steps: []Step{
+			CreateTable{Name: "Message"},
+			CreateTable{Name: "Conversation"},
+			CreateTable{Name: "User"},
+			CreateTable{Name: "UserHandle"},
+			CreateTable{Name: "Team"},
+		},
+	},
+	{
+		Version:     2,
+		Description: "Create secondary indexes",
+		Steps: []Step{
+			CreateIndex{Table: "Message", Name: "ChannelId", Fields: []string{"ChannelId"}},
+			CreateIndex{Table: "Conversation", Name: "Participants", Fields: []string{"Participants"}, Multi: true},
+			CreateIndex{Table: "User", Name: "TeamId", Fields: []string{"TeamId"}},
+		},
+	},
+	{
+		Version:     3,
+		Description: "Create audit events",
+		Steps: []Step{
+			CreateTable{Name: "AuditEvent"},
+			CreateIndex{Table: "AuditEvent", Name: "TeamId", Fields: []string{"TeamId"}},
+		},
+	},
+	{
+		Version:     4,
+		Description: "Index messages by user",
+		Steps: []Step{
+			CreateIndex{Table: "Message", Name: "UserId", Fields: []string{"UserId"}},
+		},
+	},
+	{
+		Version:     5,
+		Description: "Index users by team and lower case handle",
+		Steps: []Step{
+			CreateIndex{Table: "User", Name: "TeamIdHandleKey", Fields: []string{"TeamId", "Handle", "id"},
+				Func: func(row gorethink.Term) interface{} {
+					return []interface{}{row.Field("TeamId"), row.Field("Handle").Downcase(), row.Field("id")}
+				}},
+		},
+	},
+}
+
+// The record stored in the migration table for each migration applied
+type record struct {
+	Version     int `gorethink:"id"`
+	Description string
+	AppliedAt   time.Time
+}
+
+// The Migrator applies migrations to a single database
+type Migrator struct {
+	session    *gorethink.Session
+	db         string
+	opts       Options
+	out        io.Writer
+	migrations []Migration
+}
+
+func NewMigrator(session *gorethink.Session, db string, opts Options, out io.Writer) *Migrator {
+	return &Migrator{
+		session:    session,
+		db:         db,
+		opts:       opts,
+		out:        out,
+		migrations: All,
+	}
+}
+
+// Returns the highest migration version applied to the database, 0 if no migrations have been applied
+func (self *Migrator) Version() (int, error) {
+	exists, err := contains(gorethink.DBList(), self.session, self.db)
+	if err != nil || !exists {
+		return 0, err
+	}
+	exists, err = contains(gorethink.DB(self.db).TableList(), self.session, MigrationTable)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	cursor, err := gorethink.DB(self.db).Table(MigrationTable).Max("id").Field("id").
+		Default(0).Run(self.session)
+	if err != nil {
+		return 0, errors.Wrap(err, "while fetching the current migration version")
+	}
+	defer cursor.Close()
+
+	var version int
+	if err := cursor.One(&version); err != nil {
+		return 0, errors.Wrap(err, "while fetching the current migration version")
+	}
+	return version, nil
+}
+
+// Print the current version and the migrations that have not been applied
+func (self *Migrator) Status() error {
+	version, err := self.Version()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(self.out, "Database '%s' is at version %d\n", self.db, version)
+	pending := self.pending(version)
+	if len(pending) == 0 {
+		fmt.Fprintf(self.out, "No pending migrations\n")
+		return nil
+	}
+	for _, migration := range pending {
+		fmt.Fprintf(self.out, "  Pending %d - %s\n", migration.Version, migration.Description)
+	}
+	return nil
+}
+
+// Apply all pending migrations in order. When DryRun is set, print the changes instead of applying them
+func (self *Migrator) Up() error {
+	if err := self.bootstrap(); err != nil {
+		return err
+	}
+
+	version, err := self.Version()
+	if err != nil {
+		return err
+	}
+
+	pending := self.pending(version)
+	if len(pending) == 0 {
+		fmt.Fprintf(self.out, "Database '%s' is up to date at version %d\n", self.db, version)
+	}
+
+	for _, migration := range pending {
+		fmt.Fprintf(self.out, "Migration %d - %s\n", migration.Version, migration.Description)
+		for _, step := range migration.Steps {
+			if err := self.apply(step); err != nil {
+				return errors.Wrapf(err, "migration %d failed", migration.Version)
+			}
+		}
+
+		if self.opts.DryRun {
+			continue
+		}
+		if err := self.record(migration); err != nil {
+			return err
+		}
+	}
+	return self.reconfigure()
+}
+
+// Apply the shard and replica options to every table. Unlike the migrations this is done on every run, such that
+// changing '--shards' or '--replicas' takes effect the next time the migrations are run
+func (self *Migrator) reconfigure() error {
+	if self.opts.Shards == 0 && self.opts.Replicas == 0 {
+		return nil
+	}
+	fmt.Fprintf(self.out, "Shards and replicas\n")
+	for _, table := range self.tables() {
+		if err := self.apply(Reconfigure{Table: table}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns every table created by the migrations, including the migration table
+func (self *Migrator) tables() []string {
+	tables := []string{MigrationTable}
+	for _, migration := range self.migrations {
+		for _, step := range migration.Steps {
+			if create, ok := step.(CreateTable); ok {
+				tables = append(tables, create.Name)
+			}
+		}
+	}
+	return tables
+}
+
+// Create the database and the migration table, if they don't exist
+func (self *Migrator) bootstrap() error {
+	exists, err := contains(gorethink.DBList(), self.session, self.db)
+	if err != nil {
+		return errors.Wrap(err, "while listing databases")
+	}
+	if !exists {
+		fmt.Fprintf(self.out, "  create database '%s'\n", self.db)
+		if self.opts.DryRun {
+			return nil
+		}
+		if _, err := gorethink.DBCreate(self.db).RunWrite(self.session); err != nil {
+			return errors.Wrapf(err, "while creating database '%s'", self.db)
+		}
+	}
+	return self.apply(CreateTable{Name: MigrationTable})
+}
+
+func (self *Migrator) apply(step Step) error {
+	// When the database doesn't exist yet, none of the steps have been applied
+	applied := false
+	if exists, err := contains(gorethink.DBList(), self.session, self.db); err != nil {
+		return err
+	} else if exists {
+		if applied, err = step.Applied(self.session, self.db, self.opts); err != nil {
+			return errors.Wrapf(err, "while checking '%s'", step.Describe())
+		}
+	}
+
+	if applied {
+		fmt.Fprintf(self.out, "  %s (already applied)\n", step.Describe())
+		return nil
+	}
+
+	fmt.Fprintf(self.out, "  %s\n", step.Describe())
+	if self.opts.DryRun {
+		return nil
+	}
+	return step.Apply(self.session, self.db, self.opts)
+}
+
+func (self *Migrator) record(migration Migration) error {
+	_, err := gorethink.DB(self.db).Table(MigrationTable).Insert(record{
+		Version:     migration.Version,
+		Description: migration.Description,
+		AppliedAt:   time.Now().UTC(),
+	}, gorethink.InsertOpts{Conflict: "replace"}).RunWrite(self.session, gorethink.RunOpts{Durability: "hard"})
+	if err != nil {
+		return errors.Wrapf(err, "while recording migration %d", migration.Version)
+	}
+	return nil
+}
+
+func (self *Migrator) pending(version int) []Migration {
+	var result []Migration
+	for _, migration := range self.migrations {
+		if migration.Version > version {
+			result = append(result, migration)
+		}
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package migrations_test
+
+import (
+	"testing"
+
+	"github.com/howler-chat/api-service/store/rethink/migrations"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMigrations(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Rethink Migrations Suite")
+}
+
+var _ = Describe("Options", func() {
+	Describe("TableCreateOpts()", func() {
+		It("should leave shards, replicas and the primary key to rethinkdb if not provided", func() {
+			opts := migrations.Options{}.TableCreateOpts("")
+			Expect(opts.Shards).To(BeNil())
+			Expect(opts.Replicas).To(BeNil())
+			Expect(opts.PrimaryKey).To(BeNil())
+		})
+
+		It("should only set the options provided", func() {
+			opts := migrations.Options{Shards: 2}.TableCreateOpts("Id")
+			Expect(opts.Shards).To(Equal(2))
+			Expect(opts.Replicas).To(BeNil())
+			Expect(opts.PrimaryKey).To(Equal("Id"))
+		})
+	})
+
+	Describe("ReconfigureOpts()", func() {
+		It("should keep the current shards when only replicas are provided", func() {
+			opts := migrations.Options{Replicas: 3}.ReconfigureOpts(4, 1)
+			Expect(opts.Shards).To(Equal(4))
+			Expect(opts.Replicas).To(Equal(3))
+		})
+
+		It("should keep the current replicas when only shards are provided", func() {
+			opts := migrations.Options{Shards: 2}.ReconfigureOpts(4, 1)
+			Expect(opts.Shards).To(Equal(2))
+			Expect(opts.Replicas).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,165 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dancannon/gorethink"
+	"github.com/pkg/errors"
+)
+
+// A Step is a single idempotent schema change. Every step checks the current state of the database before making
+// a change, so a migration interrupted half way can safely be run again.
+type Step interface {
+	// A human readable description of the change, used by status and dry-run
+	Describe() string
+	// Returns true if the database already reflects this change
+	Applied(session *gorethink.Session, db string, opts Options) (bool, error)
+	// Make the change
+	Apply(session *gorethink.Session, db string, opts Options) error
+}
+
+// Creates a table if it doesn't exist
+type CreateTable struct {
+	Name       string
+	PrimaryKey string
+}
+
+func (self CreateTable) Describe() string {
+	return fmt.Sprintf("create table '%s'", self.Name)
+}
+
+func (self CreateTable) Applied(session *gorethink.Session, db string, opts Options) (bool, error) {
+	return contains(gorethink.DB(db).TableList(), session, self.Name)
+}
+
+func (self CreateTable) Apply(session *gorethink.Session, db string, opts Options) error {
+	_, err := gorethink.DB(db).TableCreate(self.Name, opts.TableCreateOpts(self.PrimaryKey)).RunWrite(session)
+	if err != nil {
+		return errors.Wrapf(err, "while creating table '%s'", self.Name)
+	}
+	return waitFor(gorethink.DB(db).Table(self.Name).Wait(), session)
+}
+
+// Creates a secondary index if it doesn't exist. If more than one field is provided a compound index is created.
+// If Func is provided it computes the index value and Fields only describes the index
+type CreateIndex struct {
+	Table  string
+	Name   string
+	Fields []string
+	Multi  bool
+	Func   func(row gorethink.Term) interface{}
+}
+
+func (self CreateIndex) Describe() string {
+	return fmt.Sprintf("create index '%s' on '%s' (%s)", self.Name, self.Table, strings.Join(self.Fields, ", "))
+}
+
+func (self CreateIndex) Applied(session *gorethink.Session, db string, opts Options) (bool, error) {
+	return contains(gorethink.DB(db).Table(self.Table).IndexList(), session, self.Name)
+}
+
+func (self CreateIndex) Apply(session *gorethink.Session, db string, opts Options) error {
+	table := gorethink.DB(db).Table(self.Table)
+	indexOpts := gorethink.IndexCreateOpts{Multi: self.Multi}
+
+	var term gorethink.Term
+	if self.Func != nil {
+		term = table.IndexCreateFunc(self.Name, self.Func, indexOpts)
+	} else if len(self.Fields) == 1 {
+		term = table.IndexCreateFunc(self.Name, func(row gorethink.Term) interface{} {
+			return row.Field(self.Fields[0])
+		}, indexOpts)
+	} else {
+		term = table.IndexCreateFunc(self.Name, func(row gorethink.Term) interface{} {
+			var fields []interface{}
+			for _, field := range self.Fields {
+				fields = append(fields, row.Field(field))
+			}
+			return fields
+		}, indexOpts)
+	}
+
+	if _, err := term.RunWrite(session); err != nil {
+		return errors.Wrapf(err, "while creating index '%s' on '%s'", self.Name, self.Table)
+	}
+	return waitFor(table.IndexWait(self.Name), session)
+}
+
+// Changes the number of shards and replicas of a table to match the options provided to the migration. Unless
+// no shard or replica options were provided this step is always applied, as the options may differ between runs
+type Reconfigure struct {
+	Table string
+}
+
+func (self Reconfigure) Describe() string {
+	return fmt.Sprintf("reconfigure shards and replicas of '%s'", self.Table)
+}
+
+func (self Reconfigure) Applied(session *gorethink.Session, db string, opts Options) (bool, error) {
+	return opts.Shards == 0 && opts.Replicas == 0, nil
+}
+
+func (self Reconfigure) Apply(session *gorethink.Session, db string, opts Options) error {
+	// Rethinkdb requires both shards and replicas, an option not provided keeps the current value of the table
+	var shards, replicas int
+	if opts.Shards == 0 || opts.Replicas == 0 {
+		var err error
+		if shards, replicas, err = tableConfig(session, db, self.Table); err != nil {
+			return err
+		}
+	}
+
+	_, err := gorethink.DB(db).Table(self.Table).Reconfigure(opts.ReconfigureOpts(shards, replicas)).Run(session)
+	if err != nil {
+		return errors.Wrapf(err, "while reconfiguring '%s'", self.Table)
+	}
+	return waitFor(gorethink.DB(db).Table(self.Table).Wait(), session)
+}
+
+// Returns the number of shards of the table and the number of replicas of its first shard
+func tableConfig(session *gorethink.Session, db, table string) (int, int, error) {
+	cursor, err := gorethink.DB(db).Table(table).Config().Field("shards").Run(session)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "while reading the config of '%s'", table)
+	}
+	defer cursor.Close()
+
+	var shards []struct {
+		Replicas []string `gorethink:"replicas"`
+	}
+	if err := cursor.One(&shards); err != nil {
+		return 0, 0, errors.Wrapf(err, "while reading the config of '%s'", table)
+	}
+	if len(shards) == 0 {
+		return 0, 0, errors.Errorf("table '%s' has no shards", table)
+	}
+	return len(shards), len(shards[0].Replicas), nil
+}
+
+// Returns true if the list returned by the term contains the value
+func contains(term gorethink.Term, session *gorethink.Session, value string) (bool, error) {
+	cursor, err := term.Contains(value).Run(session)
+	if err != nil {
+		return false, err
+	}
+	defer cursor.Close()
+
+	var result bool
+	if err := cursor.One(&result); err != nil {
+		return false, err
+	}
+	return result, nil
+}
+
+func waitFor(term gorethink.Term, session *gorethink.Session) error {
+	cursor, err := term.Run(session)
+	if err != nil {
+		return errors.Wrap(err, "while waiting for rethinkdb")
+	}
+	return cursor.Close()
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rethink_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/dancannon/gorethink"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/store/rethink"
+	"github.com/howler-chat/api-service/store/rethink/migrations"
+	"github.com/howler-chat/api-service/store/storetest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRethinkStore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Rethink Store Suite")
+}
+
+var migrate sync.Once
+
+// Only runs if a rethinkdb cluster is available, IE: RETHINK_ENDPOINTS=localhost:28015
+var _ = storetest.DescribeStore("Rethink", func() store.Backend {
+	endpoints := os.Getenv("RETHINK_ENDPOINTS")
+	if endpoints == "" {
+		Skip("RETHINK_ENDPOINTS not set")
+	}
+
+	dsn, err := url.Parse("rethink://" + endpoints + "/howler_test")
+	Expect(err).To(BeNil())
+
+	// Create the schema the first time through
+	migrate.Do(func() {
+		connectOpts, err := rethink.ParseDSN(dsn)
+		Expect(err).To(BeNil())
+		session, err := gorethink.Connect(connectOpts)
+		Expect(err).To(BeNil())
+		defer session.Close()
+		Expect(migrations.NewMigrator(session, connectOpts.Database, migrations.Options{},
+			ioutil.Discard).Up()).To(Succeed())
+	})
+
+	backend, err := rethink.NewBackend("test", dsn)
+	Expect(err).To(BeNil())
+	backend.Start()
+	return backend
+})
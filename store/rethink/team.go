@@ -0,0 +1,36 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rethink
+
+import (
+	"github.com/dancannon/gorethink"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"golang.org/x/net/context"
+)
+
+// Get a team, returns ErrNotFound if the team doesn't exist
+func (self *RethinkStore) GetTeam(ctx context.Context, id string) (*model.Team, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return nil, Error("GetTeam()", err.Error())
+	}
+
+	cursor, err := gorethink.Table("Team").Get(id).Run(session, readOpts(ctx))
+	if err != nil {
+		return nil, Error("GetTeam()", err.Error())
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, store.NotFound("Team '%s' not found", id)
+	}
+
+	var team model.Team
+	if err := cursor.One(&team); err != nil {
+		return nil, Error("GetTeam().One()", err.Error())
+	}
+	return &team, nil
+}
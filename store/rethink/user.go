@@ -0,0 +1,200 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rethink
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dancannon/gorethink"
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/howler-chat/api-service/validate"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// RethinkDB has no unique secondary indexes, so handles are reserved by inserting a document into the 'UserHandle'
+// table whose primary key is the team and lower case handle. The insert fails if another user holds the handle.
+type userHandle struct {
+	Id     string `gorethink:"id"`
+	UserId string
+}
+
+func handleKey(user *model.User) string {
+	return fmt.Sprintf("%s:%s", user.TeamId, user.HandleKey())
+}
+
+// Reserve the users handle within the team, returns ErrConflict if another user holds the handle. Returns true if
+// the handle was reserved by this call, false if the user already held it
+func reserveHandle(ctx context.Context, session *gorethink.Session, user *model.User) (bool, error) {
+	changed, err := gorethink.Table("UserHandle").
+		Insert(userHandle{Id: handleKey(user), UserId: user.Id}).RunWrite(session, writeOpts(ctx))
+	if err != nil {
+		return false, Error("reserveHandle()", err.Error())
+	}
+	if changed.Errors == 0 {
+		return true, nil
+	}
+	if !isDuplicateKey(changed.FirstError) {
+		return false, Error("reserveHandle()", changed.FirstError)
+	}
+
+	// The user may already hold the handle
+	var existing userHandle
+	cursor, err := gorethink.Table("UserHandle").Get(handleKey(user)).Run(session, readOpts(ctx))
+	if err != nil {
+		return false, Error("reserveHandle().Get()", err.Error())
+	}
+	defer cursor.Close()
+	if err := cursor.One(&existing); err != nil {
+		return false, Error("reserveHandle().One()", err.Error())
+	}
+	if existing.UserId != user.Id {
+		return false, store.Conflict("Handle '%s' is already taken", user.Handle)
+	}
+	return false, nil
+}
+
+func isDuplicateKey(msg string) bool {
+	return strings.HasPrefix(msg, "Duplicate primary key")
+}
+
+// Release the handle, if it is still held by the user
+func releaseHandle(ctx context.Context, session *gorethink.Session, user *model.User) error {
+	_, err := gorethink.Table("UserHandle").Get(handleKey(user)).
+		Filter(gorethink.Row.Field("UserId").Eq(user.Id)).Delete().RunWrite(session, writeOpts(ctx))
+	if err != nil {
+		return Error("releaseHandle()", err.Error())
+	}
+	return nil
+}
+
+func (self *RethinkStore) InsertUser(ctx context.Context, user *model.User) error {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return Error("InsertUser()", err.Error())
+	}
+
+	// Generate the id before reserving the handle, so the reservation can reference the user
+	if user.Id == "" {
+		user.Id = utils.NewId()
+	}
+
+	reserved, err := reserveHandle(ctx, session, user)
+	if err != nil {
+		return err
+	}
+
+	changed, err := gorethink.Table("User").Insert(user).RunWrite(session, writeOpts(ctx))
+	if err == nil && changed.Errors != 0 {
+		err = errors.New(changed.FirstError)
+	}
+	if err != nil {
+		// Don't leave the handle reserved by a user that doesn't exist
+		if reserved {
+			releaseHandle(ctx, session, user)
+		}
+		if isDuplicateKey(err.Error()) {
+			return store.Conflict("User '%s' already exists", user.Id)
+		}
+		return Error("InsertUser()", err.Error())
+	}
+	return nil
+}
+
+// Get a user, returns ErrNotFound if the user doesn't exist
+func (self *RethinkStore) GetUser(ctx context.Context, id string) (*model.User, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return nil, Error("GetUser()", err.Error())
+	}
+
+	cursor, err := gorethink.Table("User").Get(id).Run(session, readOpts(ctx))
+	if err != nil {
+		return nil, Error("GetUser()", err.Error())
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, store.NotFound("User '%s' not found", id)
+	}
+
+	var user model.User
+	if err := cursor.One(&user); err != nil {
+		return nil, Error("GetUser().One()", err.Error())
+	}
+	return &user, nil
+}
+
+func (self *RethinkStore) ListUser(ctx context.Context, req *model.ListUserRequest) ([]model.User, error) {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return nil, Error("ListUser()", err.Error())
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = validate.DefaultLimit
+	}
+
+	// Order by the lower case handle with the id as a tie breaker, the same order the other backends use
+	query := gorethink.Table("User").Between(
+		[]interface{}{req.TeamId, gorethink.MinVal, gorethink.MinVal},
+		[]interface{}{req.TeamId, gorethink.MaxVal, gorethink.MaxVal},
+		gorethink.BetweenOpts{Index: "TeamIdHandleKey"},
+	).OrderBy(gorethink.OrderByOpts{Index: "TeamIdHandleKey"})
+	if !req.IncludeDeactivated {
+		query = query.Filter(gorethink.Row.Field("Deactivated").Eq(false))
+	}
+
+	var users []model.User
+	cursor, err := query.Skip(req.Offset).Limit(limit).Run(session, readOpts(ctx))
+
+	if err != nil {
+		return nil, Error("ListUser()", err.Error())
+	} else if err := cursor.All(&users); err != nil {
+		return nil, Error("ListUser().All()", err.Error())
+	}
+	return users, nil
+}
+
+func (self *RethinkStore) UpdateUser(ctx context.Context, user *model.User) error {
+	session, err := self.rethinkCtx.GetRethinkSession(ctx)
+	if err != nil {
+		return Error("UpdateUser()", err.Error())
+	}
+
+	existing, err := self.GetUser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	// Reserve the new handle before we release the old one
+	handleChanged := handleKey(existing) != handleKey(user)
+	reserved := false
+	if handleChanged {
+		if reserved, err = reserveHandle(ctx, session, user); err != nil {
+			return err
+		}
+	}
+
+	changed, err := gorethink.Table("User").Get(user.Id).Replace(user).RunWrite(session, writeOpts(ctx))
+	if err == nil && changed.Errors != 0 {
+		err = errors.New(changed.FirstError)
+	}
+	if err != nil {
+		if reserved {
+			releaseHandle(ctx, session, user)
+		}
+		return Error("UpdateUser()", err.Error())
+	}
+
+	if handleChanged {
+		return releaseHandle(ctx, session, existing)
+	}
+	return nil
+}
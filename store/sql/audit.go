@@ -0,0 +1,92 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"time"
+
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/howler-chat/api-service/validate"
+	"golang.org/x/net/context"
+)
+
+const auditColumns = "id, team_id, action, actor_id, target_type, target_id, before_value, after_value, " +
+	"request_id, created_at"
+
+func (self *SqlStore) InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	if event.Id == "" {
+		event.Id = utils.NewId()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := self.db.ExecContext(ctx, self.rebind("INSERT INTO audit_event ("+auditColumns+") VALUES ("+
+		placeholders(10)+")"), event.Id, event.TeamId, event.Action, event.ActorId, event.TargetType,
+		event.TargetId, string(event.Before), string(event.After), event.RequestId, event.CreatedAt)
+	if err != nil {
+		return Error("InsertAuditEvent()", err.Error())
+	}
+	return nil
+}
+
+func (self *SqlStore) ListAuditEvent(ctx context.Context, req *model.ListAuditRequest) ([]model.AuditEvent, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = validate.DefaultLimit
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit_event WHERE team_id = ?"
+	params := []interface{}{req.TeamId}
+	filter := func(clause string, value interface{}) {
+		query += " AND " + clause
+		params = append(params, value)
+	}
+	if req.Action != "" {
+		filter("action = ?", req.Action)
+	}
+	if req.ActorId != "" {
+		filter("actor_id = ?", req.ActorId)
+	}
+	if req.TargetId != "" {
+		filter("target_id = ?", req.TargetId)
+	}
+	if !req.Since.IsZero() {
+		filter("created_at >= ?", req.Since.UTC())
+	}
+	if !req.Until.IsZero() {
+		filter("created_at < ?", req.Until.UTC())
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	params = append(params, limit)
+
+	rows, err := self.db.QueryContext(ctx, self.rebind(query), params...)
+	if err != nil {
+		return nil, Error("ListAuditEvent()", err.Error())
+	}
+	defer rows.Close()
+
+	var events []model.AuditEvent
+	for rows.Next() {
+		var event model.AuditEvent
+		var before, after string
+		if err := rows.Scan(&event.Id, &event.TeamId, &event.Action, &event.ActorId, &event.TargetType,
+			&event.TargetId, &before, &after, &event.RequestId, &event.CreatedAt); err != nil {
+			return nil, Error("ListAuditEvent().Scan()", err.Error())
+		}
+		if before != "" {
+			event.Before = []byte(before)
+		}
+		if after != "" {
+			event.After = []byte(after)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Error("ListAuditEvent().Next()", err.Error())
+	}
+	return events, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	stdSql "database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/validate"
+	"golang.org/x/net/context"
+)
+
+// Find the conversation with the same id, or create it if it doesn't exist. On return `conversation` contains the
+// stored version of the conversation, the bool is true if this call created it
+func (self *SqlStore) OpenConversation(ctx context.Context, conversation *model.Conversation) (bool, error) {
+	now := time.Now().UTC()
+	conversation.CreatedAt = now
+	conversation.LastActivity = now
+
+	err := self.insertConversation(ctx, conversation)
+	// Another request created the conversation first
+	if err != nil && !isUniqueViolation(err) {
+		return false, Error("OpenConversation()", err.Error())
+	}
+	created := err == nil
+
+	existing, err := self.GetConversation(ctx, conversation.Id)
+	if err != nil {
+		return false, err
+	}
+
+	// Conversation ids are derived from a hash of the participants, guard against collisions
+	if strings.Join(existing.Participants, ",") != strings.Join(conversation.Participants, ",") {
+		return false, store.Conflict("Conversation '%s' already exists with different participants",
+			conversation.Id)
+	}
+	*conversation = *existing
+	return created, nil
+}
+
+func (self *SqlStore) insertConversation(ctx context.Context, conversation *model.Conversation) error {
+	tx, err := self.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, self.rebind(
+		"INSERT INTO conversation (id, created_at, last_activity) VALUES (?, ?, ?)"),
+		conversation.Id, conversation.CreatedAt, conversation.LastActivity)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, userId := range conversation.Participants {
+		_, err = tx.ExecContext(ctx, self.rebind(
+			"INSERT INTO conversation_participant (conversation_id, user_id) VALUES (?, ?)"),
+			conversation.Id, userId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Get a conversation, returns ErrNotFound if the conversation doesn't exist
+func (self *SqlStore) GetConversation(ctx context.Context, id string) (*model.Conversation, error) {
+	var conversation model.Conversation
+	err := self.db.QueryRowContext(ctx, self.rebind(
+		"SELECT id, created_at, last_activity FROM conversation WHERE id = ?"), id).
+		Scan(&conversation.Id, &conversation.CreatedAt, &conversation.LastActivity)
+
+	if err == stdSql.ErrNoRows {
+		return nil, store.NotFound("Conversation '%s' not found", id)
+	} else if err != nil {
+		return nil, Error("GetConversation()", err.Error())
+	}
+
+	conversations := []model.Conversation{conversation}
+	if err := self.fetchParticipants(ctx, conversations); err != nil {
+		return nil, Error("GetConversation()", err.Error())
+	}
+	return &conversations[0], nil
+}
+
+func (self *SqlStore) ListConversation(ctx context.Context, req *model.ListConversationRequest) ([]model.Conversation, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = validate.DefaultLimit
+	}
+
+	rows, err := self.db.QueryContext(ctx, self.rebind(
+		"SELECT c.id, c.created_at, c.last_activity FROM conversation c "+
+			"JOIN conversation_participant p ON p.conversation_id = c.id "+
+			"WHERE p.user_id = ? ORDER BY c.last_activity DESC, c.id LIMIT ? OFFSET ?"), req.UserId, limit, req.Offset)
+	if err != nil {
+		return nil, Error("ListConversation()", err.Error())
+	}
+	defer rows.Close()
+
+	var conversations []model.Conversation
+	for rows.Next() {
+		var conversation model.Conversation
+		if err := rows.Scan(&conversation.Id, &conversation.CreatedAt, &conversation.LastActivity); err != nil {
+			return nil, Error("ListConversation().Scan()", err.Error())
+		}
+		conversations = append(conversations, conversation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Error("ListConversation().Next()", err.Error())
+	}
+
+	if err := self.fetchParticipants(ctx, conversations); err != nil {
+		return nil, Error("ListConversation()", err.Error())
+	}
+	return conversations, nil
+}
+
+// Fill in the participants of the conversations provided with a single query
+func (self *SqlStore) fetchParticipants(ctx context.Context, conversations []model.Conversation) error {
+	if len(conversations) == 0 {
+		return nil
+	}
+
+	index := make(map[string]*model.Conversation, len(conversations))
+	ids := make([]interface{}, 0, len(conversations))
+	for i := range conversations {
+		index[conversations[i].Id] = &conversations[i]
+		ids = append(ids, conversations[i].Id)
+	}
+
+	rows, err := self.db.QueryContext(ctx, self.rebind(fmt.Sprintf(
+		"SELECT conversation_id, user_id FROM conversation_participant WHERE conversation_id IN (%s)",
+		placeholders(len(ids)))), ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var conversationId, userId string
+		if err := rows.Scan(&conversationId, &userId); err != nil {
+			return err
+		}
+		conversation := index[conversationId]
+		conversation.Participants = append(conversation.Participants, userId)
+	}
+
+	// Participants are always sorted, as they are in the other stores
+	for _, conversation := range index {
+		sort.Strings(conversation.Participants)
+	}
+	return rows.Err()
+}
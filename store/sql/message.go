@@ -0,0 +1,133 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	stdSql "database/sql"
+	"fmt"
+	"time"
+
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"golang.org/x/net/context"
+)
+
+// Insert the message on the requested channel
+func (self *SqlStore) InsertMessage(ctx context.Context, msg *model.Message) error {
+	msg.CreatedAt = time.Now().UTC()
+	return self.insertMessage(ctx, "InsertMessage()", msg)
+}
+
+// Insert the message on the requested channel, keeping the time it was created
+func (self *SqlStore) ImportMessage(ctx context.Context, msg *model.Message) error {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+	return self.insertMessage(ctx, "ImportMessage()", msg)
+}
+
+func (self *SqlStore) insertMessage(ctx context.Context, method string, msg *model.Message) error {
+	msg.Id = utils.NewId()
+	_, err := self.db.ExecContext(ctx, self.rebind(
+		"INSERT INTO message (id, channel_id, user_id, text, created_at) VALUES (?, ?, ?, ?, ?)"),
+		msg.Id, msg.ChannelId, msg.UserId, msg.Text, msg.CreatedAt)
+	if err != nil {
+		return Error(method, err.Error())
+	}
+
+	// If the channel is a conversation, record the activity. (Does nothing if the conversation doesn't exist or
+	// was active more recently)
+	_, err = self.db.ExecContext(ctx, self.rebind(
+		"UPDATE conversation SET last_activity = ? WHERE id = ? AND last_activity < ?"),
+		msg.CreatedAt, msg.ChannelId, msg.CreatedAt)
+	if err != nil {
+		return Error(method+".Update()", err.Error())
+	}
+	return nil
+}
+
+// Get a message, returns ErrNotFound if the message doesn't exist on the requested channel
+func (self *SqlStore) GetMessage(ctx context.Context, req *model.GetMessageRequest) (*model.Message, error) {
+	var msg model.Message
+	err := self.db.QueryRowContext(ctx, self.rebind(
+		"SELECT id, channel_id, user_id, text, created_at FROM message WHERE id = ? AND channel_id = ?"),
+		req.MessageId, req.ChannelId).Scan(&msg.Id, &msg.ChannelId, &msg.UserId, &msg.Text, &msg.CreatedAt)
+
+	if err == stdSql.ErrNoRows {
+		return nil, store.NotFound("Message '%s' not found", req.MessageId)
+	} else if err != nil {
+		return nil, Error("GetMessage()", err.Error())
+	}
+	return &msg, nil
+}
+
+func (self *SqlStore) ListMessage(ctx context.Context, req *model.ListMessageRequest) ([]model.Message, error) {
+	rows, err := self.db.QueryContext(ctx, self.rebind(
+		"SELECT id, channel_id, user_id, text, created_at FROM message WHERE channel_id = ? ORDER BY created_at, id"),
+		req.ChannelId)
+	if err != nil {
+		return nil, Error("ListMessage()", err.Error())
+	}
+	defer rows.Close()
+
+	var messages []model.Message
+	for rows.Next() {
+		var msg model.Message
+		if err := rows.Scan(&msg.Id, &msg.ChannelId, &msg.UserId, &msg.Text, &msg.CreatedAt); err != nil {
+			return nil, Error("ListMessage().Scan()", err.Error())
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Error("ListMessage().Next()", err.Error())
+	}
+	return messages, nil
+}
+
+// Remove every message on the channel, returns the number of messages removed
+func (self *SqlStore) PurgeChannel(ctx context.Context, channelId string) (int, error) {
+	result, err := self.db.ExecContext(ctx, self.rebind("DELETE FROM message WHERE channel_id = ?"), channelId)
+	if err != nil {
+		return 0, Error("PurgeChannel()", err.Error())
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, Error("PurgeChannel().RowsAffected()", err.Error())
+	}
+	return int(count), nil
+}
+
+func (self *SqlStore) ListChannelIds(ctx context.Context, userIds []string) ([]string, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+
+	params := make([]interface{}, 0, len(userIds))
+	for _, userId := range userIds {
+		params = append(params, userId)
+	}
+	rows, err := self.db.QueryContext(ctx, self.rebind(fmt.Sprintf(
+		"SELECT DISTINCT channel_id FROM message WHERE user_id IN (%s) ORDER BY channel_id",
+		placeholders(len(params)))), params...)
+	if err != nil {
+		return nil, Error("ListChannelIds()", err.Error())
+	}
+	defer rows.Close()
+
+	var channelIds []string
+	for rows.Next() {
+		var channelId string
+		if err := rows.Scan(&channelId); err != nil {
+			return nil, Error("ListChannelIds().Scan()", err.Error())
+		}
+		channelIds = append(channelIds, channelId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Error("ListChannelIds().Next()", err.Error())
+	}
+	return channelIds, nil
+}
@@ -0,0 +1,249 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	stdSql "database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Migration is a versioned set of schema changes. Each migration is applied in a single transaction.
+// Never modify or re-order a migration that has been released, append a new one instead.
+type Migration struct {
+	Version     int
+	Description string
+	// Returns the statements to execute for the dialect provided
+	Statements func(dialect Dialect) []string
+}
+
+// All the migrations in the order they must be applied
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Create messages, conversations, users and teams",
+		Statements: func(dialect Dialect) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS message (
+					id VARCHAR(64) PRIMARY KEY,
+					channel_id VARCHAR(64) NOT NULL,
+					user_id VARCHAR(64) NOT NULL,
+					text TEXT NOT NULL,
+					created_at %s NOT NULL
+				)`, dialect.Timestamp),
+				`CREATE INDEX IF NOT EXISTS message_channel_created ON message (channel_id, created_at)`,
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS conversation (
+					id VARCHAR(64) PRIMARY KEY,
+					created_at %[1]s NOT NULL,
+					last_activity %[1]s NOT NULL
+				)`, dialect.Timestamp),
+				`CREATE TABLE IF NOT EXISTS conversation_participant (
+					conversation_id VARCHAR(64) NOT NULL REFERENCES conversation (id),
+					user_id VARCHAR(64) NOT NULL,
+					PRIMARY KEY (conversation_id, user_id)
+				)`,
+				`CREATE INDEX IF NOT EXISTS conversation_participant_user ON conversation_participant (user_id)`,
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS team (
+					id VARCHAR(64) PRIMARY KEY,
+					name VARCHAR(255) NOT NULL,
+					domain VARCHAR(255) NOT NULL,
+					created_at %s NOT NULL
+				)`, dialect.Timestamp),
+				// Handles are unique within a team regardless of case, 'handle_key' is the lower case handle
+				`CREATE TABLE IF NOT EXISTS howler_user (
+					id VARCHAR(64) PRIMARY KEY,
+					team_id VARCHAR(64) NOT NULL,
+					handle VARCHAR(64) NOT NULL,
+					handle_key VARCHAR(64) NOT NULL,
+					display_name VARCHAR(255) NOT NULL,
+					avatar_url TEXT NOT NULL,
+					timezone VARCHAR(64) NOT NULL,
+					status VARCHAR(255) NOT NULL,
+					deactivated BOOLEAN NOT NULL,
+					UNIQUE (team_id, handle_key)
+				)`,
+			}
+		},
+	},
+	{
+		Version:     2,
+		Description: "Create audit events",
+		Statements: func(dialect Dialect) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS audit_event (
+					id VARCHAR(64) PRIMARY KEY,
+					team_id VARCHAR(64) NOT NULL,
+					action VARCHAR(64) NOT NULL,
+					actor_id VARCHAR(64) NOT NULL,
+					target_type VARCHAR(64) NOT NULL,
+					target_id VARCHAR(64) NOT NULL,
+					before_value TEXT NOT NULL,
+					after_value TEXT NOT NULL,
+					request_id VARCHAR(64) NOT NULL,
+					created_at %s NOT NULL
+				)`, dialect.Timestamp),
+				`CREATE INDEX IF NOT EXISTS audit_event_team_created ON audit_event (team_id, created_at)`,
+			}
+		},
+	},
+	{
+		Version:     3,
+		Description: "Index messages by user",
+		Statements: func(dialect Dialect) []string {
+			return []string{
+				`CREATE INDEX IF NOT EXISTS message_user_channel ON message (user_id, channel_id)`,
+			}
+		},
+	},
+}
+
+// The Migrator applies migrations to a single database
+type Migrator struct {
+	db      *stdSql.DB
+	dialect Dialect
+	dryRun  bool
+	out     io.Writer
+}
+
+// When dryRun is true the statements are printed to `out` instead of being executed
+func NewMigrator(db *stdSql.DB, dialect Dialect, dryRun bool, out io.Writer) *Migrator {
+	return &Migrator{
+		db:      db,
+		dialect: dialect,
+		dryRun:  dryRun,
+		out:     out,
+	}
+}
+
+// Returns the highest migration version applied, 0 if no migrations have been applied. Does not modify the database
+func (self *Migrator) Version() (int, error) {
+	exists, err := self.hasMigrationTable()
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version stdSql.NullInt64
+	if err := self.db.QueryRow("SELECT MAX(version) FROM schema_migration").Scan(&version); err != nil {
+		return 0, errors.Wrap(err, "while fetching the current migration version")
+	}
+	return int(version.Int64), nil
+}
+
+// Print the current version and the migrations that have not been applied
+func (self *Migrator) Status() error {
+	version, err := self.Version()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(self.out, "Database is at version %d\n", version)
+	pending := self.pending(version)
+	if len(pending) == 0 {
+		fmt.Fprintf(self.out, "No pending migrations\n")
+		return nil
+	}
+	for _, migration := range pending {
+		fmt.Fprintf(self.out, "  Pending %d - %s\n", migration.Version, migration.Description)
+	}
+	return nil
+}
+
+// Apply all pending migrations in order
+func (self *Migrator) Up() error {
+	if err := self.bootstrap(); err != nil {
+		return err
+	}
+
+	version, err := self.Version()
+	if err != nil {
+		return err
+	}
+
+	pending := self.pending(version)
+	if len(pending) == 0 {
+		fmt.Fprintf(self.out, "Database is up to date at version %d\n", version)
+		return nil
+	}
+
+	for _, migration := range pending {
+		fmt.Fprintf(self.out, "Migration %d - %s\n", migration.Version, migration.Description)
+		if err := self.apply(migration); err != nil {
+			return errors.Wrapf(err, "migration %d failed", migration.Version)
+		}
+	}
+	return nil
+}
+
+func (self *Migrator) apply(migration Migration) error {
+	statements := migration.Statements(self.dialect)
+	if self.dryRun {
+		for _, statement := range statements {
+			fmt.Fprintf(self.out, "%s;\n", strings.TrimSpace(statement))
+		}
+		return nil
+	}
+
+	tx, err := self.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "while executing '%s'", strings.TrimSpace(statement))
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO schema_migration (version, description, applied_at) VALUES (%s, %s, %s)",
+		self.dialect.Placeholder(1), self.dialect.Placeholder(2), self.dialect.Placeholder(3))
+	if _, err := tx.Exec(query, migration.Version, migration.Description, time.Now().UTC()); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "while recording migration")
+	}
+	return tx.Commit()
+}
+
+// Create the table that records the migrations applied, if it doesn't exist
+func (self *Migrator) bootstrap() error {
+	statement := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS schema_migration (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at %s NOT NULL
+	)`, self.dialect.Timestamp)
+
+	if self.dryRun {
+		if exists, err := self.hasMigrationTable(); err != nil || exists {
+			return err
+		}
+		fmt.Fprintf(self.out, "%s;\n", statement)
+		return nil
+	}
+	if _, err := self.db.Exec(statement); err != nil {
+		return errors.Wrap(err, "while creating the schema_migration table")
+	}
+	return nil
+}
+
+func (self *Migrator) hasMigrationTable() (bool, error) {
+	var count int
+	if err := self.db.QueryRow(self.dialect.TableExists, "schema_migration").Scan(&count); err != nil {
+		return false, errors.Wrap(err, "while checking for the schema_migration table")
+	}
+	return count != 0, nil
+}
+
+func (self *Migrator) pending(version int) []Migration {
+	var result []Migration
+	for _, migration := range Migrations {
+		if migration.Version > version {
+			result = append(result, migration)
+		}
+	}
+	return result
+}
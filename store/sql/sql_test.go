@@ -0,0 +1,116 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sql_test
+
+import (
+	"bytes"
+	stdSql "database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/store/sql"
+	"github.com/howler-chat/api-service/store/storetest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSqlStore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SQL Store Suite")
+}
+
+func newBackend(dsn string) store.Backend {
+	parsed, err := url.Parse(dsn)
+	Expect(err).To(BeNil())
+	backend, err := sql.NewBackend("test", parsed)
+	Expect(err).To(BeNil())
+	backend.Start()
+	return backend
+}
+
+var _ = storetest.DescribeStore("SQLite", func() store.Backend {
+	return newBackend("sqlite:///:memory:")
+})
+
+// Only runs if a postgres database is available, IE: 'postgres://howler@localhost/howler_test?sslmode=disable'
+var _ = storetest.DescribeStore("PostgreSQL", func() store.Backend {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		Skip("POSTGRES_DSN not set")
+	}
+	return newBackend(dsn)
+})
+
+var _ = Describe("Migrator", func() {
+	var db *stdSql.DB
+
+	BeforeEach(func() {
+		var err error
+		db, err = stdSql.Open("sqlite3", "file::memory:")
+		Expect(err).To(BeNil())
+		db.SetMaxOpenConns(1)
+	})
+
+	AfterEach(func() {
+		db.Close()
+	})
+
+	tables := func() int {
+		var count int
+		Expect(db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&count)).To(Succeed())
+		return count
+	}
+
+	It("should report version 0 without creating tables", func() {
+		version, err := sql.NewMigrator(db, sql.SQLite, false, ioutil.Discard).Version()
+		Expect(err).To(BeNil())
+		Expect(version).To(Equal(0))
+		Expect(tables()).To(Equal(0))
+	})
+
+	It("should not create tables on a dry run", func() {
+		var out bytes.Buffer
+		Expect(sql.NewMigrator(db, sql.SQLite, true, &out).Up()).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("CREATE TABLE IF NOT EXISTS schema_migration"))
+		Expect(tables()).To(Equal(0))
+	})
+
+	It("should report the version applied", func() {
+		Expect(sql.NewMigrator(db, sql.SQLite, false, ioutil.Discard).Up()).To(Succeed())
+		version, err := sql.NewMigrator(db, sql.SQLite, false, ioutil.Discard).Version()
+		Expect(err).To(BeNil())
+		Expect(version).To(Equal(sql.Migrations[len(sql.Migrations)-1].Version))
+	})
+})
+
+var _ = Describe("Router.Reconnect()", func() {
+	var router *store.Router
+
+	BeforeEach(func() {
+		router = store.NewRouter()
+		Expect(router.Reload(store.RouterConfig{
+			Backends: map[string]string{"default": "sqlite:///:memory:"},
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		router.Stop()
+	})
+
+	It("should refuse to reconnect an in memory sqlite backend", func() {
+		_, err := router.Reconnect("default")
+		Expect(err).To(Not(BeNil()))
+		Expect(err.Error()).To(ContainSubstring("in memory"))
+	})
+
+	It("should skip in memory backends when reconnecting every backend", func() {
+		names, err := router.Reconnect("")
+		Expect(err).To(BeNil())
+		Expect(names).To(BeEmpty())
+	})
+})
@@ -0,0 +1,28 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	stdSql "database/sql"
+
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"golang.org/x/net/context"
+)
+
+// Get a team, returns ErrNotFound if the team doesn't exist
+func (self *SqlStore) GetTeam(ctx context.Context, id string) (*model.Team, error) {
+	var team model.Team
+	err := self.db.QueryRowContext(ctx, self.rebind(
+		"SELECT id, name, domain, created_at FROM team WHERE id = ?"), id).
+		Scan(&team.Id, &team.Name, &team.Domain, &team.CreatedAt)
+
+	if err == stdSql.ErrNoRows {
+		return nil, store.NotFound("Team '%s' not found", id)
+	} else if err != nil {
+		return nil, Error("GetTeam()", err.Error())
+	}
+	return &team, nil
+}
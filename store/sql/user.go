@@ -0,0 +1,115 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	stdSql "database/sql"
+
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/howler-chat/api-service/validate"
+	"golang.org/x/net/context"
+)
+
+const userColumns = "id, team_id, handle, display_name, avatar_url, timezone, status, deactivated"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner, user *model.User) error {
+	return row.Scan(&user.Id, &user.TeamId, &user.Handle, &user.DisplayName, &user.AvatarUrl,
+		&user.Timezone, &user.Status, &user.Deactivated)
+}
+
+func (self *SqlStore) InsertUser(ctx context.Context, user *model.User) error {
+	if user.Id == "" {
+		user.Id = utils.NewId()
+	}
+
+	_, err := self.db.ExecContext(ctx, self.rebind("INSERT INTO howler_user ("+userColumns+", handle_key) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"), user.Id, user.TeamId, user.Handle, user.DisplayName,
+		user.AvatarUrl, user.Timezone, user.Status, user.Deactivated, user.HandleKey())
+
+	if isUniqueViolation(err) {
+		return store.Conflict("Handle '%s' is already taken", user.Handle)
+	} else if err != nil {
+		return Error("InsertUser()", err.Error())
+	}
+	return nil
+}
+
+// Get a user, returns ErrNotFound if the user doesn't exist
+func (self *SqlStore) GetUser(ctx context.Context, id string) (*model.User, error) {
+	var user model.User
+	err := scanUser(self.db.QueryRowContext(ctx, self.rebind(
+		"SELECT "+userColumns+" FROM howler_user WHERE id = ?"), id), &user)
+
+	if err == stdSql.ErrNoRows {
+		return nil, store.NotFound("User '%s' not found", id)
+	} else if err != nil {
+		return nil, Error("GetUser()", err.Error())
+	}
+	return &user, nil
+}
+
+func (self *SqlStore) ListUser(ctx context.Context, req *model.ListUserRequest) ([]model.User, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = validate.DefaultLimit
+	}
+
+	query := "SELECT " + userColumns + " FROM howler_user WHERE team_id = ?"
+	if !req.IncludeDeactivated {
+		query += " AND deactivated = ?"
+	}
+	query += " ORDER BY handle_key, id LIMIT ? OFFSET ?"
+
+	params := []interface{}{req.TeamId}
+	if !req.IncludeDeactivated {
+		params = append(params, false)
+	}
+	params = append(params, limit, req.Offset)
+
+	rows, err := self.db.QueryContext(ctx, self.rebind(query), params...)
+	if err != nil {
+		return nil, Error("ListUser()", err.Error())
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		var user model.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, Error("ListUser().Scan()", err.Error())
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Error("ListUser().Next()", err.Error())
+	}
+	return users, nil
+}
+
+func (self *SqlStore) UpdateUser(ctx context.Context, user *model.User) error {
+	result, err := self.db.ExecContext(ctx, self.rebind("UPDATE howler_user SET team_id = ?, handle = ?, "+
+		"handle_key = ?, display_name = ?, avatar_url = ?, timezone = ?, status = ?, deactivated = ? WHERE id = ?"),
+		user.TeamId, user.Handle, user.HandleKey(), user.DisplayName, user.AvatarUrl, user.Timezone,
+		user.Status, user.Deactivated, user.Id)
+
+	if isUniqueViolation(err) {
+		return store.Conflict("Handle '%s' is already taken", user.Handle)
+	} else if err != nil {
+		return Error("UpdateUser()", err.Error())
+	}
+
+	if count, err := result.RowsAffected(); err != nil {
+		return Error("UpdateUser().RowsAffected()", err.Error())
+	} else if count == 0 {
+		return store.NotFound("User '%s' not found", user.Id)
+	}
+	return nil
+}
@@ -1,7 +1,6 @@
 package store
 
 import (
-	"github.com/howler-chat/api-service/errors"
 	"github.com/howler-chat/api-service/model"
 	"golang.org/x/net/context"
 )
@@ -9,13 +8,49 @@ import (
 type contextKey int
 
 const (
-	storeKey contextKey = 0
+	storeKey       contextKey = 0
+	consistencyKey contextKey = 1
 )
 
+// Store methods return errors caused by ErrNotFound, ErrConflict or ErrUnavailable. See Cause()
 type HowlerStore interface {
-	InsertMessage(ctx context.Context, msg *model.Message) errors.HttpError
-	GetMessage(ctx context.Context, req *model.GetMessageRequest) (*model.Message, errors.HttpError)
-	ListMessage(ctx context.Context, req *model.ListMessageRequest) ([]model.Message, errors.HttpError)
+	// Insert the message with a new id, created now
+	InsertMessage(ctx context.Context, msg *model.Message) error
+	// Insert the message with a new id, keeping the time it was created. Used by imports, the api must use
+	// InsertMessage() so clients can't backdate messages
+	ImportMessage(ctx context.Context, msg *model.Message) error
+	// Returns ErrNotFound if the message doesn't exist on the requested channel
+	GetMessage(ctx context.Context, req *model.GetMessageRequest) (*model.Message, error)
+	ListMessage(ctx context.Context, req *model.ListMessageRequest) ([]model.Message, error)
+	// Remove every message on the channel, returns the number of messages removed
+	PurgeChannel(ctx context.Context, channelId string) (int, error)
+	// Returns the ids of the channels the users have posted to, sorted by id. Howler has no channel model, so
+	// these are the channels of a team
+	ListChannelIds(ctx context.Context, userIds []string) ([]string, error)
+
+	// Find the conversation with the same id, or create it if it doesn't exist. Returns true if this call created
+	// the conversation, or ErrConflict if the conversation exists with different participants
+	OpenConversation(ctx context.Context, conversation *model.Conversation) (bool, error)
+	// Returns ErrNotFound if the conversation doesn't exist
+	GetConversation(ctx context.Context, id string) (*model.Conversation, error)
+	// List conversations the user participates in, most recently active first (by id if equally recent)
+	ListConversation(ctx context.Context, req *model.ListConversationRequest) ([]model.Conversation, error)
+
+	// Insert a new user, returns ErrConflict if the handle is already taken within the team
+	InsertUser(ctx context.Context, user *model.User) error
+	// Returns ErrNotFound if the user doesn't exist
+	GetUser(ctx context.Context, id string) (*model.User, error)
+	ListUser(ctx context.Context, req *model.ListUserRequest) ([]model.User, error)
+	// Replace the user, returns ErrConflict if the handle is already taken within the team or ErrNotFound
+	// if the user doesn't exist
+	UpdateUser(ctx context.Context, user *model.User) error
+	// Returns ErrNotFound if the team doesn't exist
+	GetTeam(ctx context.Context, id string) (*model.Team, error)
+
+	// Record an audit event, events can not be changed or removed once inserted
+	InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error
+	// List the audit events matching the request, most recent first
+	ListAuditEvent(ctx context.Context, req *model.ListAuditRequest) ([]model.AuditEvent, error)
 }
 
 func AddStore(ctx context.Context, store HowlerStore) context.Context {
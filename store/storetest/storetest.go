@@ -0,0 +1,674 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package storetest is a ginkgo conformance suite every HowlerStore implementation should pass. Each store package runs
+the suite from its own tests with a factory that returns a started backend.
+
+	var _ = storetest.DescribeStore("SQLite", func() store.Backend {
+		backend, err := sql.NewBackend("test", dsn)
+		Expect(err).To(BeNil())
+		backend.Start()
+		return backend
+	})
+
+The suite creates a new backend for every spec and stops it when the spec completes. Ids are randomly generated for
+every spec, so backends that persist data between specs (IE: a shared rethinkdb) do not interfere with each other.
+*/
+package storetest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/howler-chat/api-service/model"
+	"github.com/howler-chat/api-service/store"
+	"github.com/howler-chat/api-service/utils"
+	"github.com/howler-chat/api-service/validate"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+)
+
+// Stores differ in how precisely they persist timestamps, rethinkdb only keeps milliseconds
+const timePrecision = time.Millisecond
+
+// Text in a variety of scripts, including multi byte, combining and right to left characters
+var unicodeText = []string{
+	"Hello, 世界",
+	"Привет мир",
+	"مرحبا بالعالم",
+	"🎉🚀 ship it 👍🏽",
+	"é is not é",
+	"tab\tnewline\nnull-ish ␀",
+}
+
+// Describe the conformance suite for the store returned by `factory`
+func DescribeStore(name string, factory func() store.Backend) bool {
+	return Describe(name+" store conformance", func() {
+		var backend store.Backend
+		var ctx context.Context
+		var channelId, teamId string
+
+		BeforeEach(func() {
+			backend = factory()
+			ctx = context.Background()
+			channelId = "C" + utils.NewId()[1:]
+			teamId = "T" + utils.NewId()[1:]
+		})
+
+		AfterEach(func() {
+			if backend != nil {
+				backend.Stop()
+			}
+		})
+
+		// Messages with a time are imported, otherwise they are created now
+		insertMessage := func(text string, createdAt time.Time) model.Message {
+			msg := model.Message{ChannelId: channelId, UserId: "U" + utils.NewId()[1:], Text: text, CreatedAt: createdAt}
+			if createdAt.IsZero() {
+				Expect(backend.InsertMessage(ctx, &msg)).To(BeNil())
+			} else {
+				Expect(backend.ImportMessage(ctx, &msg)).To(BeNil())
+			}
+			Expect(msg.Id).NotTo(BeEmpty())
+			return msg
+		}
+
+		insertUser := func(handle string, deactivated bool) model.User {
+			user := model.User{TeamId: teamId, Handle: handle, DisplayName: handle, Deactivated: deactivated}
+			Expect(backend.InsertUser(ctx, &user)).To(BeNil())
+			Expect(user.Id).NotTo(BeEmpty())
+			return user
+		}
+
+		openConversation := func(userIds ...string) model.Conversation {
+			participants := model.Participants(userIds)
+			conversation := model.Conversation{Id: model.ConversationId(participants), Participants: participants}
+			_, err := backend.OpenConversation(ctx, &conversation)
+			Expect(err).To(BeNil())
+			return conversation
+		}
+
+		Describe("Messages", func() {
+			It("should return the message inserted", func() {
+				createdAt := time.Now().UTC()
+				msg := insertMessage("hello", createdAt)
+
+				result, err := backend.GetMessage(ctx, &model.GetMessageRequest{MessageId: msg.Id, ChannelId: channelId})
+				Expect(err).To(BeNil())
+				Expect(result.Id).To(Equal(msg.Id))
+				Expect(result.ChannelId).To(Equal(channelId))
+				Expect(result.UserId).To(Equal(msg.UserId))
+				Expect(result.Text).To(Equal("hello"))
+				Expect(result.CreatedAt).To(BeTemporally("~", createdAt, timePrecision))
+			})
+
+			It("should assign CreatedAt if not provided", func() {
+				before := time.Now()
+				msg := insertMessage("hello", time.Time{})
+				Expect(msg.CreatedAt).To(BeTemporally(">=", before))
+			})
+
+			It("should assign the id and CreatedAt of an inserted message", func() {
+				before := time.Now()
+				msg := model.Message{Id: "M000000001", ChannelId: channelId, UserId: "U000000001", Text: "hello",
+					CreatedAt: before.Add(-time.Hour)}
+				Expect(backend.InsertMessage(ctx, &msg)).To(BeNil())
+				Expect(msg.Id).NotTo(Equal("M000000001"))
+				Expect(msg.CreatedAt).To(BeTemporally(">=", before))
+			})
+
+			It("should assign unique ids", func() {
+				first := insertMessage("one", time.Time{})
+				second := insertMessage("two", time.Time{})
+				Expect(first.Id).NotTo(Equal(second.Id))
+			})
+
+			It("should list messages in the order they were created", func() {
+				now := time.Now().UTC()
+				third := insertMessage("third", now.Add(2*time.Second))
+				first := insertMessage("first", now)
+				second := insertMessage("second", now.Add(time.Second))
+
+				messages, err := backend.ListMessage(ctx, &model.ListMessageRequest{ChannelId: channelId})
+				Expect(err).To(BeNil())
+				Expect(messageIds(messages)).To(Equal([]string{first.Id, second.Id, third.Id}))
+			})
+
+			It("should only list messages on the requested channel", func() {
+				msg := insertMessage("mine", time.Time{})
+				channelId = "C" + utils.NewId()[1:]
+				insertMessage("other", time.Time{})
+
+				messages, err := backend.ListMessage(ctx, &model.ListMessageRequest{ChannelId: msg.ChannelId})
+				Expect(err).To(BeNil())
+				Expect(messageIds(messages)).To(Equal([]string{msg.Id}))
+			})
+
+			It("should list nothing for an empty channel", func() {
+				messages, err := backend.ListMessage(ctx, &model.ListMessageRequest{ChannelId: channelId})
+				Expect(err).To(BeNil())
+				Expect(messages).To(BeEmpty())
+			})
+
+			It("should preserve unicode text", func() {
+				for _, text := range unicodeText {
+					msg := insertMessage(text, time.Time{})
+					result, err := backend.GetMessage(ctx,
+						&model.GetMessageRequest{MessageId: msg.Id, ChannelId: channelId})
+					Expect(err).To(BeNil())
+					Expect(result.Text).To(Equal(text))
+				}
+			})
+
+			It("should return ErrNotFound if the message doesn't exist", func() {
+				result, err := backend.GetMessage(ctx,
+					&model.GetMessageRequest{MessageId: utils.NewId(), ChannelId: channelId})
+				Expect(result).To(BeNil())
+				Expect(store.Cause(err)).To(Equal(store.ErrNotFound))
+			})
+
+			It("should return ErrNotFound if the message is on a different channel", func() {
+				msg := insertMessage("hello", time.Time{})
+				result, err := backend.GetMessage(ctx,
+					&model.GetMessageRequest{MessageId: msg.Id, ChannelId: "C" + utils.NewId()[1:]})
+				Expect(result).To(BeNil())
+				Expect(store.Cause(err)).To(Equal(store.ErrNotFound))
+			})
+
+			It("should accept concurrent inserts", func() {
+				const count = 25
+				var wg sync.WaitGroup
+				ids := make(chan string, count)
+
+				for i := 0; i < count; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer GinkgoRecover()
+						defer wg.Done()
+						msg := model.Message{ChannelId: channelId, UserId: "U1", Text: fmt.Sprintf("message %d", i)}
+						Expect(backend.InsertMessage(ctx, &msg)).To(BeNil())
+						ids <- msg.Id
+					}(i)
+				}
+				wg.Wait()
+				close(ids)
+
+				unique := map[string]bool{}
+				for id := range ids {
+					unique[id] = true
+				}
+				Expect(unique).To(HaveLen(count))
+
+				messages, err := backend.ListMessage(ctx, &model.ListMessageRequest{ChannelId: channelId})
+				Expect(err).To(BeNil())
+				Expect(messages).To(HaveLen(count))
+			})
+
+			It("should only purge messages on the requested channel", func() {
+				purged := insertMessage("one", time.Time{})
+				insertMessage("two", time.Time{})
+				channelId = "C" + utils.NewId()[1:]
+				kept := insertMessage("other", time.Time{})
+
+				count, err := backend.PurgeChannel(ctx, purged.ChannelId)
+				Expect(err).To(BeNil())
+				Expect(count).To(Equal(2))
+
+				messages, err := backend.ListMessage(ctx, &model.ListMessageRequest{ChannelId: purged.ChannelId})
+				Expect(err).To(BeNil())
+				Expect(messages).To(BeEmpty())
+				_, err = backend.GetMessage(ctx,
+					&model.GetMessageRequest{MessageId: purged.Id, ChannelId: purged.ChannelId})
+				Expect(store.Cause(err)).To(Equal(store.ErrNotFound))
+
+				messages, err = backend.ListMessage(ctx, &model.ListMessageRequest{ChannelId: channelId})
+				Expect(err).To(BeNil())
+				Expect(messageIds(messages)).To(Equal([]string{kept.Id}))
+
+				count, err = backend.PurgeChannel(ctx, purged.ChannelId)
+				Expect(err).To(BeNil())
+				Expect(count).To(Equal(0))
+			})
+
+			It("should list the channels the users posted to sorted by id", func() {
+				channelIds := []string{"C" + utils.NewId()[1:], "C" + utils.NewId()[1:], "C" + utils.NewId()[1:]}
+				var userIds []string
+				for _, id := range channelIds {
+					channelId = id
+					userIds = append(userIds, insertMessage("hello", time.Time{}).UserId)
+				}
+				// A second message by the same user on the same channel is listed once
+				msg := model.Message{ChannelId: channelIds[0], UserId: userIds[0], Text: "again"}
+				Expect(backend.InsertMessage(ctx, &msg)).To(BeNil())
+
+				listed, err := backend.ListChannelIds(ctx, userIds[:2])
+				Expect(err).To(BeNil())
+				expected := []string{channelIds[0], channelIds[1]}
+				sort.Strings(expected)
+				Expect(listed).To(Equal(expected))
+
+				listed, err = backend.ListChannelIds(ctx, []string{"U" + utils.NewId()[1:]})
+				Expect(err).To(BeNil())
+				Expect(listed).To(BeEmpty())
+			})
+		})
+
+		Describe("Conversations", func() {
+			var userId string
+
+			BeforeEach(func() {
+				userId = "U" + utils.NewId()[1:]
+			})
+
+			It("should return the same conversation when opened twice", func() {
+				other := "U" + utils.NewId()[1:]
+				participants := model.Participants([]string{userId, other})
+				first := model.Conversation{Id: model.ConversationId(participants), Participants: participants}
+				created, err := backend.OpenConversation(ctx, &first)
+				Expect(err).To(BeNil())
+				Expect(created).To(BeTrue())
+
+				second := model.Conversation{Id: first.Id, Participants: participants}
+				created, err = backend.OpenConversation(ctx, &second)
+				Expect(err).To(BeNil())
+				Expect(created).To(BeFalse())
+
+				Expect(second.Id).To(Equal(first.Id))
+				Expect(second.Participants).To(Equal(first.Participants))
+				Expect(second.CreatedAt).To(BeTemporally("~", first.CreatedAt, timePrecision))
+			})
+
+			It("should reject a conversation id with different participants", func() {
+				conversation := openConversation(userId, "U"+utils.NewId()[1:])
+				collision := model.Conversation{
+					Id:           conversation.Id,
+					Participants: model.Participants([]string{userId, "U" + utils.NewId()[1:]}),
+				}
+				_, err := backend.OpenConversation(ctx, &collision)
+				Expect(err).NotTo(BeNil())
+				Expect(store.Cause(err)).To(Equal(store.ErrConflict))
+			})
+
+			It("should return ErrNotFound if the conversation doesn't exist", func() {
+				conversation, err := backend.GetConversation(ctx, "D"+utils.NewId()[1:])
+				Expect(conversation).To(BeNil())
+				Expect(store.Cause(err)).To(Equal(store.ErrNotFound))
+			})
+
+			It("should return the participants sorted", func() {
+				opened := openConversation("U"+utils.NewId()[1:], userId, "U"+utils.NewId()[1:])
+				conversation, err := backend.GetConversation(ctx, opened.Id)
+				Expect(err).To(BeNil())
+				Expect(conversation.Participants).To(Equal(model.Participants(opened.Participants)))
+				Expect(conversation.HasParticipant(userId)).To(BeTrue())
+			})
+
+			It("should accept concurrent opens of the same conversation", func() {
+				other := "U" + utils.NewId()[1:]
+				participants := model.Participants([]string{userId, other})
+				var created int32
+				var wg sync.WaitGroup
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func() {
+						defer GinkgoRecover()
+						defer wg.Done()
+						conversation := model.Conversation{Id: model.ConversationId(participants),
+							Participants: participants}
+						inserted, err := backend.OpenConversation(ctx, &conversation)
+						Expect(err).To(BeNil())
+						if inserted {
+							atomic.AddInt32(&created, 1)
+						}
+					}()
+				}
+				wg.Wait()
+				// Exactly one of the opens created the conversation
+				Expect(created).To(Equal(int32(1)))
+
+				conversations, err := backend.ListConversation(ctx, &model.ListConversationRequest{UserId: userId})
+				Expect(err).To(BeNil())
+				Expect(conversations).To(HaveLen(1))
+			})
+
+			Context("When listing conversations", func() {
+				var oldest, middle, newest model.Conversation
+
+				BeforeEach(func() {
+					oldest = openConversation(userId, "U"+utils.NewId()[1:])
+					middle = openConversation(userId, "U"+utils.NewId()[1:])
+					newest = openConversation(userId, "U"+utils.NewId()[1:])
+
+					// Posting a message to the conversation is what makes it active
+					now := time.Now().UTC()
+					for i, conversation := range []model.Conversation{oldest, middle, newest} {
+						channelId = conversation.Id
+						insertMessage("hello", now.Add(time.Duration(i+1)*time.Hour))
+					}
+				})
+
+				It("should list the most recently active first", func() {
+					conversations, err := backend.ListConversation(ctx,
+						&model.ListConversationRequest{UserId: userId})
+					Expect(err).To(BeNil())
+					Expect(conversationIds(conversations)).To(Equal([]string{newest.Id, middle.Id, oldest.Id}))
+				})
+
+				It("should only list conversations the user participates in", func() {
+					conversations, err := backend.ListConversation(ctx,
+						&model.ListConversationRequest{UserId: "U" + utils.NewId()[1:]})
+					Expect(err).To(BeNil())
+					Expect(conversations).To(BeEmpty())
+				})
+
+				It("should honour the limit", func() {
+					for limit, expected := range map[int][]string{
+						1: {newest.Id},
+						2: {newest.Id, middle.Id},
+						3: {newest.Id, middle.Id, oldest.Id},
+						4: {newest.Id, middle.Id, oldest.Id},
+					} {
+						conversations, err := backend.ListConversation(ctx,
+							&model.ListConversationRequest{UserId: userId, Limit: limit})
+						Expect(err).To(BeNil())
+						Expect(conversationIds(conversations)).To(Equal(expected), "Limit %d", limit)
+					}
+				})
+
+				It("should skip the offset", func() {
+					for offset, expected := range map[int][]string{
+						1: {middle.Id, oldest.Id},
+						2: {oldest.Id},
+						3: nil,
+					} {
+						conversations, err := backend.ListConversation(ctx,
+							&model.ListConversationRequest{UserId: userId, Offset: offset})
+						Expect(err).To(BeNil())
+						Expect(conversationIds(conversations)).To(Equal(expected), "Offset %d", offset)
+					}
+				})
+			})
+		})
+
+		Describe("Users", func() {
+			It("should return the user inserted", func() {
+				user := insertUser("alice", false)
+
+				result, err := backend.GetUser(ctx, user.Id)
+				Expect(err).To(BeNil())
+				Expect(result.Id).To(Equal(user.Id))
+				Expect(result.TeamId).To(Equal(teamId))
+				Expect(result.Handle).To(Equal("alice"))
+			})
+
+			It("should assign ids the api accepts", func() {
+				user := insertUser("alice", false)
+				Expect(validate.IsValidId(user.Id)).To(BeNil())
+			})
+
+			It("should return ErrNotFound if the user doesn't exist", func() {
+				user, err := backend.GetUser(ctx, "U"+utils.NewId()[1:])
+				Expect(user).To(BeNil())
+				Expect(store.Cause(err)).To(Equal(store.ErrNotFound))
+			})
+
+			It("should reject a handle already taken within the team regardless of case", func() {
+				insertUser("alice", false)
+				user := model.User{TeamId: teamId, Handle: "Alice"}
+				err := backend.InsertUser(ctx, &user)
+				Expect(err).NotTo(BeNil())
+				Expect(store.Cause(err)).To(Equal(store.ErrConflict))
+			})
+
+			It("should allow the same handle on different teams", func() {
+				insertUser("alice", false)
+				teamId = "T" + utils.NewId()[1:]
+				insertUser("alice", false)
+			})
+
+			It("should preserve unicode display names", func() {
+				user := insertUser("unicode", false)
+				for _, text := range unicodeText {
+					user.DisplayName = text
+					Expect(backend.UpdateUser(ctx, &user)).To(BeNil())
+					result, err := backend.GetUser(ctx, user.Id)
+					Expect(err).To(BeNil())
+					Expect(result.DisplayName).To(Equal(text))
+				}
+			})
+
+			It("should release the old handle when the handle is updated", func() {
+				user := insertUser("alice", false)
+				user.Handle = "alicia"
+				Expect(backend.UpdateUser(ctx, &user)).To(BeNil())
+
+				result, err := backend.GetUser(ctx, user.Id)
+				Expect(err).To(BeNil())
+				Expect(result.Handle).To(Equal("alicia"))
+				insertUser("alice", false)
+			})
+
+			It("should reject an update to a handle already taken", func() {
+				insertUser("alice", false)
+				user := insertUser("bob", false)
+				user.Handle = "ALICE"
+				err := backend.UpdateUser(ctx, &user)
+				Expect(err).NotTo(BeNil())
+				Expect(store.Cause(err)).To(Equal(store.ErrConflict))
+			})
+
+			It("should return ErrNotFound when updating a user that doesn't exist", func() {
+				user := model.User{Id: "U" + utils.NewId()[1:], TeamId: teamId, Handle: "ghost"}
+				err := backend.UpdateUser(ctx, &user)
+				Expect(err).NotTo(BeNil())
+				Expect(store.Cause(err)).To(Equal(store.ErrNotFound))
+			})
+
+			Context("When listing users", func() {
+				var alice, bob, carl, dave model.User
+
+				BeforeEach(func() {
+					carl = insertUser("carl", false)
+					alice = insertUser("alice", false)
+					dave = insertUser("dave", true)
+					bob = insertUser("bob", false)
+				})
+
+				It("should list active users ordered by handle", func() {
+					users, err := backend.ListUser(ctx, &model.ListUserRequest{TeamId: teamId})
+					Expect(err).To(BeNil())
+					Expect(userIds(users)).To(Equal([]string{alice.Id, bob.Id, carl.Id}))
+				})
+
+				It("should include deactivated users when requested", func() {
+					users, err := backend.ListUser(ctx,
+						&model.ListUserRequest{TeamId: teamId, IncludeDeactivated: true})
+					Expect(err).To(BeNil())
+					Expect(userIds(users)).To(Equal([]string{alice.Id, bob.Id, carl.Id, dave.Id}))
+				})
+
+				It("should only list users on the requested team", func() {
+					users, err := backend.ListUser(ctx, &model.ListUserRequest{TeamId: "T" + utils.NewId()[1:]})
+					Expect(err).To(BeNil())
+					Expect(users).To(BeEmpty())
+				})
+
+				It("should honour the limit", func() {
+					for limit, expected := range map[int][]string{
+						1: {alice.Id},
+						2: {alice.Id, bob.Id},
+						3: {alice.Id, bob.Id, carl.Id},
+						4: {alice.Id, bob.Id, carl.Id},
+					} {
+						users, err := backend.ListUser(ctx, &model.ListUserRequest{TeamId: teamId, Limit: limit})
+						Expect(err).To(BeNil())
+						Expect(userIds(users)).To(Equal(expected), "Limit %d", limit)
+					}
+				})
+
+				It("should page through the users with the offset", func() {
+					var paged []string
+					for offset := 0; ; offset += 2 {
+						users, err := backend.ListUser(ctx, &model.ListUserRequest{TeamId: teamId, Limit: 2,
+							Offset: offset, IncludeDeactivated: true})
+						Expect(err).To(BeNil())
+						paged = append(paged, userIds(users)...)
+						if len(users) < 2 {
+							break
+						}
+					}
+					Expect(paged).To(Equal([]string{alice.Id, bob.Id, carl.Id, dave.Id}))
+				})
+			})
+
+			Context("When listing users with mixed case handles", func() {
+				var alice, bob, carol model.User
+
+				BeforeEach(func() {
+					bob = insertUser("bob", false)
+					alice = insertUser("Alice", false)
+					carol = insertUser("carol", false)
+				})
+
+				It("should order the handles regardless of case", func() {
+					users, err := backend.ListUser(ctx, &model.ListUserRequest{TeamId: teamId})
+					Expect(err).To(BeNil())
+					Expect(userIds(users)).To(Equal([]string{alice.Id, bob.Id, carol.Id}))
+				})
+
+				It("should page through the handles regardless of case", func() {
+					first, err := backend.ListUser(ctx, &model.ListUserRequest{TeamId: teamId, Limit: 2})
+					Expect(err).To(BeNil())
+					Expect(userIds(first)).To(Equal([]string{alice.Id, bob.Id}))
+
+					second, err := backend.ListUser(ctx, &model.ListUserRequest{TeamId: teamId, Limit: 2, Offset: 2})
+					Expect(err).To(BeNil())
+					Expect(userIds(second)).To(Equal([]string{carol.Id}))
+				})
+			})
+		})
+
+		Describe("Teams", func() {
+			It("should return ErrNotFound if the team doesn't exist", func() {
+				team, err := backend.GetTeam(ctx, teamId)
+				Expect(team).To(BeNil())
+				Expect(store.Cause(err)).To(Equal(store.ErrNotFound))
+			})
+		})
+
+		Describe("Audit Events", func() {
+			var base time.Time
+
+			insertEvent := func(action, actorId string, createdAt time.Time) model.AuditEvent {
+				event := model.AuditEvent{
+					TeamId:     teamId,
+					Action:     action,
+					ActorId:    actorId,
+					TargetType: "user",
+					TargetId:   actorId,
+					Before:     []byte(`{"handle":"before"}`),
+					After:      []byte(`{"handle":"after"}`),
+					RequestId:  "R" + utils.NewId()[1:],
+					CreatedAt:  createdAt,
+				}
+				Expect(backend.InsertAuditEvent(ctx, &event)).To(BeNil())
+				Expect(event.Id).NotTo(BeEmpty())
+				return event
+			}
+
+			BeforeEach(func() {
+				base = time.Now().UTC().Truncate(time.Second)
+			})
+
+			It("should list events most recent first", func() {
+				first := insertEvent("user.update", "U1", base)
+				second := insertEvent("user.update", "U1", base.Add(time.Second))
+
+				events, err := backend.ListAuditEvent(ctx, &model.ListAuditRequest{TeamId: teamId})
+				Expect(err).To(BeNil())
+				Expect(auditIds(events)).To(Equal([]string{second.Id, first.Id}))
+				Expect(events[1].Action).To(Equal("user.update"))
+				Expect(events[1].RequestId).To(Equal(first.RequestId))
+				Expect(string(events[1].Before)).To(MatchJSON(first.Before))
+				Expect(string(events[1].After)).To(MatchJSON(first.After))
+				Expect(events[1].CreatedAt).To(BeTemporally("~", base, timePrecision))
+			})
+
+			It("should only list events of the requested team", func() {
+				insertEvent("user.update", "U1", base)
+				events, err := backend.ListAuditEvent(ctx, &model.ListAuditRequest{TeamId: "T" + utils.NewId()[1:]})
+				Expect(err).To(BeNil())
+				Expect(events).To(BeEmpty())
+			})
+
+			It("should filter by action, actor and time", func() {
+				update := insertEvent("user.update", "U1", base)
+				insertEvent("conversation.open", "U1", base.Add(time.Second))
+				other := insertEvent("user.update", "U2", base.Add(2*time.Second))
+
+				events, err := backend.ListAuditEvent(ctx,
+					&model.ListAuditRequest{TeamId: teamId, Action: "user.update"})
+				Expect(err).To(BeNil())
+				Expect(auditIds(events)).To(Equal([]string{other.Id, update.Id}))
+
+				events, err = backend.ListAuditEvent(ctx,
+					&model.ListAuditRequest{TeamId: teamId, ActorId: "U2"})
+				Expect(err).To(BeNil())
+				Expect(auditIds(events)).To(Equal([]string{other.Id}))
+
+				events, err = backend.ListAuditEvent(ctx, &model.ListAuditRequest{TeamId: teamId,
+					Since: base.Add(time.Second), Until: base.Add(2 * time.Second)})
+				Expect(err).To(BeNil())
+				Expect(len(events)).To(Equal(1))
+				Expect(events[0].Action).To(Equal("conversation.open"))
+			})
+
+			It("should honour the limit", func() {
+				for i := 0; i < 3; i++ {
+					insertEvent("user.update", "U1", base.Add(time.Duration(i)*time.Second))
+				}
+				events, err := backend.ListAuditEvent(ctx, &model.ListAuditRequest{TeamId: teamId, Limit: 2})
+				Expect(err).To(BeNil())
+				Expect(len(events)).To(Equal(2))
+			})
+		})
+	})
+}
+
+func messageIds(messages []model.Message) []string {
+	var ids []string
+	for _, msg := range messages {
+		ids = append(ids, msg.Id)
+	}
+	return ids
+}
+
+func conversationIds(conversations []model.Conversation) []string {
+	var ids []string
+	for _, conversation := range conversations {
+		ids = append(ids, conversation.Id)
+	}
+	return ids
+}
+
+func userIds(users []model.User) []string {
+	var ids []string
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	return ids
+}
+
+func auditIds(events []model.AuditEvent) []string {
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+	return ids
+}
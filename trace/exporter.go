@@ -0,0 +1,216 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var kindNames = map[SpanKind]string{
+	KindInternal: "internal",
+	KindServer:   "server",
+	KindClient:   "client",
+}
+
+// Writes each span as a line of json, useful for local testing
+type WriterExporter struct {
+	writer io.Writer
+	closer io.Closer
+}
+
+type writerSpan struct {
+	TraceId    string            `json:"traceId"`
+	SpanId     string            `json:"spanId"`
+	ParentId   string            `json:"parentSpanId,omitempty"`
+	Name       string            `json:"name"`
+	Kind       string            `json:"kind"`
+	Start      time.Time         `json:"start"`
+	Duration   string            `json:"duration"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+func NewWriterExporter(writer io.Writer) *WriterExporter {
+	return &WriterExporter{writer: writer}
+}
+
+// Appends spans to the file at `path`, the file is created if it doesn't exist
+func NewFileExporter(path string) (*WriterExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while opening trace file '%s'", path)
+	}
+	return &WriterExporter{writer: file, closer: file}, nil
+}
+
+func (self *WriterExporter) Export(spans []*Span) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, span := range spans {
+		entry := writerSpan{
+			TraceId:    span.Context.TraceId.String(),
+			SpanId:     span.Context.SpanId.String(),
+			Name:       span.Name,
+			Kind:       kindNames[span.Kind],
+			Start:      span.Start,
+			Duration:   span.End.Sub(span.Start).String(),
+			Attributes: span.Attributes,
+			Error:      span.Error,
+		}
+		if span.ParentId.IsValid() {
+			entry.ParentId = span.ParentId.String()
+		}
+		if err := encoder.Encode(&entry); err != nil {
+			return err
+		}
+	}
+	_, err := self.writer.Write(buf.Bytes())
+	return err
+}
+
+func (self *WriterExporter) Close() error {
+	if self.closer != nil {
+		return self.closer.Close()
+	}
+	return nil
+}
+
+// Sends spans to an OpenTelemetry collector using OTLP/HTTP with json encoding
+type OTLPExporter struct {
+	// The full url of the collector, IE: 'http://localhost:4318/v1/traces'
+	Endpoint string
+	// Reported as the 'service.name' resource attribute
+	Service string
+	client  *http.Client
+}
+
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	return &OTLPExporter{
+		Endpoint: endpoint,
+		Service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId      string          `json:"traceId"`
+	SpanId       string          `json:"spanId"`
+	ParentSpanId string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         SpanKind        `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// Attributes in a stable order, such that exported spans are easy to compare
+func toOTLPAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []otlpAttribute
+	for _, key := range keys {
+		result = append(result, otlpAttribute{Key: key, Value: otlpValue{StringValue: attributes[key]}})
+	}
+	return result
+}
+
+func (self *OTLPExporter) Export(spans []*Span) error {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "github.com/howler-chat/api-service/trace"
+
+	for _, span := range spans {
+		entry := otlpSpan{
+			TraceId:    span.Context.TraceId.String(),
+			SpanId:     span.Context.SpanId.String(),
+			Name:       span.Name,
+			Kind:       span.Kind,
+			Start:      strconv.FormatInt(span.Start.UnixNano(), 10),
+			End:        strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes: toOTLPAttributes(span.Attributes),
+			// STATUS_CODE_UNSET
+			Status: otlpStatus{Code: 0},
+		}
+		if span.ParentId.IsValid() {
+			entry.ParentSpanId = span.ParentId.String()
+		}
+		if span.Error != "" {
+			// STATUS_CODE_ERROR
+			entry.Status = otlpStatus{Code: 2, Message: span.Error}
+		}
+		scope.Spans = append(scope.Spans, entry)
+	}
+
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = toOTLPAttributes(map[string]string{"service.name": self.Service})
+
+	payload, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{resource}})
+	if err != nil {
+		return err
+	}
+
+	resp, err := self.client.Post(self.Endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrapf(err, "while posting spans to '%s'", self.Endpoint)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector '%s' returned %d - %s", self.Endpoint, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (self *OTLPExporter) Close() error {
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Values match the OTLP SpanKind enum
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+type contextKey int
+
+const (
+	spanKey contextKey = 0
+)
+
+// A Span is a single timed operation within a trace. All methods are safe to call on a nil span, such that code
+// can be traced without checking if tracing is enabled.
+type Span struct {
+	Name     string
+	Kind     SpanKind
+	Context  SpanContext
+	ParentId SpanId
+	Start    time.Time
+	End      time.Time
+	// Should only be read after Finish() has been called
+	Attributes map[string]string
+	// The message of the error that failed the operation, "" if the operation succeeded
+	Error string
+
+	mutex  sync.Mutex
+	tracer *Tracer
+}
+
+func (self *Span) SetName(name string) {
+	if self == nil {
+		return
+	}
+	self.mutex.Lock()
+	self.Name = name
+	self.mutex.Unlock()
+}
+
+func (self *Span) SetAttribute(key, value string) {
+	if self == nil {
+		return
+	}
+	self.mutex.Lock()
+	self.Attributes[key] = value
+	self.mutex.Unlock()
+}
+
+// Marks the span as failed, does nothing if err is nil
+func (self *Span) SetError(err error) {
+	if self == nil || err == nil {
+		return
+	}
+	self.mutex.Lock()
+	self.Error = err.Error()
+	self.mutex.Unlock()
+}
+
+// Ends the span and queues it for export, calling Finish() more than once has no effect
+func (self *Span) Finish() {
+	if self == nil {
+		return
+	}
+	self.mutex.Lock()
+	if !self.End.IsZero() {
+		self.mutex.Unlock()
+		return
+	}
+	self.End = time.Now()
+	self.mutex.Unlock()
+
+	if self.Context.Sampled {
+		self.tracer.queue(self)
+	}
+}
+
+func AddSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey, span)
+}
+
+// Returns the current span, or nil if the context is not traced
+func GetSpan(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// Starts a child of the current span. If the context is not traced the returned span is nil
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return startChild(ctx, name, KindInternal)
+}
+
+// Starts a child of the current span for a call made to another service
+func StartClientSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return startChild(ctx, name, KindClient)
+}
+
+func startChild(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := GetSpan(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := parent.tracer.newSpan(name, kind, parent.Context)
+	return AddSpan(ctx, span), span
+}
+
+// Adds the 'traceparent' header of the current span, such that the next service continues our trace
+func Inject(ctx context.Context, header http.Header) {
+	if span := GetSpan(ctx); span != nil {
+		header.Set(TraceParentHeader, span.Context.TraceParent())
+	}
+}
+
+// Returns the span context of the caller, the returned context is invalid if the caller is not traced
+func Extract(header http.Header) SpanContext {
+	value := header.Get(TraceParentHeader)
+	if value == "" {
+		return SpanContext{}
+	}
+	// The spec says to start a new trace if the header is invalid
+	parent, err := ParseTraceParent(value)
+	if err != nil {
+		return SpanContext{}
+	}
+	return parent
+}
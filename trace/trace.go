@@ -0,0 +1,111 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package trace records spans compatible with OpenTelemetry and propagates the trace between services using the W3C
+'traceparent' header (https://www.w3.org/TR/trace-context/). Spans are exported over OTLP/HTTP or written as json
+to a file or stdout for local testing.
+*/
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const TraceParentHeader = "traceparent"
+
+type TraceId [16]byte
+
+func (self TraceId) String() string {
+	return hex.EncodeToString(self[:])
+}
+
+func (self TraceId) IsValid() bool {
+	return self != TraceId{}
+}
+
+type SpanId [8]byte
+
+func (self SpanId) String() string {
+	return hex.EncodeToString(self[:])
+}
+
+func (self SpanId) IsValid() bool {
+	return self != SpanId{}
+}
+
+// Identifies a span and the trace it belongs to, this is what we propagate between services
+type SpanContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+	// If false the trace is propagated but not exported
+	Sampled bool
+}
+
+func (self SpanContext) IsValid() bool {
+	return self.TraceId.IsValid() && self.SpanId.IsValid()
+}
+
+// Returns the value of the 'traceparent' header for this span context
+func (self SpanContext) TraceParent() string {
+	flags := "00"
+	if self.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", self.TraceId, self.SpanId, flags)
+}
+
+// Parses the value of a 'traceparent' header in the form 'version-traceid-spanid-flags'
+func ParseTraceParent(header string) (SpanContext, error) {
+	var result SpanContext
+
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 {
+		return result, fmt.Errorf("malformed traceparent '%s'", header)
+	}
+	// Version 'ff' is forbidden, future versions may append fields but must keep the first four
+	if len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return result, fmt.Errorf("unsupported traceparent version '%s'", parts[0])
+	}
+	if err := decodeHex(result.TraceId[:], parts[1]); err != nil {
+		return result, fmt.Errorf("invalid trace-id in traceparent '%s'", header)
+	}
+	if err := decodeHex(result.SpanId[:], parts[2]); err != nil {
+		return result, fmt.Errorf("invalid parent-id in traceparent '%s'", header)
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return result, fmt.Errorf("invalid trace-flags in traceparent '%s'", header)
+	}
+	result.Sampled = flags[0]&0x01 == 0x01
+
+	if !result.IsValid() {
+		return result, fmt.Errorf("all zero trace-id or parent-id in traceparent '%s'", header)
+	}
+	return result, nil
+}
+
+// Only lower case hex of exactly the right length is allowed by the spec
+func decodeHex(dest []byte, value string) error {
+	if len(value) != len(dest)*2 || strings.ToLower(value) != value {
+		return fmt.Errorf("expected %d lower case hex digits", len(dest)*2)
+	}
+	_, err := hex.Decode(dest, []byte(value))
+	return err
+}
+
+func newTraceId() TraceId {
+	var id TraceId
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanId() SpanId {
+	var id SpanId
+	rand.Read(id[:])
+	return id
+}
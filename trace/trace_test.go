@@ -0,0 +1,120 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/howler-chat/api-service/trace"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+)
+
+func TestTrace(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Trace Suite")
+}
+
+var _ = Describe("Trace", func() {
+	Describe("ParseTraceParent()", func() {
+		It("should round trip a valid traceparent", func() {
+			header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+			parent, err := trace.ParseTraceParent(header)
+			Expect(err).To(BeNil())
+			Expect(parent.TraceId.String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			Expect(parent.SpanId.String()).To(Equal("00f067aa0ba902b7"))
+			Expect(parent.Sampled).To(BeTrue())
+			Expect(parent.TraceParent()).To(Equal(header))
+		})
+
+		It("should reject invalid headers", func() {
+			for _, header := range []string{
+				"",
+				"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+				"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+				"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+				"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+				"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			} {
+				_, err := trace.ParseTraceParent(header)
+				Expect(err).To(Not(BeNil()), header)
+			}
+		})
+	})
+
+	Describe("Tracer", func() {
+		var buf *bytes.Buffer
+		var tracer *trace.Tracer
+
+		BeforeEach(func() {
+			buf = &bytes.Buffer{}
+			tracer = trace.NewTracer(trace.NewWriterExporter(buf), 1)
+		})
+
+		decode := func() []map[string]interface{} {
+			var spans []map[string]interface{}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var span map[string]interface{}
+				Expect(json.Unmarshal([]byte(line), &span)).To(Succeed())
+				spans = append(spans, span)
+			}
+			return spans
+		}
+
+		It("should continue the callers trace and export child spans", func() {
+			header := http.Header{}
+			header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+			ctx, server := tracer.StartServerSpan(context.Background(), "message.get", trace.Extract(header))
+			_, child := trace.StartSpan(ctx, "store.GetMessage")
+			child.SetAttribute("store.backend", "default")
+			child.Finish()
+			server.Finish()
+
+			outbound := http.Header{}
+			trace.Inject(ctx, outbound)
+			Expect(outbound.Get("traceparent")).To(HavePrefix("00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+
+			Expect(tracer.Stop()).To(Succeed())
+			spans := decode()
+			Expect(len(spans)).To(Equal(2))
+			Expect(spans[0]["name"]).To(Equal("store.GetMessage"))
+			Expect(spans[0]["traceId"]).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			Expect(spans[0]["parentSpanId"]).To(Equal(server.Context.SpanId.String()))
+			Expect(spans[0]["attributes"]).To(HaveKeyWithValue("store.backend", "default"))
+			Expect(spans[1]["name"]).To(Equal("message.get"))
+			Expect(spans[1]["kind"]).To(Equal("server"))
+			Expect(spans[1]["parentSpanId"]).To(Equal("00f067aa0ba902b7"))
+		})
+
+		It("should not export spans the caller did not sample", func() {
+			header := http.Header{}
+			header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+			_, server := tracer.StartServerSpan(context.Background(), "message.get", trace.Extract(header))
+			server.Finish()
+			Expect(tracer.Stop()).To(Succeed())
+			Expect(buf.Len()).To(Equal(0))
+		})
+
+		It("should do nothing when the context is not traced", func() {
+			ctx, span := trace.StartSpan(context.Background(), "api.GetMessage")
+			Expect(span).To(BeNil())
+			span.SetAttribute("key", "value")
+			span.Finish()
+
+			header := http.Header{}
+			trace.Inject(ctx, header)
+			Expect(header.Get("traceparent")).To(Equal(""))
+			Expect(tracer.Stop()).To(Succeed())
+		})
+	})
+})
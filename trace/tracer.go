@@ -0,0 +1,142 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+const (
+	// Export spans in batches of this size
+	batchSize = 512
+	// Spans are dropped if the exporter falls this far behind
+	queueSize = 4096
+	// Export a partial batch if no new spans have arrived within this interval
+	flushInterval = 5 * time.Second
+)
+
+// Exporters send finished spans to a tracing backend
+type Exporter interface {
+	Export(spans []*Span) error
+	Close() error
+}
+
+// The Tracer starts root spans and exports every sampled span once it finishes
+type Tracer struct {
+	// The fraction of new traces that are sampled, between 0 and 1. Traces started by a caller keep the callers decision
+	SampleRatio float64
+
+	exporter Exporter
+	spans    chan *Span
+	wg       sync.WaitGroup
+	mutex    sync.RWMutex
+	stopped  bool
+}
+
+func NewTracer(exporter Exporter, sampleRatio float64) *Tracer {
+	self := &Tracer{
+		SampleRatio: sampleRatio,
+		exporter:    exporter,
+		spans:       make(chan *Span, queueSize),
+	}
+	self.wg.Add(1)
+	go self.run()
+	return self
+}
+
+// Starts a server span. If parent is valid the span continues the trace of the caller, else a new trace is started
+func (self *Tracer) StartServerSpan(ctx context.Context, name string, parent SpanContext) (context.Context, *Span) {
+	if !parent.IsValid() {
+		parent = SpanContext{
+			TraceId: newTraceId(),
+			Sampled: self.SampleRatio >= 1 || rand.Float64() < self.SampleRatio,
+		}
+	}
+	span := self.newSpan(name, KindServer, parent)
+	return AddSpan(ctx, span), span
+}
+
+func (self *Tracer) newSpan(name string, kind SpanKind, parent SpanContext) *Span {
+	return &Span{
+		Name: name,
+		Kind: kind,
+		Context: SpanContext{
+			TraceId: parent.TraceId,
+			SpanId:  newSpanId(),
+			Sampled: parent.Sampled,
+		},
+		ParentId:   parent.SpanId,
+		Start:      time.Now(),
+		Attributes: make(map[string]string),
+		tracer:     self,
+	}
+}
+
+func (self *Tracer) queue(span *Span) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	if self.stopped {
+		return
+	}
+
+	select {
+	case self.spans <- span:
+	default:
+		log.WithField("type", "trace").Debugf("Trace export queue is full, dropped span '%s'", span.Name)
+	}
+}
+
+func (self *Tracer) run() {
+	defer self.wg.Done()
+	batch := make([]*Span, 0, batchSize)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := self.exporter.Export(batch); err != nil {
+			log.WithField("type", "trace").Errorf("Failed to export %d spans - %s", len(batch), err.Error())
+		}
+		batch = make([]*Span, 0, batchSize)
+	}
+
+	for {
+		select {
+		case span, ok := <-self.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Exports any spans still queued and closes the exporter. Spans finished after Stop() are discarded
+func (self *Tracer) Stop() error {
+	self.mutex.Lock()
+	if self.stopped {
+		self.mutex.Unlock()
+		return nil
+	}
+	self.stopped = true
+	close(self.spans)
+	self.mutex.Unlock()
+
+	self.wg.Wait()
+	return self.exporter.Close()
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes exponentially increasing delays between retries with random jitter, so a fleet of clients
+// retrying at the same time doesn't stampede the server when it comes back.
+type Backoff struct {
+	// The delay before the first retry
+	Min time.Duration
+	// The largest delay between retries
+	Max time.Duration
+	// The multiplier applied to the delay after each attempt
+	Factor float64
+	// The fraction of the delay that is randomized, 0.2 results in a delay of +/- 20%
+	Jitter float64
+
+	attempt int
+}
+
+func NewBackoff() *Backoff {
+	return &Backoff{
+		Min:    100 * time.Millisecond,
+		Max:    30 * time.Second,
+		Factor: 2,
+		Jitter: 0.2,
+	}
+}
+
+// Returns the delay to wait before the next attempt
+func (self *Backoff) Next() time.Duration {
+	delay := float64(self.Min)
+	for i := 0; i < self.attempt && delay < float64(self.Max); i++ {
+		delay *= self.Factor
+	}
+	if delay > float64(self.Max) {
+		delay = float64(self.Max)
+	}
+	self.attempt++
+
+	if self.Jitter > 0 {
+		delay += delay * self.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay)
+}
+
+// Returns the number of attempts since the last Reset()
+func (self *Backoff) Attempts() int {
+	return self.attempt
+}
+
+// Call after a successful attempt
+func (self *Backoff) Reset() {
+	self.attempt = 0
+}
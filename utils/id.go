@@ -0,0 +1,19 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+)
+
+// Returns a new random 10 character id, suitable for stores that don't generate their own ids
+func NewId() string {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		panic("crypto/rand failed - " + err.Error())
+	}
+	return base32.StdEncoding.EncodeToString(buf)[:10]
+}
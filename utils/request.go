@@ -0,0 +1,23 @@
+// Copyright 2016 Derrick J. Wippler. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package utils
+
+import "golang.org/x/net/context"
+
+type contextKey int
+
+const (
+	requestIdKey contextKey = 0
+)
+
+func AddRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+// Returns the id of the request, or "" if the context doesn't belong to a request
+func GetRequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/howler-chat/api-service/errors"
@@ -17,6 +18,13 @@ import (
 )
 
 var whiteSpace = regexp.MustCompile(`^\s*$`)
+var handle = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// The largest number of items a client may request in a single list
+const MaxLimit = 1000
+
+// The number of items returned in a list when the client does not request a limit
+const DefaultLimit = 100
 
 type Validation interface {
 	Validate(context.Context) error
@@ -41,6 +49,72 @@ func IsMessageText(text string) error {
 	return nil
 }
 
+// Validates the handle a user is mentioned by
+func IsHandle(text string) error {
+	if !govalidator.StringLength(text, "1", "21") {
+		return stdError.New(fmt.Sprintf("Must be between '%d' and '%d' characters long", 1, 21))
+	}
+	if !handle.MatchString(text) {
+		return stdError.New("Must start with a letter or number and contain only letters, numbers, " +
+			"periods, underscores or hyphens")
+	}
+	return nil
+}
+
+// Validates the display name of a user, an empty display name is allowed
+func IsDisplayName(text string) error {
+	if !govalidator.StringLength(text, "0", "80") {
+		return stdError.New(fmt.Sprintf("Must be between '%d' and '%d' characters long", 0, 80))
+	}
+	return nil
+}
+
+// Validates the avatar of a user is an http or https url, an empty url is allowed
+func IsAvatarUrl(text string) error {
+	if text == "" {
+		return nil
+	}
+	if !govalidator.IsRequestURL(text) {
+		return stdError.New("Must be a valid http or https url")
+	}
+	return nil
+}
+
+// Validates the timezone is a known IANA timezone name, such as 'America/Chicago'. An empty timezone is allowed
+func IsTimezone(text string) error {
+	if text == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(text); err != nil {
+		return stdError.New(fmt.Sprintf("Unknown timezone '%s'", text))
+	}
+	return nil
+}
+
+// Validates the status text of a user, an empty status is allowed
+func IsStatus(text string) error {
+	if !govalidator.StringLength(text, "0", "100") {
+		return stdError.New(fmt.Sprintf("Must be between '%d' and '%d' characters long", 0, 100))
+	}
+	return nil
+}
+
+// Validates the limit requested for a list, 0 indicates the default limit should be used
+func IsValidLimit(limit int) error {
+	if limit < 0 || limit > MaxLimit {
+		return stdError.New(fmt.Sprintf("Must be between '%d' and '%d'", 0, MaxLimit))
+	}
+	return nil
+}
+
+// Validates the offset requested for a list
+func IsValidOffset(offset int) error {
+	if offset < 0 {
+		return stdError.New("Must not be negative")
+	}
+	return nil
+}
+
 func Fail(ctx context.Context, msg string, path *field.Path) errors.HttpError {
 	return errors.NewHttpError(ctx, http.StatusNotAcceptable, nil,
 		"Validation Failed on '%s' - '%s'", path.String(), msg)